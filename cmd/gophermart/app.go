@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/health"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/leader"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/outbox"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/withdrawal"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/routes"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/accrual"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/middlewares/compressor"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/middlewares/conveyor"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// closeTimeout extra time for stopped workers to return interrupted tasks to queue
+const closeTimeout = 5 * time.Second
+
+// errWorkerFailed if service is stopped by failure of background worker
+var errWorkerFailed = errors.New("background worker failed")
+
+// app components of service
+type app struct {
+	lgr  *zap.Logger
+	ent  *env.Env
+	stg  storage.Storage
+	ses  *session.Manager
+	brk  broker.Broker
+	jobs *broker.Queue
+	ckr  *checker.Checker
+	wpr  *withdrawal.Processor
+	rly  *outbox.Relay
+	elc  *leader.Elector
+	mtr  *metrics.Metrics
+	hlt  *health.Health
+	// drainDelay pause between failed readiness and server shutdown
+	drainDelay time.Duration
+	// args command line args for reload of config
+	args []string
+}
+
+// newApp init components of service by environment
+func newApp(ctx context.Context, lgr *zap.Logger, ent *env.Env) (*app, error) {
+	// Storage
+	stg, err := newStorage(ctx, lgr, ent)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions
+	ses := newSessionManager(lgr, ent, stg)
+	// Broker of order checks chosen by environment
+	brk, err := broker.New(lgr, ent.BrokerConfig(), stg)
+	if err != nil {
+		stg.Close()
+		return nil, err
+	}
+	// Durable queue for withdrawals with any broker
+	jobs := broker.NewQueue(lgr, stg, ent.QueueConfig())
+
+	// Accrual system client with limit shared by all workers
+	lim := accrual.NewLimiter(ent.Accrual.RateLimit)
+	acl, err := accrual.New(lgr, ent.Accrual.Address, ent.AccrualConfig(), lim)
+	if err != nil {
+		brk.Close()
+		stg.Close()
+		return nil, err
+	}
+	// Metrics of service
+	mtr := metrics.New(prometheus.NewRegistry())
+	mtr.WatchStorage(stg)
+	if dpt, ok := brk.(metrics.Depther); ok {
+		mtr.WatchDepth(dpt)
+	}
+	// Probes of service, accrual outage only degrade it since orders are checked later
+	hlt := health.New(lgr)
+	hlt.AddCheck("storage", stg.Ping, true)
+	hlt.AddCheck("accrual", acl.Ready, false)
+	if rdr, ok := brk.(health.Readier); ok {
+		hlt.AddCheck("broker", rdr.Ready, true)
+	}
+
+	ckr := checker.New(lgr, stg, acl, lim, brk, mtr, ent.CheckerConfig())
+	// Withdrawals are paid by local gateway without limit
+	wpr := withdrawal.New(lgr, stg, withdrawal.NewFakeGateway(0), mtr, ent.WithdrawalConfig())
+
+	// Only one instance run repeater, outbox relay and withdrawals
+	elc := leader.New(lgr, stg, ent.Leader.Interval)
+
+	// Outbox relay deliver events of orders and withdrawals
+	rly := outbox.New(lgr, stg, ent.OutboxConfig())
+	rly.Handle(models.TopicOrderCreated, ckr.HandleEvent)
+	rly.Handle(models.TopicWithdrawalCreated, func(ctx context.Context, msg models.OutboxMessage) error {
+		return withdrawal.HandleEvent(ctx, jobs, msg)
+	})
+
+	return &app{
+		lgr:        lgr,
+		ent:        ent,
+		stg:        stg,
+		ses:        ses,
+		brk:        brk,
+		jobs:       jobs,
+		ckr:        ckr,
+		wpr:        wpr,
+		rly:        rly,
+		elc:        elc,
+		mtr:        mtr,
+		hlt:        hlt,
+		drainDelay: ent.Server.DrainDelay,
+		args:       os.Args[1:],
+	}, nil
+}
+
+// run serve requests and background workers until signal or failure of worker
+// Shutdown is ordered, so tasks in work are finished before storage is closed
+// Config is reloaded on signal of reload channel
+func (a *app) run(interrupt, reload <-chan os.Signal) error {
+	// Producers push tasks to brokers
+	producerCtx, stopProducers := context.WithCancel(context.Background())
+	defer stopProducers()
+	// Consumers handle tasks from brokers
+	consumerCtx, stopConsumers := context.WithCancel(context.Background())
+	defer stopConsumers()
+
+	failed := make(chan struct{})
+	once := sync.Once{}
+	fail := func() {
+		once.Do(func() {
+			close(failed)
+		})
+	}
+	producers := &sync.WaitGroup{}
+	consumers := &sync.WaitGroup{}
+
+	// Init subscribers of order checks
+	a.start(consumerCtx, consumers, "subscriber", fail, func(ctx context.Context) error {
+		return a.brk.Subscribe(ctx, models.JobCheckOrder, a.ckr.HandleMessage)
+	})
+	// Init workers of durable queue
+	a.start(consumerCtx, consumers, "queue", fail, func(ctx context.Context) error {
+		group, currentCtx := errgroup.WithContext(ctx)
+		group.Go(func() error {
+			return a.jobs.Subscribe(currentCtx, models.JobWithdraw, a.wpr.HandleMessage)
+		})
+		// Dead letters are replayed to durable queue, so it handle order checks with other brokers too
+		if a.ent.Broker.Type != broker.TypeQueue {
+			group.Go(func() error {
+				return a.jobs.Subscribe(currentCtx, models.JobCheckOrder, a.ckr.HandleMessage)
+			})
+		}
+		return group.Wait()
+	})
+	// Withdraw handler
+	a.start(consumerCtx, consumers, "withdrawal", fail, func(ctx context.Context) error {
+		return a.elc.Run(ctx, "withdrawal", a.wpr.Run)
+	})
+	// Outbox relay and repeater only publish tasks
+	a.start(producerCtx, producers, "outbox", fail, func(ctx context.Context) error {
+		return a.elc.Run(ctx, "outbox", a.rly.Run)
+	})
+	a.start(producerCtx, producers, "repeater", fail, func(ctx context.Context) error {
+		return a.elc.Run(ctx, "repeater", a.ckr.Repeater)
+	})
+	// Each instance keep own revoked and checked sessions
+	a.start(producerCtx, producers, "sessions", fail, a.ses.Run)
+
+	// Init server
+	rtr := routes.Router(a.lgr, a.stg, a.ses, a.ckr, a.ent.Auth.AdminToken, a.mtr, a.hlt)
+	if a.ent.Auth.AdminToken == "" {
+		a.lgr.Warn("Admin token not defined, admin API is disabled")
+	}
+	srv := &http.Server{
+		Handler: conveyor.Conveyor(
+			rtr,
+			compressor.New(a.lgr).Gzip,
+		),
+	}
+	lsn, err := net.Listen("tcp", a.ent.Server.Address)
+	if err != nil {
+		fail()
+		a.shutdown(nil, stopProducers, producers, stopConsumers, consumers)
+		return err
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(lsn)
+	}()
+	a.lgr.Info("The service is ready to listen and serve.", zap.String("addr", lsn.Addr().String()))
+
+serve:
+	for {
+		select {
+		case sig := <-reload:
+			a.lgr.Info("Got signal, reload config", zap.String("signal", sig.String()))
+			a.reload()
+		case sig := <-interrupt:
+			a.lgr.Info("Got signal, shutdown", zap.String("signal", sig.String()))
+			break serve
+		case <-failed:
+			err = errWorkerFailed
+			a.lgr.Error("Background worker failed, shutdown")
+			break serve
+		case err = <-served:
+			a.lgr.Error("Server error, shutdown", zap.Error(err))
+			break serve
+		}
+	}
+
+	a.shutdown(srv, stopProducers, producers, stopConsumers, consumers)
+
+	return err
+}
+
+// reload read config again and resize worker pools
+// Invalid config is ignored, other values are applied after restart
+func (a *app) reload() {
+	ent, err := env.Load(a.args, ioutil.Discard)
+	if err != nil {
+		a.lgr.Error("Reload config error, current config is kept", zap.Error(err))
+		return
+	}
+
+	brk := ent.BrokerConfig()
+	// Broker type is changed only by restart
+	brk.Type = a.ent.Broker.Type
+	if rsz, ok := a.brk.(broker.Resizer); ok {
+		rsz.Resize(brk.Workers())
+	}
+	a.jobs.Resize(ent.Queue.Workers)
+	a.lgr.Info("Config reloaded", zap.Int("broker workers", brk.Workers()), zap.Int("queue workers", ent.Queue.Workers))
+}
+
+// start run worker in goroutine, error of worker stop service
+func (a *app) start(ctx context.Context, wg *sync.WaitGroup, name string, fail func(), worker func(ctx context.Context) error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer a.hlt.Worker(name)()
+
+		if err := worker(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			a.lgr.Error("Worker returned error", zap.String("worker", name), zap.Error(err))
+			fail()
+		}
+	}()
+}
+
+// shutdown stop service in order of dependencies
+// Storage is closed last, because requests and tasks use it until they are done
+func (a *app) shutdown(
+	srv *http.Server,
+	stopProducers context.CancelFunc,
+	producers *sync.WaitGroup,
+	stopConsumers context.CancelFunc,
+	consumers *sync.WaitGroup,
+) {
+	// Readiness fails first, so balancers stop sending requests while server still serve them
+	a.hlt.Drain()
+	if srv != nil {
+		a.lgr.Info("Draining before shutdown", zap.Duration("delay", a.drainDelay))
+		time.Sleep(a.drainDelay)
+
+		// Stop accepting requests and wait requests in work
+		ctx, cancel := context.WithTimeout(context.Background(), a.ent.Server.ShutdownTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			a.lgr.Error("Server shutdown error", zap.Error(err))
+		}
+		cancel()
+		a.lgr.Info("Server stopped")
+	}
+
+	// Nothing publish tasks after repeater and outbox relay
+	stopProducers()
+	producers.Wait()
+	a.lgr.Info("Producers stopped")
+
+	// Consumers finish current tasks or return them to queue after shutdown timeout
+	stopConsumers()
+	if !wait(consumers, a.ent.Server.ShutdownTimeout+closeTimeout) {
+		a.lgr.Error("Consumers aren't stopped in time", zap.Duration("timeout", a.ent.Server.ShutdownTimeout))
+	} else {
+		a.lgr.Info("Consumers stopped")
+	}
+
+	// Close broker connections, then storage
+	a.brk.Close()
+	a.jobs.Close()
+	a.stg.Close()
+	a.lgr.Info("Storage connection stopped")
+}
+
+// wait return false if wait group isn't done in timeout
+func wait(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/health"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fixture service with memory storage and accrual system which answer on release
+type fixture struct {
+	t       *testing.T
+	app     *app
+	started chan string
+	release chan struct{}
+	done    chan error
+}
+
+func newFixture(t *testing.T, shutdownTimeout time.Duration) *fixture {
+	f := &fixture{
+		t:       t,
+		started: make(chan string, 1),
+		release: make(chan struct{}),
+		done:    make(chan error, 1),
+	}
+	acr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := path.Base(r.URL.Path)
+		f.started <- code
+		select {
+		case <-f.release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.LoyalOrder{Order: code, Status: models.LoyalProcessed, Accrual: 1000})
+	}))
+	t.Cleanup(acr.Close)
+
+	ent := env.Default()
+	ent.Accrual.Address = acr.URL
+	ent.Server.Address = "127.0.0.1:0"
+	ent.Server.ShutdownTimeout = shutdownTimeout
+	ent.Server.DrainDelay = 0
+	ent.Broker.Type = broker.TypeGO
+	ent.Broker.Workers = 1
+	ent.Storage.Type = env.StorageTypeMemory
+	ent.Storage.PasswordHashCost = password.MinCost
+	ent.Auth.Secret = "secret"
+	a, err := newApp(context.Background(), zap.NewNop(), ent)
+	require.NoError(t, err)
+	f.app = a
+
+	return f
+}
+
+// run start service which stop on SIGTERM and reload config on SIGHUP of process
+func (f *fixture) run() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	f.t.Cleanup(func() {
+		signal.Stop(interrupt)
+		signal.Stop(reload)
+	})
+
+	go func() {
+		f.done <- f.app.run(interrupt, reload)
+	}()
+}
+
+// check put orders and wait check of first one in accrual system
+func (f *fixture) check(codes ...string) {
+	ctx := context.Background()
+	require.NoError(f.t, f.app.stg.Register(ctx, models.User{Login: "user", Password: "secret"}))
+	usr, err := f.app.stg.UserByLogin(ctx, "user")
+	require.NoError(f.t, err)
+	for _, code := range codes {
+		ord := models.Order{UserID: usr.UserID, Code: code}
+		require.NoError(f.t, f.app.stg.PutOrder(ctx, ord))
+		require.NoError(f.t, f.app.ckr.Enqueue(ctx, ord))
+	}
+
+	f.checked()
+}
+
+// checked wait start of order check in accrual system
+func (f *fixture) checked() {
+	select {
+	case <-f.started:
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("order isn't checked")
+	}
+}
+
+// signal send signal to process
+func (f *fixture) signal(sig os.Signal) {
+	prc, err := os.FindProcess(os.Getpid())
+	require.NoError(f.t, err)
+	require.NoError(f.t, prc.Signal(sig))
+}
+
+// terminate send SIGTERM to process
+func (f *fixture) terminate() {
+	f.signal(syscall.SIGTERM)
+}
+
+// stopped wait service exit
+func (f *fixture) stopped(timeout time.Duration) {
+	select {
+	case err := <-f.done:
+		assert.NoError(f.t, err)
+	case <-time.After(timeout):
+		f.t.Fatal("service isn't stopped")
+	}
+}
+
+func TestApp_ShutdownFinishTasks(t *testing.T) {
+	f := newFixture(t, 5*time.Second)
+	f.run()
+	f.check("12345678903")
+
+	f.terminate()
+	// Task in work isn't interrupted by signal
+	assert.Eventually(t, func() bool {
+		rep := f.app.hlt.Report(context.Background())
+		return rep.Status == health.StatusDraining
+	}, time.Second, time.Millisecond)
+	close(f.release)
+	f.stopped(5 * time.Second)
+
+	ord, err := f.app.stg.OrderByCode(context.Background(), 12345678903)
+	require.NoError(t, err)
+	assert.True(t, ord.IsCheckDone)
+	assert.Equal(t, models.LoyalProcessed, ord.CheckStatus)
+}
+
+func TestApp_ShutdownTimeout(t *testing.T) {
+	f := newFixture(t, 100*time.Millisecond)
+	f.run()
+	f.check("12345678903")
+
+	// Task which isn't finished in shutdown timeout is interrupted
+	start := time.Now()
+	f.terminate()
+	f.stopped(5 * time.Second)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	ord, err := f.app.stg.OrderByCode(context.Background(), 12345678903)
+	require.NoError(t, err)
+	assert.False(t, ord.IsCheckDone)
+}
+
+func TestApp_Reload(t *testing.T) {
+	f := newFixture(t, 100*time.Millisecond)
+	cfg := path.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(cfg, []byte(`
+server:
+  address: 127.0.0.1:0
+storage:
+  type: memory
+accrual:
+  address: http://localhost:8080
+broker:
+  type: go
+  workers: 3
+`), 0600))
+	f.app.args = []string{"-config", cfg}
+	f.run()
+	f.check("12345678903", "79927398713", "4561261212345467")
+	select {
+	case <-f.started:
+		t.Fatal("order is checked by second worker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Other orders are checked at once by new workers
+	f.signal(syscall.SIGHUP)
+	f.checked()
+	f.checked()
+
+	close(f.release)
+	f.terminate()
+	f.stopped(5 * time.Second)
+}
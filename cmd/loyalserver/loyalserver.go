@@ -23,7 +23,7 @@ func main() {
 		odr := models.LoyalOrder{
 			Order:   number,
 			Status:  "REGISTERED",
-			Accrual: 729.98,
+			Accrual: 72998, // 729.98 points
 		}
 
 		min := 0
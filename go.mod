@@ -3,16 +3,18 @@ module github.com/triumphpc/go-musthave-diploma-gophermart
 go 1.16
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/jackc/pgerrcode v0.0.0-20201024163028-a0d42d470451 // indirect
-	github.com/joho/godotenv v1.4.0 // indirect
-	github.com/lib/pq v1.10.3 // indirect
-	github.com/pressly/goose/v3 v3.2.0 // indirect
-	github.com/streadway/amqp v1.0.0 // indirect
+	github.com/gorilla/mux v1.8.0
+	github.com/jackc/pgerrcode v0.0.0-20201024163028-a0d42d470451
+	github.com/joho/godotenv v1.4.0
+	github.com/lib/pq v1.10.3
+	github.com/pressly/goose/v3 v3.2.0
+	github.com/prometheus/client_golang v1.11.0
+	github.com/streadway/amqp v1.0.0
 	github.com/stretchr/testify v1.7.0
-	github.com/theplant/luhn v0.0.0-20170224032821-81a1a381387a // indirect
-	go.uber.org/zap v1.19.1 // indirect
+	github.com/theplant/luhn v0.0.0-20170224032821-81a1a381387a
+	go.uber.org/zap v1.19.1
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 	golang.org/x/net v0.0.0-20211020060615-d418f374d309 // indirect
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
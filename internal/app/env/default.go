@@ -0,0 +1,192 @@
+package env
+
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/leader"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/outbox"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/queue"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/withdrawal"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/accrual"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/mq"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// Default return config with defaults of components
+func Default() *Env {
+	acr := accrual.DefaultConfig()
+	ckr := checker.DefaultConfig()
+	sub := broker.DefaultSubscriberConfig()
+	rmq := mq.DefaultConfig()
+	que := queue.DefaultConfig()
+	wdr := withdrawal.DefaultConfig()
+	out := outbox.DefaultConfig()
+
+	return &Env{
+		Server: Server{
+			ShutdownTimeout: DefaultShutdownTimeout,
+			DrainDelay:      DefaultDrainDelay,
+		},
+		Storage: Storage{
+			Type:             StorageTypePg,
+			PasswordHashCost: password.DefaultCost,
+		},
+		Auth: Auth{
+			AccessTTL:  session.DefaultAccessTTL,
+			RefreshTTL: session.DefaultRefreshTTL,
+		},
+		Accrual: Accrual{
+			Timeout:          acr.Timeout,
+			Retries:          acr.Retries,
+			RetryWait:        acr.RetryWait,
+			BreakerThreshold: acr.BreakerThreshold,
+			BreakerCooldown:  acr.BreakerCooldown,
+			MaxConns:         acr.MaxConns,
+		},
+		Checker: Checker{
+			Interval:     ckr.Interval,
+			Batch:        ckr.Batch,
+			MaxAttempts:  ckr.Retry.MaxAttempts,
+			RetryWait:    ckr.Retry.Base,
+			MaxRetryWait: ckr.Retry.Max,
+			RetryJitter:  ckr.Retry.Jitter,
+		},
+		Broker: Broker{
+			// Durable queue don't need other services
+			Type:         broker.TypeQueue,
+			Workers:      sub.Workers,
+			Buffer:       sub.Buffer,
+			MaxAttempts:  sub.Retry.MaxAttempts,
+			RetryWait:    sub.Retry.Base,
+			MaxRetryWait: sub.Retry.Max,
+			RetryJitter:  sub.Retry.Jitter,
+			Rabbit: Rabbit{
+				MaxRetries:       rmq.MaxRetries,
+				RetryWait:        rmq.RetryWait,
+				MaxRetryWait:     rmq.MaxRetryWait,
+				ReconnectWait:    rmq.ReconnectWait,
+				MaxReconnectWait: rmq.MaxReconnectWait,
+				ConfirmTimeout:   rmq.ConfirmTimeout,
+				Prefetch:         rmq.Prefetch,
+			},
+		},
+		Queue: Queue{
+			Workers:      que.Workers,
+			Batch:        que.Batch,
+			PollInterval: que.PollInterval,
+			Visibility:   que.Visibility,
+			RetryWait:    que.Retry.Base,
+			MaxRetryWait: que.Retry.Max,
+			MaxAttempts:  que.Retry.MaxAttempts,
+			RetryJitter:  que.Retry.Jitter,
+		},
+		Withdrawal: Withdrawal{
+			PollInterval: wdr.PollInterval,
+			Batch:        wdr.Batch,
+			StaleTimeout: wdr.StaleTimeout,
+		},
+		Outbox: Outbox{
+			Batch:        out.Batch,
+			PollInterval: out.PollInterval,
+		},
+		Leader: Leader{
+			Interval: leader.DefaultInterval,
+		},
+		Log: Log{
+			Level: zap.InfoLevel.String(),
+		},
+	}
+}
+
+// AccrualConfig config of accrual system client
+func (e *Env) AccrualConfig() accrual.Config {
+	return accrual.Config{
+		Timeout:          e.Accrual.Timeout,
+		Retries:          e.Accrual.Retries,
+		RetryWait:        e.Accrual.RetryWait,
+		BreakerThreshold: e.Accrual.BreakerThreshold,
+		BreakerCooldown:  e.Accrual.BreakerCooldown,
+		MaxConns:         e.Accrual.MaxConns,
+	}
+}
+
+// CheckerConfig config of checker of orders
+func (e *Env) CheckerConfig() checker.Config {
+	return checker.Config{
+		Interval: e.Checker.Interval,
+		Batch:    e.Checker.Batch,
+		Retry: retry.Exponential{
+			Base:        e.Checker.RetryWait,
+			Max:         e.Checker.MaxRetryWait,
+			MaxAttempts: e.Checker.MaxAttempts,
+			Jitter:      e.Checker.RetryJitter,
+		},
+	}
+}
+
+// BrokerConfig config of broker of order checks
+func (e *Env) BrokerConfig() broker.Config {
+	return broker.Config{
+		Type: e.Broker.Type,
+		Host: e.Broker.Host,
+		Subscriber: broker.SubscriberConfig{
+			Workers: e.Broker.Workers,
+			Buffer:  e.Broker.Buffer,
+			Retry: retry.Exponential{
+				Base:        e.Broker.RetryWait,
+				Max:         e.Broker.MaxRetryWait,
+				MaxAttempts: e.Broker.MaxAttempts,
+				Jitter:      e.Broker.RetryJitter,
+			},
+			ShutdownTimeout: e.Server.ShutdownTimeout,
+		},
+		Rabbit: mq.Config{
+			MaxRetries:       e.Broker.Rabbit.MaxRetries,
+			RetryWait:        e.Broker.Rabbit.RetryWait,
+			MaxRetryWait:     e.Broker.Rabbit.MaxRetryWait,
+			ReconnectWait:    e.Broker.Rabbit.ReconnectWait,
+			MaxReconnectWait: e.Broker.Rabbit.MaxReconnectWait,
+			ConfirmTimeout:   e.Broker.Rabbit.ConfirmTimeout,
+			Prefetch:         e.Broker.Rabbit.Prefetch,
+			ShutdownTimeout:  e.Server.ShutdownTimeout,
+		},
+		Queue: e.QueueConfig(),
+	}
+}
+
+// QueueConfig config of durable queue workers
+func (e *Env) QueueConfig() queue.Config {
+	return queue.Config{
+		Workers:      e.Queue.Workers,
+		Batch:        e.Queue.Batch,
+		PollInterval: e.Queue.PollInterval,
+		Visibility:   e.Queue.Visibility,
+		Retry: retry.Exponential{
+			Base:        e.Queue.RetryWait,
+			Max:         e.Queue.MaxRetryWait,
+			MaxAttempts: e.Queue.MaxAttempts,
+			Jitter:      e.Queue.RetryJitter,
+		},
+		ShutdownTimeout: e.Server.ShutdownTimeout,
+	}
+}
+
+// WithdrawalConfig config of withdrawal handler
+func (e *Env) WithdrawalConfig() withdrawal.Config {
+	return withdrawal.Config{
+		PollInterval: e.Withdrawal.PollInterval,
+		Batch:        e.Withdrawal.Batch,
+		StaleTimeout: e.Withdrawal.StaleTimeout,
+	}
+}
+
+// OutboxConfig config of outbox relay
+func (e *Env) OutboxConfig() outbox.Config {
+	return outbox.Config{
+		Batch:        e.Outbox.Batch,
+		PollInterval: e.Outbox.PollInterval,
+	}
+}
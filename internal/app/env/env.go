@@ -1,102 +1,288 @@
-// Package env implement work with environments and flags
+// Package env implement configuration of project
+// Values are layered by precedence: defaults, dot env file, YAML config file, environment variables, flags
 // @author Sergey Vrulin (aka Alex Versus)
 package env
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/caarlos0/env"
 	"github.com/joho/godotenv"
-	"log"
+	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"time"
 )
 
-// ErrDSNNotDefine in dsn database not defines from variables
-var ErrDSNNotDefine = "DSN not define"
+// ErrPrintConfig if config is printed and service must not be started
+var ErrPrintConfig = errors.New("config printed")
 
-// ErrServerAddressNotDefined if address not defines
-var ErrServerAddressNotDefined = "Server address not defined"
+// Names of variables and files of configuration
+const (
+	// ConfigFile variable with path of YAML config file
+	ConfigFile = "CONFIG"
+	// DotEnvFile file with variables for local run, YAML config file and real environment variables have priority over it
+	DotEnvFile = "./configs/.env"
+)
 
-// Env project environment configuration
-type Env struct {
-	DatabaseDsn          string `env:"DATABASE_URI" envDefault:""`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:""`
-	ServerAddress        string `env:"RUN_ADDRESS" envDefault:""`
-	BrokerType           string
-	BrokerHost           string
-}
+// Storage types
+const (
+	StorageTypePg     = "pg"
+	StorageTypeMemory = "memory"
+)
 
-// Constants for variables name
+// Defaults of server
 const (
-	DatabaseDsn          = "DATABASE_URI"
-	AccrualSystemAddress = "ACCRUAL_SYSTEM_ADDRESS"
-	ServerAddress        = "RUN_ADDRESS"
-	BrokerType           = "BROKER_TYPE"
-	BrokerHost           = "BROKER_HOST"
-
-	BrokerTypeRabbitMQ = "rabbit"
-	BrokerTypeGO       = "go"
+	// DefaultShutdownTimeout time for current tasks to be finished on shutdown
+	DefaultShutdownTimeout = 30 * time.Second
+	// DefaultDrainDelay time for balancers to see failed readiness before server shutdown
+	DefaultDrainDelay = 5 * time.Second
 )
 
-// Maps for take inv params
-var varToInv = map[string]string{
-	DatabaseDsn:          "d",
-	AccrualSystemAddress: "r",
-	ServerAddress:        "a",
+// Env project configuration
+type Env struct {
+	Server     Server     `yaml:"server"`
+	Storage    Storage    `yaml:"storage"`
+	Auth       Auth       `yaml:"auth"`
+	Accrual    Accrual    `yaml:"accrual"`
+	Checker    Checker    `yaml:"checker"`
+	Broker     Broker     `yaml:"broker"`
+	Queue      Queue      `yaml:"queue"`
+	Withdrawal Withdrawal `yaml:"withdrawal"`
+	Outbox     Outbox     `yaml:"outbox"`
+	Leader     Leader     `yaml:"leader"`
+	Log        Log        `yaml:"log"`
+	// File path of loaded config file
+	File string `yaml:"-"`
+}
+
+// Server config of HTTP server and shutdown
+type Server struct {
+	Address         string        `yaml:"address" env:"RUN_ADDRESS" flag:"a" usage:"address of HTTP server"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"time for requests and tasks to be finished on shutdown"`
+	DrainDelay      time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" usage:"pause between failed readiness and server shutdown"`
+}
+
+// Storage config of storage
+type Storage struct {
+	Type             string `yaml:"type" env:"STORAGE_TYPE" flag:"s" usage:"storage type: pg or memory"`
+	DatabaseDsn      string `yaml:"database_uri" env:"DATABASE_URI" flag:"d" secret:"true" usage:"postgres connection string"`
+	PasswordHashCost int    `yaml:"password_hash_cost" env:"PASSWORD_HASH_COST" usage:"bcrypt cost of password hashes"`
+}
+
+// Auth config of sessions and admin API
+type Auth struct {
+	Secret       string        `yaml:"secret" env:"AUTH_SECRET" secret:"true" usage:"secret of session tokens, random if empty"`
+	AccessTTL    time.Duration `yaml:"access_ttl" env:"ACCESS_TTL" usage:"lifetime of access token"`
+	RefreshTTL   time.Duration `yaml:"refresh_ttl" env:"REFRESH_TTL" usage:"lifetime of refresh token"`
+	SessionCheck time.Duration `yaml:"session_check" env:"SESSION_CHECK" usage:"period of check of session in storage for revoke on other instances, 0 is disabled"`
+	AdminToken   string        `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true" usage:"token of admin API, API is disabled if empty"`
+}
+
+// Accrual config of accrual system client
+type Accrual struct {
+	Address          string        `yaml:"address" env:"ACCRUAL_SYSTEM_ADDRESS" flag:"r" usage:"address of accrual system"`
+	RateLimit        float64       `yaml:"rate_limit" env:"ACCRUAL_RATE_LIMIT" usage:"requests per second to accrual system, 0 is unlimited"`
+	Timeout          time.Duration `yaml:"timeout" env:"ACCRUAL_TIMEOUT" usage:"timeout of one request"`
+	Retries          int           `yaml:"retries" env:"ACCRUAL_RETRIES" usage:"repeats of failed request"`
+	RetryWait        time.Duration `yaml:"retry_wait" env:"ACCRUAL_RETRY_WAIT" usage:"base pause between repeats"`
+	BreakerThreshold int           `yaml:"breaker_threshold" env:"ACCRUAL_BREAKER_THRESHOLD" usage:"failed calls in a row which open breaker"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env:"ACCRUAL_BREAKER_COOLDOWN" usage:"pause of calls after breaker opened"`
+	MaxConns         int           `yaml:"max_conns" env:"ACCRUAL_MAX_CONNS" usage:"max idle connections"`
+}
+
+// Checker config of repeated checks of orders
+type Checker struct {
+	Interval     time.Duration `yaml:"interval" env:"CHECKER_INTERVAL" usage:"pause between searches of orders for repeated check"`
+	Batch        int           `yaml:"batch" env:"CHECKER_BATCH" usage:"orders pushed to broker at once"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"CHECKER_MAX_ATTEMPTS" usage:"failed checks before order is invalid"`
+	RetryWait    time.Duration `yaml:"retry_wait" env:"CHECKER_RETRY_WAIT" usage:"pause before repeat of failed check"`
+	MaxRetryWait time.Duration `yaml:"max_retry_wait" env:"CHECKER_MAX_RETRY_WAIT" usage:"max pause before repeat of failed check"`
+	RetryJitter  float64       `yaml:"retry_jitter" env:"CHECKER_RETRY_JITTER" usage:"random part of pause before repeat, from 0 to 1"`
+}
+
+// Broker config of order checks transport
+type Broker struct {
+	Type         string        `yaml:"type" env:"BROKER_TYPE" usage:"broker type: queue, go or rabbit"`
+	Host         string        `yaml:"host" env:"BROKER_HOST" secret:"true" usage:"url of rabbit mq"`
+	Workers      int           `yaml:"workers" env:"BROKER_WORKERS" usage:"parallel handlers of messages, applied on SIGHUP"`
+	Buffer       int           `yaml:"buffer" env:"BROKER_BUFFER" usage:"capacity of go channel of kind"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"BROKER_MAX_ATTEMPTS" usage:"attempts before message is moved to dead letters"`
+	RetryWait    time.Duration `yaml:"retry_wait" env:"BROKER_RETRY_WAIT" usage:"pause before repeat of failed message"`
+	MaxRetryWait time.Duration `yaml:"max_retry_wait" env:"BROKER_MAX_RETRY_WAIT" usage:"max pause before repeat of failed message"`
+	RetryJitter  float64       `yaml:"retry_jitter" env:"BROKER_RETRY_JITTER" usage:"random part of pause before repeat, from 0 to 1"`
+	Rabbit       Rabbit        `yaml:"rabbit"`
+}
+
+// Rabbit config of rabbit mq handler
+type Rabbit struct {
+	MaxRetries       int           `yaml:"max_retries" env:"RABBIT_MAX_RETRIES" usage:"repeats before message is moved to dead exchange"`
+	RetryWait        time.Duration `yaml:"retry_wait" env:"RABBIT_RETRY_WAIT" usage:"pause before repeat of failed message"`
+	MaxRetryWait     time.Duration `yaml:"max_retry_wait" env:"RABBIT_MAX_RETRY_WAIT" usage:"max pause before repeat of failed message"`
+	ReconnectWait    time.Duration `yaml:"reconnect_wait" env:"RABBIT_RECONNECT_WAIT" usage:"pause before reconnect"`
+	MaxReconnectWait time.Duration `yaml:"max_reconnect_wait" env:"RABBIT_MAX_RECONNECT_WAIT" usage:"max pause before reconnect"`
+	ConfirmTimeout   time.Duration `yaml:"confirm_timeout" env:"RABBIT_CONFIRM_TIMEOUT" usage:"max wait of publish confirm"`
+	Prefetch         int           `yaml:"prefetch" env:"RABBIT_PREFETCH" usage:"unacked messages of consumer"`
+}
+
+// Queue config of durable jobs queue
+type Queue struct {
+	Workers      int           `yaml:"workers" env:"QUEUE_WORKERS" usage:"parallel workers of kind, applied on SIGHUP"`
+	Batch        int           `yaml:"batch" env:"QUEUE_BATCH" usage:"jobs claimed by worker at once"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"QUEUE_POLL_INTERVAL" usage:"pause between claims when queue is empty"`
+	Visibility   time.Duration `yaml:"visibility" env:"QUEUE_VISIBILITY" usage:"time while claimed job is hidden for other workers"`
+	RetryWait    time.Duration `yaml:"retry_wait" env:"QUEUE_RETRY_WAIT" usage:"pause before repeat of failed job"`
+	MaxRetryWait time.Duration `yaml:"max_retry_wait" env:"QUEUE_MAX_RETRY_WAIT" usage:"max pause before repeat of failed job"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"QUEUE_MAX_ATTEMPTS" usage:"attempts before job is moved to dead letters"`
+	RetryJitter  float64       `yaml:"retry_jitter" env:"QUEUE_RETRY_JITTER" usage:"random part of pause before repeat, from 0 to 1"`
+}
+
+// Withdrawal config of handler of unfinished withdrawals
+type Withdrawal struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"WITHDRAWAL_POLL_INTERVAL" usage:"pause between searches of unfinished withdrawals"`
+	Batch        int           `yaml:"batch" env:"WITHDRAWAL_BATCH" usage:"withdrawals processed at once"`
+	StaleTimeout time.Duration `yaml:"stale_timeout" env:"WITHDRAWAL_STALE_TIMEOUT" usage:"time after which processing withdrawal is taken again"`
+}
+
+// Outbox config of outbox relay
+type Outbox struct {
+	Batch        int           `yaml:"batch" env:"OUTBOX_BATCH" usage:"events read at once"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" usage:"pause between reads when outbox is empty"`
 }
 
-// New construct for Env struct
-func New() (e *Env) {
-	e = new(Env)
-	e.init()
+// Leader config of election of instance for background jobs
+type Leader struct {
+	Interval time.Duration `yaml:"interval" env:"LEADER_INTERVAL" usage:"how often followers try to take leadership"`
+}
 
-	return
+// Log config of logger
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" usage:"log level: debug, info, warn or error"`
 }
 
-// Init env params for project
-func (e *Env) init() {
-	// reset from env vars
-	_ = env.Parse(e)
-	//reset from flag
-	dsn := flag.String(varToInv[DatabaseDsn], "", "")
-	accrualAddr := flag.String(varToInv[AccrualSystemAddress], "", "")
-	serverAddr := flag.String(varToInv[ServerAddress], "", "")
-	flag.Parse()
+// New load configuration from command line args and exit on error
+func New() *Env {
+	e, err := Load(os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) || errors.Is(err, ErrPrintConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	e.DatabaseDsn = *dsn
-	if e.DatabaseDsn == "" {
-		e.DatabaseDsn = e.fromDotEnv(DatabaseDsn)
+	return e
+}
+
+// Load build configuration by layers and validate it
+// Effective config is printed to out with --print-config flag, secrets are masked
+func Load(args []string, out io.Writer) (*Env, error) {
+	// Dot env file isn't copied to process environment, so it don't override config file
+	dotEnv, err := readDotEnv(DotEnvFile)
+	if err != nil {
+		return nil, err
 	}
 
-	e.AccrualSystemAddress = *accrualAddr
-	if e.AccrualSystemAddress == "" {
-		e.AccrualSystemAddress = e.fromDotEnv(AccrualSystemAddress)
+	e := Default()
+	opts := options(e)
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	file := fs.String("config", lookup(dotEnv, ConfigFile), "path of YAML config file")
+	printConfig := fs.Bool("print-config", false, "print effective config and exit")
+	flags := bind(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
 
-	e.ServerAddress = *serverAddr
-	if e.ServerAddress == "" {
-		e.ServerAddress = e.fromDotEnv(ServerAddress)
+	for _, opt := range opts {
+		if err := opt.fromVars(dotEnv, "dot env variable"); err != nil {
+			return nil, err
+		}
+	}
+	if *file != "" {
+		if err := e.readFile(*file); err != nil {
+			return nil, err
+		}
+		e.File = *file
+	}
+	for _, opt := range opts {
+		if err := opt.fromVars(os.LookupEnv, "environment variable"); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range flags {
+		f.apply()
 	}
 
-	e.BrokerType = e.fromDotEnv(BrokerType)
-	e.BrokerHost = e.fromDotEnv(BrokerHost)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	if *printConfig {
+		if err := e.Print(out); err != nil {
+			return nil, err
+		}
+		return e, ErrPrintConfig
+	}
 
-	if e.DatabaseDsn == "" {
-		log.Fatal(ErrDSNNotDefine)
+	return e, nil
+}
+
+// Print write config in YAML with masked secrets
+func (e *Env) Print(w io.Writer) error {
+	masked := *e
+	for _, opt := range options(&masked) {
+		opt.mask()
 	}
 
-	if e.ServerAddress == "" {
-		log.Fatal(ErrServerAddressNotDefined)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(masked); err != nil {
+		return err
 	}
+
+	return enc.Close()
 }
 
-// use godot package to load/read the .env file and
-// return the value of the key
-func (e *Env) fromDotEnv(key string) string {
-	err := godotenv.Load("./configs/.env")
+// readDotEnv read variables of dot env file if it exists
+func readDotEnv(path string) (func(string) (string, bool), error) {
+	vars := map[string]string{}
+	if _, err := os.Stat(path); err == nil {
+		if vars, err = godotenv.Read(path); err != nil {
+			return nil, fmt.Errorf("dot env file %s: %w", path, err)
+		}
+	}
+
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}, nil
+}
+
+// lookup return environment variable or variable of dot env file
+func lookup(dotEnv func(string) (string, bool), key string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	v, _ := dotEnv(key)
+
+	return v
+}
+
+// readFile read YAML config file over current values
+func (e *Env) readFile(path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Println(err)
-		return ""
+		return fmt.Errorf("config file: %w", err)
 	}
-	return os.Getenv(key)
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	// Typo in key must not be ignored silently
+	dec.KnownFields(true)
+	if err := dec.Decode(e); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,177 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setEnv set environment variable until end of test
+func setEnv(t *testing.T, key, value string) {
+	prev, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+			return
+		}
+		_ = os.Unsetenv(key)
+	})
+}
+
+// writeFile create config file in temp dir
+func writeFile(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(body), 0600))
+
+	return path
+}
+
+// required args for valid config
+var required = []string{"-a", ":8080", "-r", "http://localhost:8081", "-s", StorageTypeMemory}
+
+func TestLoad_Defaults(t *testing.T) {
+	e, err := Load(required, ioutil.Discard)
+	require.NoError(t, err)
+
+	expected := Default()
+	expected.Server.Address = ":8080"
+	expected.Accrual.Address = "http://localhost:8081"
+	expected.Storage.Type = StorageTypeMemory
+	assert.Equal(t, expected, e)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  address: ":9000"
+  shutdown_timeout: 10s
+storage:
+  type: memory
+accrual:
+  address: http://accrual:8080
+  rate_limit: 5
+queue:
+  workers: 3
+  poll_interval: 2s
+`)
+	setEnv(t, ConfigFile, path)
+	setEnv(t, "QUEUE_WORKERS", "5")
+	setEnv(t, "ACCRUAL_RATE_LIMIT", "7.5")
+	setEnv(t, "RUN_ADDRESS", ":9001")
+
+	e, err := Load([]string{"-queue.workers", "8", "-a", ":9002"}, ioutil.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, path, e.File)
+	// Flags override environment, environment override file
+	assert.Equal(t, 8, e.Queue.Workers)
+	assert.Equal(t, ":9002", e.Server.Address)
+	assert.Equal(t, 7.5, e.Accrual.RateLimit)
+	// File override defaults
+	assert.Equal(t, 10*time.Second, e.Server.ShutdownTimeout)
+	assert.Equal(t, 2*time.Second, e.Queue.PollInterval)
+	assert.Equal(t, "http://accrual:8080", e.Accrual.Address)
+	assert.Equal(t, Default().Queue.Batch, e.Queue.Batch)
+}
+
+func TestLoad_DotEnv(t *testing.T) {
+	path := writeFile(t, "server:\n  address: \":9000\"\n")
+	// Dot env file is read from working directory
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "configs"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, DotEnvFile), []byte(
+		"CONFIG="+path+"\nRUN_ADDRESS=:9001\nACCRUAL_SYSTEM_ADDRESS=http://accrual:8080\nSTORAGE_TYPE=memory\nLOG_LEVEL=debug\n",
+	), 0600))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	setEnv(t, "LOG_LEVEL", "warn")
+
+	e, err := Load(nil, ioutil.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, path, e.File)
+	// Config file override dot env file
+	assert.Equal(t, ":9000", e.Server.Address)
+	// Dot env file override defaults
+	assert.Equal(t, "http://accrual:8080", e.Accrual.Address)
+	assert.Equal(t, StorageTypeMemory, e.Storage.Type)
+	// Environment override dot env file
+	assert.Equal(t, "warn", e.Log.Level)
+	// Dot env file isn't copied to environment
+	_, ok := os.LookupEnv("RUN_ADDRESS")
+	assert.False(t, ok)
+}
+
+func TestLoad_Validation(t *testing.T) {
+	args := append([]string{
+		"-queue.workers", "0",
+		"-broker.type", "kafka",
+		"-queue.retry-wait", "10s",
+		"-queue.max-retry-wait", "1s",
+		"-log.level", "verbose",
+		"-checker.retry-jitter", "1.5",
+		"-withdrawal.batch", "-1",
+	}, required...)
+	_, err := Load(args, ioutil.Discard)
+
+	var vErr *ValidationError
+	require.True(t, errors.As(err, &vErr), err)
+	assert.Equal(t, []string{
+		"checker.retry_jitter: must be between 0 and 1, got 1.5",
+		`broker.type: must be one of queue, go, rabbit, got "kafka"`,
+		"queue.workers: must be greater than 0, got 0",
+		"queue.max_retry_wait: must not be less than retry_wait 10s, got 1s",
+		"withdrawal.batch: must be greater than 0, got -1",
+		`log.level: unknown level "verbose"`,
+	}, vErr.Problems)
+
+	// Dependent values are required
+	_, err = Load([]string{"-a", ":8080", "-r", "http://localhost:8081", "-broker.type", "rabbit"}, ioutil.Discard)
+	require.True(t, errors.As(err, &vErr), err)
+	assert.Contains(t, vErr.Problems, "storage.database_uri: must be defined for pg storage")
+	assert.Contains(t, vErr.Problems, "broker.host: must be defined for rabbit broker")
+}
+
+func TestLoad_Errors(t *testing.T) {
+	// Typo in config file isn't ignored
+	path := writeFile(t, "queue:\n  worker: 3\n")
+	_, err := Load(append([]string{"-config", path}, required...), ioutil.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field worker not found")
+
+	setEnv(t, "QUEUE_POLL_INTERVAL", "often")
+	_, err = Load(required, ioutil.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "QUEUE_POLL_INTERVAL")
+
+	_, err = Load(append([]string{"-outbox.batch", "many"}, required...), ioutil.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-outbox.batch")
+}
+
+func TestLoad_PrintConfig(t *testing.T) {
+	setEnv(t, "ADMIN_TOKEN", "admin-secret")
+	out := &bytes.Buffer{}
+	e, err := Load(append([]string{"--print-config"}, required...), out)
+	require.ErrorIs(t, err, ErrPrintConfig)
+	assert.Equal(t, "admin-secret", e.Auth.AdminToken)
+
+	assert.Contains(t, out.String(), "admin_token: '******'")
+	assert.NotContains(t, out.String(), "admin-secret")
+	assert.Contains(t, out.String(), "shutdown_timeout: 30s")
+
+	// Printed config can be loaded back
+	path := writeFile(t, out.String())
+	printed, err := Load([]string{"-config", path}, ioutil.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, e.Queue, printed.Queue)
+}
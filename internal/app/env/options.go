@@ -0,0 +1,187 @@
+package env
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// masked value of secret in printed config
+const masked = "******"
+
+// durationType type of duration fields
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// option leaf field of configuration
+type option struct {
+	// path of field in config file, e.g. queue.poll_interval
+	path string
+	// env name of environment variable
+	env string
+	// alias short flag name
+	alias  string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// options return leaf fields of config sections
+func options(e *Env) []*option {
+	return collect(reflect.ValueOf(e).Elem(), "")
+}
+
+// collect walk struct fields recursively
+func collect(v reflect.Value, prefix string) []*option {
+	var opts []*option
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("yaml")
+		if name == "" || name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if field.Type.Kind() == reflect.Struct {
+			opts = append(opts, collect(v.Field(i), name)...)
+			continue
+		}
+		opts = append(opts, &option{
+			path:   name,
+			env:    field.Tag.Get("env"),
+			alias:  field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+
+	return opts
+}
+
+// flagName name of long flag, e.g. queue.poll-interval
+func (o *option) flagName() string {
+	return strings.ReplaceAll(o.path, "_", "-")
+}
+
+// parse convert raw value to type of field
+func (o *option) parse(raw string) (reflect.Value, error) {
+	v := reflect.New(o.value.Type()).Elem()
+	switch {
+	case o.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+	case o.value.Kind() == reflect.String:
+		v.SetString(raw)
+	case o.value.Kind() == reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(i))
+	case o.value.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	case o.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	default:
+		return v, fmt.Errorf("unsupported type %s", o.value.Type())
+	}
+
+	return v, nil
+}
+
+// fromVars set value from variable if it's defined, source is name of variables in error
+func (o *option) fromVars(lookup func(string) (string, bool), source string) error {
+	if o.env == "" {
+		return nil
+	}
+	raw, ok := lookup(o.env)
+	if !ok || raw == "" {
+		return nil
+	}
+	v, err := o.parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", source, o.env, err)
+	}
+	o.value.Set(v)
+
+	return nil
+}
+
+// mask hide value of secret
+func (o *option) mask() {
+	if o.secret && o.value.Kind() == reflect.String && o.value.String() != "" {
+		o.value.SetString(masked)
+	}
+}
+
+// flagValue flag of option, value is applied after environment variables
+type flagValue struct {
+	opt    *option
+	parsed reflect.Value
+	set    bool
+}
+
+// String implement flag value
+func (f *flagValue) String() string {
+	if f == nil || f.opt == nil {
+		return ""
+	}
+	if f.opt.secret {
+		return ""
+	}
+
+	return fmt.Sprint(f.opt.value.Interface())
+}
+
+// Set implement flag value, wrong value is reported by flag set
+func (f *flagValue) Set(raw string) error {
+	v, err := f.opt.parse(raw)
+	if err != nil {
+		return err
+	}
+	f.parsed = v
+	f.set = true
+
+	return nil
+}
+
+// apply set parsed flag to config
+func (f *flagValue) apply() {
+	if f.set {
+		f.opt.value.Set(f.parsed)
+	}
+}
+
+// bind define long flags and short aliases of options
+func bind(fs *flag.FlagSet, opts []*option) []*flagValue {
+	flags := make([]*flagValue, 0, len(opts))
+	for _, opt := range opts {
+		f := &flagValue{opt: opt}
+		usage := opt.usage
+		if opt.env != "" {
+			usage += " (env " + opt.env + ")"
+		}
+		fs.Var(f, opt.flagName(), usage)
+		if opt.alias != "" {
+			fs.Var(f, opt.alias, "alias of -"+opt.flagName())
+		}
+		flags = append(flags, f)
+	}
+
+	return flags
+}
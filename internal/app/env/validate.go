@@ -0,0 +1,170 @@
+package env
+
+import (
+	"fmt"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap/zapcore"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ValidationError list of invalid values of config
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implement error interface
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// validator collect problems of config
+type validator struct {
+	problems []string
+}
+
+// check add problem of field if condition is false
+func (v *validator) check(ok bool, path, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// positive check that count is greater than zero
+func (v *validator) positive(path string, n int) {
+	v.check(n > 0, path, "must be greater than 0, got %d", n)
+}
+
+// duration check that duration is greater than zero
+func (v *validator) duration(path string, d time.Duration) {
+	v.check(d > 0, path, "must be greater than 0, got %s", d)
+}
+
+// wait check pair of base and max pause
+func (v *validator) wait(path string, base, max time.Duration) {
+	v.duration(path+".retry_wait", base)
+	v.check(max >= base, path+".max_retry_wait", "must not be less than retry_wait %s, got %s", base, max)
+}
+
+// jitter check random part of retry pause
+func (v *validator) jitter(path string, j float64) {
+	v.check(j >= 0 && j <= 1, path+".retry_jitter", "must be between 0 and 1, got %g", j)
+}
+
+// oneOf check that value is allowed
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// address check url with http scheme and host
+func (v *validator) address(path, value string) {
+	u, err := url.Parse(value)
+	v.check(
+		err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		path,
+		"must be http(s) url with host, got %q",
+		value,
+	)
+}
+
+// Validate check all values and return all problems at once
+func (e *Env) Validate() error {
+	v := &validator{}
+
+	v.check(e.Server.Address != "", "server.address", "must be defined")
+	v.duration("server.shutdown_timeout", e.Server.ShutdownTimeout)
+	v.check(e.Server.DrainDelay >= 0, "server.drain_delay", "must not be negative, got %s", e.Server.DrainDelay)
+
+	v.oneOf("storage.type", e.Storage.Type, StorageTypePg, StorageTypeMemory)
+	if e.Storage.Type == StorageTypePg {
+		v.check(e.Storage.DatabaseDsn != "", "storage.database_uri", "must be defined for pg storage")
+	}
+	v.check(
+		e.Storage.PasswordHashCost >= password.MinCost && e.Storage.PasswordHashCost <= password.MaxCost,
+		"storage.password_hash_cost",
+		"must be between %d and %d, got %d",
+		password.MinCost,
+		password.MaxCost,
+		e.Storage.PasswordHashCost,
+	)
+
+	v.duration("auth.access_ttl", e.Auth.AccessTTL)
+	v.check(
+		e.Auth.RefreshTTL > e.Auth.AccessTTL,
+		"auth.refresh_ttl",
+		"must be greater than access_ttl %s, got %s",
+		e.Auth.AccessTTL,
+		e.Auth.RefreshTTL,
+	)
+	v.check(e.Auth.SessionCheck >= 0, "auth.session_check", "must not be negative, got %s", e.Auth.SessionCheck)
+
+	v.address("accrual.address", e.Accrual.Address)
+	v.check(e.Accrual.RateLimit >= 0, "accrual.rate_limit", "must not be negative, got %g", e.Accrual.RateLimit)
+	v.duration("accrual.timeout", e.Accrual.Timeout)
+	v.check(e.Accrual.Retries >= 0, "accrual.retries", "must not be negative, got %d", e.Accrual.Retries)
+	v.duration("accrual.retry_wait", e.Accrual.RetryWait)
+	v.positive("accrual.breaker_threshold", e.Accrual.BreakerThreshold)
+	v.duration("accrual.breaker_cooldown", e.Accrual.BreakerCooldown)
+	v.positive("accrual.max_conns", e.Accrual.MaxConns)
+
+	v.duration("checker.interval", e.Checker.Interval)
+	v.positive("checker.batch", e.Checker.Batch)
+	v.positive("checker.max_attempts", e.Checker.MaxAttempts)
+	v.wait("checker", e.Checker.RetryWait, e.Checker.MaxRetryWait)
+	v.jitter("checker", e.Checker.RetryJitter)
+
+	v.oneOf("broker.type", e.Broker.Type, broker.TypeQueue, broker.TypeGO, broker.TypeRabbitMQ)
+	if e.Broker.Type == broker.TypeRabbitMQ {
+		v.check(e.Broker.Host != "", "broker.host", "must be defined for rabbit broker")
+	}
+	v.positive("broker.workers", e.Broker.Workers)
+	v.positive("broker.buffer", e.Broker.Buffer)
+	v.positive("broker.max_attempts", e.Broker.MaxAttempts)
+	v.wait("broker", e.Broker.RetryWait, e.Broker.MaxRetryWait)
+	v.jitter("broker", e.Broker.RetryJitter)
+	v.check(e.Broker.Rabbit.MaxRetries >= 0, "broker.rabbit.max_retries", "must not be negative, got %d", e.Broker.Rabbit.MaxRetries)
+	v.wait("broker.rabbit", e.Broker.Rabbit.RetryWait, e.Broker.Rabbit.MaxRetryWait)
+	v.duration("broker.rabbit.reconnect_wait", e.Broker.Rabbit.ReconnectWait)
+	v.check(
+		e.Broker.Rabbit.MaxReconnectWait >= e.Broker.Rabbit.ReconnectWait,
+		"broker.rabbit.max_reconnect_wait",
+		"must not be less than reconnect_wait %s, got %s",
+		e.Broker.Rabbit.ReconnectWait,
+		e.Broker.Rabbit.MaxReconnectWait,
+	)
+	v.duration("broker.rabbit.confirm_timeout", e.Broker.Rabbit.ConfirmTimeout)
+	v.positive("broker.rabbit.prefetch", e.Broker.Rabbit.Prefetch)
+
+	v.positive("queue.workers", e.Queue.Workers)
+	v.positive("queue.batch", e.Queue.Batch)
+	v.duration("queue.poll_interval", e.Queue.PollInterval)
+	v.duration("queue.visibility", e.Queue.Visibility)
+	v.wait("queue", e.Queue.RetryWait, e.Queue.MaxRetryWait)
+	v.positive("queue.max_attempts", e.Queue.MaxAttempts)
+	v.jitter("queue", e.Queue.RetryJitter)
+
+	v.duration("withdrawal.poll_interval", e.Withdrawal.PollInterval)
+	v.positive("withdrawal.batch", e.Withdrawal.Batch)
+	v.duration("withdrawal.stale_timeout", e.Withdrawal.StaleTimeout)
+
+	v.positive("outbox.batch", e.Outbox.Batch)
+	v.duration("outbox.poll_interval", e.Outbox.PollInterval)
+
+	v.duration("leader.interval", e.Leader.Interval)
+
+	var level zapcore.Level
+	v.check(level.UnmarshalText([]byte(e.Log.Level)) == nil, "log.level", "unknown level %q", e.Log.Level)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package admin implement handlers of admin API for operators
+// Every action of operator is written in audit log
+// @author Sergey Vrulin (aka Alex Versus)
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HeaderActor header with name of operator for audit log
+const HeaderActor = "X-Admin-Actor"
+
+// DefaultActor name of operator if header isn't defined
+const DefaultActor = "admin"
+
+// bearerPrefix prefix of token in authorization header
+const bearerPrefix = "Bearer "
+
+// ErrReasonRequired if operator don't explain change
+var ErrReasonRequired = errors.New("reason required")
+
+type Handler struct {
+	lgr   *zap.Logger
+	stg   storage.Storage
+	ses   *session.Manager
+	ckr   checker.Controller
+	token []byte
+}
+
+// New constructor
+func New(l *zap.Logger, s storage.Storage, ses *session.Manager, ckr checker.Controller, token string) *Handler {
+	return &Handler{l, s, ses, ckr, []byte(token)}
+}
+
+// Auth check admin token from authorization header
+// Admin API is closed for all requests if token is empty
+func (h Handler) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token := []byte(strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix)))
+		if len(h.token) == 0 || !strings.HasPrefix(header, bearerPrefix) || subtle.ConstantTimeCompare(token, h.token) != 1 {
+			h.lgr.Info("Admin authentication failed", zap.String("addr", r.RemoteAddr))
+			http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// audit create audit entry of request
+func audit(r *http.Request, action string, userID int) models.AuditEntry {
+	actor := strings.TrimSpace(r.Header.Get(HeaderActor))
+	if actor == "" {
+		actor = DefaultActor
+	}
+
+	return models.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		UserID:  userID,
+		Details: r.URL.RawQuery,
+	}
+}
+
+// view write audit entry of read action
+func (h Handler) view(w http.ResponseWriter, r *http.Request, action string, userID int) bool {
+	if err := h.stg.AddAudit(r.Context(), audit(r, action, userID)); err != nil {
+		h.internalError(w, err)
+		return false
+	}
+
+	return true
+}
+
+// userID get user identifier from path
+func userID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	return id, err == nil && id > 0
+}
+
+// writeJSON write response with JSON body
+func (h Handler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	if _, err = w.Write(body); err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+	}
+}
+
+// internalError log error and write internal error response
+func (h Handler) internalError(w http.ResponseWriter, err error) {
+	h.lgr.Info("Internal error", zap.Error(err))
+	http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "admin-secret"
+
+// fixture admin API with memory storage
+type fixture struct {
+	t   *testing.T
+	stg *memory.Memory
+	ses *session.Manager
+	ckr *mocks.Controller
+	rtr *mux.Router
+}
+
+func newFixture(t *testing.T, token string) *fixture {
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, 0, stg)
+	ckr := &mocks.Controller{}
+	adm := New(zap.NewNop(), stg, ses, ckr, token)
+
+	rtr := mux.NewRouter()
+	operator := rtr.PathPrefix("/api/admin").Subrouter()
+	operator.Use(adm.Auth)
+	operator.HandleFunc("/users", adm.Users).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}", adm.User).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}/orders", adm.Orders).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}/ledger", adm.Ledger).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}/block", adm.Block).Methods(http.MethodPost)
+	operator.HandleFunc("/users/{id:[0-9]+}/unblock", adm.Unblock).Methods(http.MethodPost)
+	operator.HandleFunc("/users/{id:[0-9]+}/adjustments", adm.Adjust).Methods(http.MethodPost)
+	operator.HandleFunc("/orders/{number:[0-9]+}/recheck", adm.Recheck).Methods(http.MethodPost)
+	operator.HandleFunc("/audit", adm.AuditLog).Methods(http.MethodGet)
+
+	return &fixture{t, stg, ses, ckr, rtr}
+}
+
+// user register user and return its identifier
+func (f *fixture) user(login string) int {
+	ctx := context.Background()
+	require.NoError(f.t, f.stg.Register(ctx, models.User{Login: login, Password: "secret"}))
+	usr, err := f.stg.UserByLogin(ctx, login)
+	require.NoError(f.t, err)
+
+	return usr.UserID
+}
+
+// do send request with admin token
+func (f *fixture) do(method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	r.Header.Set(HeaderActor, "alice")
+	w := httptest.NewRecorder()
+	f.rtr.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestHandler_Auth(t *testing.T) {
+	f := newFixture(t, testToken)
+	for name, header := range map[string]string{
+		"no token":    "",
+		"wrong token": "Bearer other",
+		"no bearer":   testToken,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+			r.Header.Set("Authorization", header)
+			w := httptest.NewRecorder()
+			f.rtr.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		})
+	}
+
+	// Admin API is disabled without token
+	disabled := newFixture(t, "")
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	disabled.rtr.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusOK, f.do(http.MethodGet, "/api/admin/users", "").Code)
+}
+
+func TestHandler_Users(t *testing.T) {
+	f := newFixture(t, testToken)
+	for i := 0; i < 3; i++ {
+		f.user("user" + strconv.Itoa(i))
+	}
+	f.user("other")
+
+	w := f.do(http.MethodGet, "/api/admin/users?login=USER&limit=2", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []userView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 2)
+	assert.Equal(t, "user2", users[0].Login)
+	assert.Equal(t, "user1", users[1].Login)
+
+	next := w.Header().Get(pagination.HeaderNext)
+	require.NotEmpty(t, next)
+	w = f.do(http.MethodGet, "/api/admin/users?login=user&limit=2&cursor="+next, "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	assert.Equal(t, "user0", users[0].Login)
+	assert.Empty(t, w.Header().Get(pagination.HeaderNext))
+
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodGet, "/api/admin/users/100", "").Code)
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodGet, "/api/admin/users/100/orders", "").Code)
+	assert.Equal(t, http.StatusBadRequest, f.do(http.MethodGet, "/api/admin/users?limit=0", "").Code)
+
+	// Views are audited
+	entries, err := f.stg.AuditLog(context.Background(), models.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.AuditUserList, entries[0].Action)
+	assert.Equal(t, "alice", entries[0].Actor)
+}
+
+func TestHandler_Adjust(t *testing.T) {
+	f := newFixture(t, testToken)
+	id := f.user("user")
+	target := "/api/admin/users/" + strconv.Itoa(id) + "/adjustments"
+
+	assert.Equal(t, http.StatusBadRequest, f.do(http.MethodPost, target, `{"amount": 10}`).Code)
+	assert.Equal(t, http.StatusBadRequest, f.do(http.MethodPost, target, `{"amount": 0, "reason": "gift"}`).Code)
+	assert.Equal(t, http.StatusConflict, f.do(http.MethodPost, target, `{"amount": -1, "reason": "fine"}`).Code)
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodPost, "/api/admin/users/100/adjustments", `{"amount": 1, "reason": "gift"}`).Code)
+
+	w := f.do(http.MethodPost, target, `{"amount": 10.5, "reason": "gift"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usr userView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usr))
+	assert.Equal(t, money.Amount(1050), usr.Current)
+
+	w = f.do(http.MethodGet, "/api/admin/users/"+strconv.Itoa(id)+"/ledger", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var ledger []models.LedgerEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ledger))
+	require.Len(t, ledger, 1)
+	assert.Equal(t, models.LedgerAdjustment, ledger[0].Type)
+
+	w = f.do(http.MethodGet, "/api/admin/audit?user_id="+strconv.Itoa(id), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.AuditLedgerView, entries[1].Action)
+	assert.Equal(t, models.AuditBalanceAdjust, entries[2].Action)
+	assert.Equal(t, "gift", entries[2].Reason)
+	assert.Equal(t, "10.50", entries[2].Details)
+}
+
+func TestHandler_Block(t *testing.T) {
+	f := newFixture(t, testToken)
+	ctx := context.Background()
+	id := f.user("user")
+	tkn, err := f.ses.Issue(ctx, id)
+	require.NoError(t, err)
+
+	w := f.do(http.MethodPost, "/api/admin/users/"+strconv.Itoa(id)+"/block", `{"reason": "fraud"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usr userView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usr))
+	assert.True(t, usr.Blocked)
+
+	// Sessions of blocked user are revoked
+	_, err = f.ses.Verify(tkn.Access)
+	assert.ErrorIs(t, err, session.ErrRevokedToken)
+	_, err = f.ses.Refresh(ctx, tkn.Refresh)
+	assert.ErrorIs(t, err, session.ErrRevokedToken)
+
+	w = f.do(http.MethodPost, "/api/admin/users/"+strconv.Itoa(id)+"/unblock", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usr))
+	assert.False(t, usr.Blocked)
+
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodPost, "/api/admin/users/100/block", "").Code)
+
+	entries, err := f.stg.AuditLog(ctx, models.AuditFilter{UserID: id})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.AuditUserUnblock, entries[0].Action)
+	assert.Equal(t, "fraud", entries[1].Reason)
+}
+
+func TestHandler_Recheck(t *testing.T) {
+	f := newFixture(t, testToken)
+	ctx := context.Background()
+	id := f.user("user")
+	require.NoError(t, f.stg.PutOrder(ctx, models.Order{UserID: id, Code: "12345678903"}))
+	require.NoError(t, f.stg.PutOrder(ctx, models.Order{UserID: id, Code: "2377225624"}))
+	require.NoError(t, f.stg.AddPoints(ctx, id, 10, 2377225624))
+	f.ckr.On("Enqueue", mock.Anything, mock.MatchedBy(func(ord models.Order) bool {
+		return ord.Code == "12345678903"
+	})).Return(nil).Once()
+
+	assert.Equal(t, http.StatusAccepted, f.do(http.MethodPost, "/api/admin/orders/12345678903/recheck", "").Code)
+	assert.Equal(t, http.StatusConflict, f.do(http.MethodPost, "/api/admin/orders/2377225624/recheck", "").Code)
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodPost, "/api/admin/orders/79927398713/recheck", "").Code)
+	f.ckr.AssertExpectations(t)
+
+	orders, err := f.stg.OrdersForCheck(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "12345678903", orders[0].Code)
+
+	entries, err := f.stg.AuditLog(ctx, models.AuditFilter{UserID: id})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, models.AuditOrderRecheck, entries[0].Action)
+	assert.Equal(t, "12345678903", entries[0].Target)
+}
@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"net/http"
+	"strconv"
+)
+
+// Orders get page of user orders with same filters as user list
+func (h Handler) Orders(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+	flt, err := pagination.OrderFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := flt.Limit
+	// One more order to know next page exists
+	flt.Limit++
+
+	if !h.view(w, r, models.AuditOrderList, id) {
+		return
+	}
+	orders, err := h.stg.Orders(r.Context(), id, flt)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	if len(orders) > limit {
+		orders = orders[:limit]
+		lastID, _ := strconv.Atoi(orders[limit-1].ID)
+		pagination.SetNext(w, lastID)
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+
+	h.writeJSON(w, http.StatusOK, orders)
+}
+
+// Withdrawals get page of user withdrawals with same filters as user list
+func (h Handler) Withdrawals(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+	flt, err := pagination.WithdrawFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := flt.Limit
+	// One more withdrawal to know next page exists
+	flt.Limit++
+
+	if !h.view(w, r, models.AuditWithdrawList, id) {
+		return
+	}
+	wds, err := h.stg.WithdrawsByUserID(r.Context(), id, flt)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	if len(wds) > limit {
+		wds = wds[:limit]
+		pagination.SetNext(w, wds[limit-1].ID)
+	}
+	if wds == nil {
+		wds = []models.Withdraw{}
+	}
+
+	h.writeJSON(w, http.StatusOK, wds)
+}
+
+// Ledger get balance history of user
+func (h Handler) Ledger(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+	if !h.view(w, r, models.AuditLedgerView, id) {
+		return
+	}
+	entries, err := h.stg.BalanceHistory(r.Context(), id)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.LedgerEntry{}
+	}
+
+	h.writeJSON(w, http.StatusOK, entries)
+}
+
+// AuditLog get page of operator actions, optionally only about one user
+func (h Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	var flt models.AuditFilter
+	var err error
+	q := r.URL.Query()
+	if flt.Page, err = pagination.Page(q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("user_id"); v != "" {
+		if flt.UserID, err = strconv.Atoi(v); err != nil || flt.UserID <= 0 {
+			http.Error(w, pagination.ErrBadQuery.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := flt.Limit
+	// One more entry to know next page exists
+	flt.Limit++
+
+	// Reading of audit log is audited too
+	if !h.view(w, r, models.AuditLogView, flt.UserID) {
+		return
+	}
+	entries, err := h.stg.AuditLog(r.Context(), flt)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		pagination.SetNext(w, int(entries[limit-1].ID))
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+
+	h.writeJSON(w, http.StatusOK, entries)
+}
+
+// user get identifier of existing user from path
+func (h Handler) user(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, ok := userID(r)
+	if !ok {
+		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	if _, err := h.stg.UserByID(r.Context(), id); err != nil {
+		h.userError(w, err)
+		return 0, false
+	}
+
+	return id, true
+}
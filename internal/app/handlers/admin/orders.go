@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// Recheck return order to check in loyalty machine
+// Processed order can't be checked again
+func (h Handler) Recheck(w http.ResponseWriter, r *http.Request) {
+	code, err := strconv.Atoi(mux.Vars(r)["number"])
+	if err != nil {
+		http.Error(w, ht.ErrInvalidOrder.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := audit(r, models.AuditOrderRecheck, 0)
+	entry.Target = strconv.Itoa(code)
+	ord, err := h.stg.ResetOrderCheck(r.Context(), code, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, storage.ErrOrderProcessed):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.internalError(w, err)
+		}
+		return
+	}
+
+	// Order is checked by repeater anyway, queue only makes it faster
+	if err := h.ckr.Enqueue(r.Context(), ord); err != nil {
+		h.lgr.Info("Enqueue order error", zap.String("order", ord.Code), zap.Error(err))
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
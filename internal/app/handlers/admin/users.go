@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"net/http"
+	"strings"
+)
+
+// userView user with balance for operator
+type userView struct {
+	ID        int          `json:"id"`
+	Login     string       `json:"login"`
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
+	Blocked   bool         `json:"blocked"`
+}
+
+// newUserView convert user to view
+func newUserView(usr models.User) userView {
+	return userView{
+		ID:        usr.UserID,
+		Login:     usr.Login,
+		Current:   usr.Points,
+		Withdrawn: usr.Withdrawn,
+		Blocked:   usr.Blocked,
+	}
+}
+
+// adjustment request of manual balance change
+type adjustment struct {
+	Amount money.Amount `json:"amount"`
+	Reason string       `json:"reason"`
+}
+
+// Users search users by part of login
+func (h Handler) Users(w http.ResponseWriter, r *http.Request) {
+	var flt models.UserFilter
+	var err error
+	q := r.URL.Query()
+	if flt.Page, err = pagination.Page(q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flt.Login = strings.TrimSpace(q.Get("login"))
+	limit := flt.Limit
+	// One more user to know next page exists
+	flt.Limit++
+
+	if !h.view(w, r, models.AuditUserList, 0) {
+		return
+	}
+	users, err := h.stg.Users(r.Context(), flt)
+	if err != nil {
+		h.internalError(w, err)
+		return
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		pagination.SetNext(w, users[limit-1].UserID)
+	}
+
+	views := make([]userView, 0, len(users))
+	for _, usr := range users {
+		views = append(views, newUserView(usr))
+	}
+	h.writeJSON(w, http.StatusOK, views)
+}
+
+// User get user with balance
+func (h Handler) User(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(r)
+	if !ok {
+		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	usr, err := h.stg.UserByID(r.Context(), id)
+	if err != nil {
+		h.userError(w, err)
+		return
+	}
+	if !h.view(w, r, models.AuditUserView, id) {
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, newUserView(usr))
+}
+
+// Block forbid login of user and revoke user sessions
+func (h Handler) Block(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, true)
+}
+
+// Unblock allow login of user
+func (h Handler) Unblock(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, false)
+}
+
+// setBlocked change block of user
+func (h Handler) setBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	id, ok := userID(r)
+	if !ok {
+		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	// Reason is optional for block
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.Body != http.NoBody && r.ContentLength != 0 {
+		if err := ht.ParseJSONReq(r, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	action := models.AuditUserUnblock
+	if blocked {
+		action = models.AuditUserBlock
+	}
+	entry := audit(r, action, id)
+	entry.Reason = req.Reason
+	if err := h.stg.BlockUser(r.Context(), id, blocked, entry); err != nil {
+		h.userError(w, err)
+		return
+	}
+	if blocked {
+		// Tokens are rejected at once in this instance, other instances see revoked sessions on next check
+		h.ses.RevokeUser(id)
+	}
+
+	h.writeUser(w, r, id)
+}
+
+// Adjust change user balance manually
+func (h Handler) Adjust(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(r)
+	if !ok {
+		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	var req adjustment
+	if err := ht.ParseJSONReq(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, ErrReasonRequired.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Amount == 0 {
+		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := audit(r, models.AuditBalanceAdjust, id)
+	entry.Reason = req.Reason
+	entry.Details = req.Amount.String()
+	if err := h.stg.AdjustBalance(r.Context(), id, req.Amount, entry); err != nil {
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		h.userError(w, err)
+		return
+	}
+
+	h.writeUser(w, r, id)
+}
+
+// writeUser write actual state of user after change
+func (h Handler) writeUser(w http.ResponseWriter, r *http.Request, id int) {
+	usr, err := h.stg.UserByID(r.Context(), id)
+	if err != nil {
+		h.userError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, newUserView(usr))
+}
+
+// userError write not found or internal error response
+func (h Handler) userError(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.internalError(w, err)
+}
@@ -5,6 +5,7 @@ package auth
 import (
 	"errors"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"go.uber.org/zap"
@@ -14,14 +15,18 @@ import (
 // ErrAuthIncorrect incorrect user or pass
 var ErrAuthIncorrect = errors.New("auth incorrect")
 
+// ErrUserBlocked user is blocked by operator
+var ErrUserBlocked = errors.New("user blocked")
+
 type Handler struct {
-	l *zap.Logger
-	s storage.Storage
+	l   *zap.Logger
+	s   storage.Storage
+	ses *session.Manager
 }
 
 // New constructor
-func New(l *zap.Logger, s storage.Storage) *Handler {
-	return &Handler{l, s}
+func New(l *zap.Logger, s storage.Storage, ses *session.Manager) *Handler {
+	return &Handler{l, s, ses}
 }
 
 // HasAuth user
@@ -48,14 +53,25 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, ErrAuthIncorrect.Error(), http.StatusUnauthorized)
 		return
 	}
-	// HasAuth user
-	token := ht.AuthUser(w)
-	err = h.s.SetToken(r.Context(), *usr, token)
+	// New session for user
+	current, err := h.s.UserByLogin(r.Context(), usr.Login)
+	if err != nil {
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		h.l.Info("Internal error", zap.Error(err))
+		return
+	}
+	if current.Blocked {
+		http.Error(w, ErrUserBlocked.Error(), http.StatusForbidden)
+		return
+	}
+	tkn, err := h.ses.Issue(r.Context(), current.UserID)
 	if err != nil {
 		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
 		h.l.Info("Internal error", zap.Error(err))
 		return
 	}
+	tkn.SetCookies(w)
+	tkn.SetHeader(w)
 
 	w.WriteHeader(http.StatusOK)
 }
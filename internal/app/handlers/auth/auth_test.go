@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/registration"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pg/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/logger"
 	"go.uber.org/zap"
@@ -16,6 +17,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
@@ -41,9 +43,10 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		log.Fatal(err)
 	}
 	stg := &mocks.MockStorage{}
-	hdlr := Handler{lgr, stg}
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, 0, stg)
+	hdlr := Handler{lgr, stg, ses}
 
-	regHndlr := registration.New(lgr, stg)
+	regHndlr := registration.New(lgr, stg, ses)
 
 	tests := []struct {
 		name    string
@@ -168,8 +171,9 @@ func TestHandler_ServeHTTP(t *testing.T) {
 
 func TestNew(t *testing.T) {
 	type args struct {
-		l *zap.Logger
-		s storage.Storage
+		l   *zap.Logger
+		s   storage.Storage
+		ses *session.Manager
 	}
 
 	lgr, err := logger.New()
@@ -177,7 +181,8 @@ func TestNew(t *testing.T) {
 		log.Fatal(err)
 	}
 	stg := &mocks.MockStorage{}
-	flds := args{lgr, stg}
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, 0, stg)
+	flds := args{lgr, stg, ses}
 
 	tests := []struct {
 		name string
@@ -187,12 +192,12 @@ func TestNew(t *testing.T) {
 		{
 			name: "New check",
 			args: flds,
-			want: &Handler{lgr, stg},
+			want: &Handler{lgr, stg, ses},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := New(tt.args.l, tt.args.s); !reflect.DeepEqual(got, tt.want) {
+			if got := New(tt.args.l, tt.args.s, tt.args.ses); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -4,9 +4,10 @@ package balance
 
 import (
 	"encoding/json"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -22,19 +23,22 @@ func New(l *zap.Logger, s storage.Storage) *Handler {
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var currentUser models.User
-	if token, err := r.Cookie(ht.CookieUserIDName); err == nil {
-		currentUser, _ = h.s.UserByToken(r.Context(), token.Value)
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
 	}
 
-	if currentUser.UserID == 0 {
-		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+	currentUser, err := h.s.UserByID(r.Context(), currentUser.UserID)
+	if err != nil {
+		h.l.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	var response struct {
-		Current   float64 `json:"current"`
-		Withdrawn float64 `json:"withdrawn"`
+		Current   money.Amount `json:"current"`
+		Withdrawn money.Amount `json:"withdrawn"`
 	}
 	response.Withdrawn = currentUser.Withdrawn
 	response.Current = currentUser.Points
@@ -4,7 +4,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
 	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/middlewares/conveyor"
@@ -76,6 +78,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			},
 		},
 	}
+	ses, token := sessiontest.Token(t, 1)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var r io.Reader
@@ -91,17 +95,17 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			if tt.server.withAuth {
 				cookie := &http.Cookie{
 					Name:  ht.CookieUserIDName,
-					Value: "test",
+					Value: token,
 					Path:  "/",
 				}
 				req.AddCookie(cookie)
 
 				storage.
-					On("UserByToken", mock.Anything, mock.Anything).Return(
+					On("UserByID", mock.Anything, 1).Return(
 					models.User{
 						UserID:    1,
-						Withdrawn: 100,
-						Points:    100,
+						Withdrawn: 10000,
+						Points:    10000,
 					}, nil)
 			}
 
@@ -111,6 +115,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			w := httptest.NewRecorder()
 			// Init handler
 			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
 			rtr.Handle(tt.server.path, handler)
 
 			h := conveyor.Conveyor(
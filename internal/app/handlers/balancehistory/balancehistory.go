@@ -0,0 +1,58 @@
+// Package balancehistory return ledger of current user balance changes
+package balancehistory
+
+import (
+	"encoding/json"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type Handler struct {
+	lgr *zap.Logger
+	stg storage.Storage
+}
+
+// New constructor
+func New(l *zap.Logger, s storage.Storage) *Handler {
+	return &Handler{l, s}
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := h.stg.BalanceHistory(r.Context(), currentUser.UserID)
+	if err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := json.Marshal(entries)
+	if err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(body)
+	if err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+}
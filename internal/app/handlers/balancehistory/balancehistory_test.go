@@ -0,0 +1,175 @@
+package balancehistory
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	mod "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
+	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	type want struct {
+		code        int
+		response    string
+		contentType string
+	}
+
+	type request struct {
+		method string
+		target string
+		body   string
+		path   string
+		test   int
+	}
+
+	type server struct {
+		path     string
+		withAuth bool
+	}
+
+	tests := []struct {
+		name    string
+		want    want
+		request request
+		server  server
+	}{
+		{
+			name: "Check balance history",
+			request: request{
+				method: http.MethodGet,
+				target: "/api/user/balance/history",
+				body:   "",
+				test:   0,
+			},
+			want: want{
+				code:        http.StatusUnauthorized,
+				contentType: "",
+			},
+			server: server{
+				path:     "/api/user/balance/history",
+				withAuth: false,
+			},
+		},
+		{
+			name: "Check balance history",
+			request: request{
+				method: http.MethodGet,
+				target: "/api/user/balance/history",
+				body:   "",
+				test:   0,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json; charset=utf-8",
+			},
+			server: server{
+				path:     "/api/user/balance/history",
+				withAuth: true,
+			},
+		},
+		{
+			name: "Check balance history",
+			request: request{
+				method: http.MethodGet,
+				target: "/api/user/balance/history",
+				body:   "",
+				test:   2,
+			},
+			want: want{
+				code:        http.StatusNoContent,
+				contentType: "",
+			},
+			server: server{
+				path:     "/api/user/balance/history",
+				withAuth: true,
+			},
+		},
+	}
+	ses, token := sessiontest.Token(t, 123)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var r io.Reader
+			if len(tt.request.body) > 0 {
+				r = strings.NewReader(tt.request.body)
+			} else {
+				r = nil
+			}
+
+			storage := mocks2.Storage{}
+			req := httptest.NewRequest(tt.request.method, tt.request.target, r)
+
+			if tt.server.withAuth {
+				cookie := &http.Cookie{
+					Name:  ht.CookieUserIDName,
+					Value: token,
+					Path:  "/",
+				}
+				req.AddCookie(cookie)
+
+				var entries []mod.LedgerEntry
+				entry := mod.LedgerEntry{Type: mod.LedgerAccrual, Amount: 500, OrderID: "12345674"}
+				entries = append(entries, entry)
+
+				var nullEntries []mod.LedgerEntry
+
+				storage.
+					On("BalanceHistory", mock.Anything, mock.MatchedBy(func(userID int) bool {
+						return tt.request.test == 0
+					})).Return(entries, nil).
+					On("BalanceHistory", mock.Anything, mock.MatchedBy(func(userID int) bool {
+						return tt.request.test == 2
+					})).Return(nullEntries, nil)
+			}
+
+			handler := New(zap.NewNop(), &storage)
+
+			// Create new recorder
+			w := httptest.NewRecorder()
+			// Init handler
+			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
+			rtr.Handle(tt.server.path, handler)
+
+			// Create server
+			rtr.ServeHTTP(w, req)
+			res := w.Result()
+
+			// Check code
+			assert.Equal(t, tt.want.code, res.StatusCode, "code incorrect")
+
+			// check body
+			defer res.Body.Close()
+			resBody, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			readLine := strings.TrimSuffix(string(resBody), "\n")
+			// equal response
+			if tt.want.response != "" {
+				assert.Equal(t, tt.want.response, readLine)
+
+			}
+
+			if tt.want.code > 0 {
+				assert.Equal(t, tt.want.code, res.StatusCode)
+			}
+
+			if tt.want.contentType != "" {
+				assert.Equal(t, tt.want.contentType, res.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
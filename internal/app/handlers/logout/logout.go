@@ -0,0 +1,38 @@
+// Package logout implement handler for revoke current user session
+package logout
+
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type Handler struct {
+	lgr *zap.Logger
+	ses *session.Manager
+}
+
+// New constructor
+func New(l *zap.Logger, ses *session.Manager) *Handler {
+	return &Handler{l, ses}
+}
+
+// Revoke session of current token
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, ok := authenticator.Claims(r.Context())
+	if !ok {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.ses.Revoke(r.Context(), claims); err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.ClearCookies(w)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,62 @@
+package logout
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/logger"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	lgr, err := logger.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, 0, memory.New(lgr, password.New(password.MinCost)))
+	tkn, err := ses.Issue(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		code   int
+	}{
+		{name: "Check logout #1", code: http.StatusUnauthorized},
+		{name: "Check logout #2", cookie: tkn.Access, code: http.StatusOK},
+		// Token of revoked session not accepted
+		{name: "Check logout #3", cookie: tkn.Access, code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ht.CookieUserIDName, Value: tt.cookie, Path: "/"})
+			}
+
+			w := httptest.NewRecorder()
+			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(lgr, ses).Auth)
+			rtr.Handle("/api/user/logout", New(lgr, ses))
+			rtr.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.code, res.StatusCode)
+		})
+	}
+
+	_, err = ses.Refresh(context.Background(), tkn.Refresh)
+	assert.ErrorIs(t, err, session.ErrRevokedToken)
+}
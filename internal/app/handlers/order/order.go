@@ -3,11 +3,8 @@ package order
 import (
 	"database/sql"
 	"errors"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pg"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"go.uber.org/zap"
 	"net/http"
@@ -17,23 +14,17 @@ import (
 type Handler struct {
 	lgr *zap.Logger
 	stg storage.Storage
-	pub broker.Publisher
-	ckr checker.Controller
 }
 
 // New constructor
-func New(lgr *zap.Logger, stg storage.Storage, pub broker.Publisher, ckr checker.Controller) *Handler {
-	return &Handler{lgr, stg, pub, ckr}
+func New(lgr *zap.Logger, stg storage.Storage) *Handler {
+	return &Handler{lgr, stg}
 }
 
 // Register order
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var currentUser models.User
-	if token, err := r.Cookie(ht.CookieUserIDName); err == nil {
-		currentUser, _ = h.stg.UserByToken(r.Context(), token.Value)
-	}
-
-	if currentUser.UserID == 0 {
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
 		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
 		return
 	}
@@ -68,10 +59,10 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	order.UserID = currentUser.UserID
 	order.Code = strconv.Itoa(orderCode)
 
-	// Create order
+	// Create order, event for check is written with it
 	if err := h.stg.PutOrder(r.Context(), order); err != nil {
 		// If someone already added code
-		if errors.Is(err, pg.ErrOrderAlreadyExist) {
+		if errors.Is(err, storage.ErrOrderAlreadyExist) {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
@@ -80,15 +71,5 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task := h.ckr.PrepareTask(order)
-
-	err = h.pub.Publish(task)
-
-	if err != nil {
-		h.lgr.Info("Error handler", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -1,15 +1,14 @@
 package order
 
 import (
-	"context"
 	"database/sql"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
-	mocks4 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
 	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
-	checker2 "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker/mocks"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/middlewares/conveyor"
 	"go.uber.org/zap"
@@ -41,10 +40,6 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		withAuth bool
 	}
 
-	broker := &mocks4.Publisher{}
-
-	broker.On("Publish", mock.Anything).Return(nil)
-
 	tests := []struct {
 		name    string
 		want    want
@@ -135,6 +130,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			},
 		},
 	}
+	ses, token := sessiontest.Token(t, 1)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var r io.Reader
@@ -146,23 +143,16 @@ func TestHandler_ServeHTTP(t *testing.T) {
 
 			storage := mocks2.Storage{}
 			req := httptest.NewRequest(tt.request.method, tt.request.target, r)
-			checker := checker2.Controller{}
 
 			if tt.server.withAuth {
 				cookie := &http.Cookie{
 					Name:  ht.CookieUserIDName,
-					Value: "test",
+					Value: token,
 					Path:  "/",
 				}
 				req.AddCookie(cookie)
 
 				storage.
-					On("UserByToken", mock.Anything, mock.Anything).Return(
-					models.User{
-						UserID:    1,
-						Withdrawn: 100,
-						Points:    100,
-					}, nil).
 					On("OrderByCode", mock.Anything, mock.MatchedBy(func(code int) bool {
 						return code == 12345674 && tt.request.test == 0
 					})).Return(models.Order{
@@ -184,23 +174,18 @@ func TestHandler_ServeHTTP(t *testing.T) {
 					On("PutOrder", mock.Anything, mock.MatchedBy(func(ord models.Order) bool {
 						return ord.Code == "12345674"
 					})).Return(nil)
-
-				checker.
-					On("PrepareTask", mock.Anything).Return(func(ctx context.Context) error { return nil })
-
 			}
 
 			handler := Handler{
 				lgr: zap.NewNop(),
 				stg: &storage,
-				pub: broker,
-				ckr: &checker,
 			}
 
 			// Create new recorder
 			w := httptest.NewRecorder()
 			// Init handler
 			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
 			rtr.Handle(tt.server.path, handler)
 
 			h := conveyor.Conveyor(
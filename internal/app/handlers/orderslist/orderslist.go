@@ -2,11 +2,13 @@ package orderslist
 
 import (
 	"encoding/json"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 )
 
 type Handler struct {
@@ -20,17 +22,22 @@ func New(l *zap.Logger, s storage.Storage) *Handler {
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var currentUser models.User
-	if token, err := r.Cookie(ht.CookieUserIDName); err == nil {
-		currentUser, _ = h.stg.UserByToken(r.Context(), token.Value)
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
 	}
 
-	if currentUser.UserID == 0 {
-		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+	flt, err := pagination.OrderFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	limit := flt.Limit
+	// One more order to know next page exists
+	flt.Limit++
 
-	orders, err := h.stg.Orders(r.Context(), currentUser.UserID)
+	orders, err := h.stg.Orders(r.Context(), currentUser.UserID, flt)
 	if err != nil {
 		h.lgr.Info("Internal error", zap.Error(err))
 		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
@@ -40,6 +47,12 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if len(orders) > limit {
+		orders = orders[:limit]
+		lastID, _ := strconv.Atoi(orders[limit-1].ID)
+		pagination.SetNext(w, lastID)
+	}
+
 	body, err := json.Marshal(orders)
 	if err != nil {
 		h.lgr.Info("Internal error", zap.Error(err))
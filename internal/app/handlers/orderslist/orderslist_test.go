@@ -1,18 +1,28 @@
 package orderslist
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	mods "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
 	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -97,6 +107,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			},
 		},
 	}
+	ses, token := sessiontest.Token(t, 123)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var r io.Reader
@@ -112,7 +124,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			if tt.server.withAuth {
 				cookie := &http.Cookie{
 					Name:  ht.CookieUserIDName,
-					Value: "test",
+					Value: token,
 					Path:  "/",
 				}
 				req.AddCookie(cookie)
@@ -127,17 +139,12 @@ func TestHandler_ServeHTTP(t *testing.T) {
 				orders = append(orders, userOrder)
 
 				storage.
-					On("UserByToken", mock.Anything, mock.Anything).Return(
-					mods.User{
-						Login:  "test",
-						UserID: 123,
-					}, nil).
 					On("Orders", mock.Anything, mock.MatchedBy(func(userID int) bool {
 						return tt.request.test == 1
-					})).Return([]mods.Order{}, nil).
+					}), mock.Anything).Return([]mods.Order{}, nil).
 					On("Orders", mock.Anything, mock.MatchedBy(func(userID int) bool {
 						return userID == 123 && tt.request.test == 2
-					})).Return(orders, nil)
+					}), mock.Anything).Return(orders, nil)
 			}
 
 			handler := New(zap.NewNop(), &storage)
@@ -146,6 +153,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			w := httptest.NewRecorder()
 			// Init handler
 			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
 			rtr.Handle(tt.server.path, handler)
 
 			// Create server
@@ -178,3 +186,50 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_Page(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	for _, code := range []int{12345674, 79927398713, 4561261212345467} {
+		require.NoError(t, stg.PutOrder(ctx, mods.Order{UserID: 1, Code: strconv.Itoa(code)}))
+	}
+	require.NoError(t, stg.SetStatus(ctx, 79927398713, mods.INVALID, 0, 0))
+	handler := New(zap.NewNop(), stg)
+
+	list := func(query string) (*httptest.ResponseRecorder, []mods.Order) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/orders?"+query, nil)
+		req = req.WithContext(authenticator.WithUser(req.Context(), session.Claims{UserID: 1}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var orders []mods.Order
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &orders))
+		}
+		return w, orders
+	}
+
+	// Last orders first, cursor point to next page
+	w, orders := list("limit=2")
+	require.Len(t, orders, 2)
+	assert.Equal(t, "4561261212345467", orders[0].Code)
+	assert.Equal(t, "79927398713", orders[1].Code)
+	cursor := w.Header().Get(pagination.HeaderNext)
+	require.NotEmpty(t, cursor)
+
+	w, orders = list("limit=2&cursor=" + cursor)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "12345674", orders[0].Code)
+	assert.Empty(t, w.Header().Get(pagination.HeaderNext))
+
+	// Filter by status and upload time
+	_, orders = list("status=INVALID")
+	require.Len(t, orders, 1)
+	assert.Equal(t, "79927398713", orders[0].Code)
+	w, _ = list("from=" + time.Now().Add(time.Hour).Format(time.RFC3339))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w, _ = list("status=UNKNOWN")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = list("cursor=bad")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,47 @@
+// Package refresh implement handler for prolong user session by refresh token
+package refresh
+
+import (
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type Handler struct {
+	lgr *zap.Logger
+	ses *session.Manager
+}
+
+// New constructor
+func New(l *zap.Logger, ses *session.Manager) *Handler {
+	return &Handler{l, ses}
+}
+
+// Issue new access token by refresh token
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, err := r.Cookie(ht.CookieRefreshName)
+	if err != nil {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tkn, err := h.ses.Refresh(r.Context(), token.Value)
+	if err != nil {
+		if errors.Is(err, session.ErrInvalidToken) ||
+			errors.Is(err, session.ErrExpiredToken) ||
+			errors.Is(err, session.ErrRevokedToken) {
+			session.ClearCookies(w)
+			http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+	tkn.SetCookies(w)
+	tkn.SetHeader(w)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,59 @@
+package refresh
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/logger"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	lgr, err := logger.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, 0, memory.New(lgr, password.New(password.MinCost)))
+	tkn, err := ses.Issue(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		code   int
+	}{
+		{name: "Check refresh #1", code: http.StatusUnauthorized},
+		{name: "Check refresh #2", cookie: tkn.Access, code: http.StatusUnauthorized},
+		{name: "Check refresh #3", cookie: tkn.Refresh, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/refresh", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ht.CookieRefreshName, Value: tt.cookie, Path: "/"})
+			}
+
+			w := httptest.NewRecorder()
+			rtr := mux.NewRouter()
+			rtr.Handle("/api/user/refresh", New(lgr, ses))
+			rtr.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == http.StatusOK {
+				assert.Len(t, res.Cookies(), 2)
+			}
+		})
+	}
+}
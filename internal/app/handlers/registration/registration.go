@@ -4,21 +4,23 @@ package registration
 import (
 	"errors"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pg"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
 	"go.uber.org/zap"
 	"net/http"
 )
 
 type Handler struct {
-	l *zap.Logger
-	s storage.Storage
+	l   *zap.Logger
+	s   storage.Storage
+	ses *session.Manager
 }
 
 // New constructor
-func New(l *zap.Logger, s storage.Storage) *Handler {
-	return &Handler{l, s}
+func New(l *zap.Logger, s storage.Storage, ses *session.Manager) *Handler {
+	return &Handler{l, s, ses}
 }
 
 // Register new user
@@ -29,13 +31,13 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Validate
-	if len(usr.Login) == 0 || len(usr.Password) == 0 {
+	if len(usr.Login) == 0 || len(usr.Password) == 0 || len(usr.Password) > password.MaxLength {
 		http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
 		return
 	}
 	// Register new user
 	if err := h.s.Register(r.Context(), *usr); err != nil {
-		if errors.Is(err, pg.ErrLoginAlreadyExist) {
+		if errors.Is(err, storage.ErrLoginAlreadyExist) {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
@@ -43,13 +45,21 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.l.Info("Internal error", zap.Error(err))
 		return
 	}
-	// HasAuth user
-	token := ht.AuthUser(w)
-	if err := h.s.SetToken(r.Context(), *usr, token); err != nil {
+	// New session for user
+	current, err := h.s.UserByLogin(r.Context(), usr.Login)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		h.l.Info("Internal error", zap.Error(err))
 		return
 	}
+	tkn, err := h.ses.Issue(r.Context(), current.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.l.Info("Internal error", zap.Error(err))
+		return
+	}
+	tkn.SetCookies(w)
+	tkn.SetHeader(w)
 
 	w.WriteHeader(http.StatusOK)
 }
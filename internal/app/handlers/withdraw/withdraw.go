@@ -4,13 +4,15 @@ package withdraw
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 )
 
 type Handler struct {
@@ -25,17 +27,13 @@ func New(l *zap.Logger, s storage.Storage) *Handler {
 
 // request on withdraw
 type request struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string       `json:"order"`
+	Sum   money.Amount `json:"sum"`
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var currentUser models.User
-	if token, err := r.Cookie(ht.CookieUserIDName); err == nil {
-		currentUser, _ = h.stg.UserByToken(r.Context(), token.Value)
-	}
-
-	if currentUser.UserID == 0 {
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
 		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
 		return
 	}
@@ -59,16 +57,15 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = strconv.Atoi(req.Order)
-	if err != nil {
-		h.lgr.Error("Can't convert orderID")
-		http.Error(w, "", http.StatusUnprocessableEntity)
+	if !ht.IsValidOrderNumber(req.Order) {
+		h.lgr.Error("Invalid order number", zap.String("order", req.Order))
+		http.Error(w, ht.ErrInvalidOrder.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Has no points for withdraw in order
-	if currentUser.Points < req.Sum {
-		http.Error(w, "", http.StatusPaymentRequired)
+	if req.Sum <= 0 {
+		h.lgr.Error("Incorrect sum for withdraw")
+		http.Error(w, "", http.StatusUnprocessableEntity)
 		return
 	}
 
@@ -81,13 +78,22 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.lgr.Info("Add to withdraw", zap.Reflect("order", order), zap.Reflect("request", req))
 	if err := h.stg.AddWithdraw(r.Context(), order, req.Sum); err != nil {
+		// Has no points for withdraw
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			http.Error(w, "", http.StatusPaymentRequired)
+			return
+		}
+		// Order is already paid
+		if errors.Is(err, storage.ErrWithdrawAlreadyExist) {
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
 		h.lgr.Error("Don't add withdraw", zap.Error(err))
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
 
-	// here run some logic for withdraw
-	// no implement
+	// Withdrawal is paid asynchronously by withdrawal.Run
 
 	w.WriteHeader(http.StatusOK)
 }
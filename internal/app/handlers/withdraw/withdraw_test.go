@@ -5,7 +5,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"go.uber.org/zap"
@@ -95,7 +98,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			request: request{
 				method: http.MethodPost,
 				target: "/api/user/balance/withdraw",
-				body:   "{\"order\": \"3\",\"sum\": 6\n}",
+				body:   "{\"order\": \"2377225624\",\"sum\": 6\n}",
 			},
 			want: want{
 				code:        http.StatusPaymentRequired,
@@ -106,7 +109,41 @@ func TestHandler_ServeHTTP(t *testing.T) {
 				withAuth: true,
 			},
 		},
+		{
+			name: "Check withdraw luhn",
+			request: request{
+				method: http.MethodPost,
+				target: "/api/user/balance/withdraw",
+				body:   "{\"order\": \"2377225625\",\"sum\": 6\n}",
+			},
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "",
+			},
+			server: server{
+				path:     "/api/user/balance/withdraw",
+				withAuth: true,
+			},
+		},
+		{
+			name: "Check withdraw paid order",
+			request: request{
+				method: http.MethodPost,
+				target: "/api/user/balance/withdraw",
+				body:   "{\"order\": \"79927398713\",\"sum\": 6\n}",
+			},
+			want: want{
+				code:        http.StatusConflict,
+				contentType: "",
+			},
+			server: server{
+				path:     "/api/user/balance/withdraw",
+				withAuth: true,
+			},
+		},
 	}
+	ses, token := sessiontest.Token(t, 123)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var r io.Reader
@@ -116,32 +153,32 @@ func TestHandler_ServeHTTP(t *testing.T) {
 				r = nil
 			}
 
-			storage := mocks2.Storage{}
+			stg := mocks2.Storage{}
 			req := httptest.NewRequest(tt.request.method, tt.request.target, r)
 
 			if tt.server.withAuth {
 				cookie := &http.Cookie{
 					Name:  ht.CookieUserIDName,
-					Value: "test",
+					Value: token,
 					Path:  "/",
 				}
 				req.AddCookie(cookie)
 
-				storage.
-					On("UserByToken", mock.Anything, mock.Anything).Return(
-					models.User{
-						Login:  "test",
-						UserID: 123,
-					}, nil).
-					On("OrderByCode", mock.Anything, mock.Anything).Return(models.Order{}, errors.New("test"))
+				stg.
+					On("OrderByCode", mock.Anything, mock.Anything).Return(models.Order{}, errors.New("test")).
+					On("AddWithdraw", mock.Anything, mock.MatchedBy(func(ord models.Order) bool {
+						return ord.ID == "79927398713"
+					}), mock.Anything).Return(storage.ErrWithdrawAlreadyExist).
+					On("AddWithdraw", mock.Anything, mock.Anything, mock.Anything).Return(storage.ErrInsufficientFunds)
 			}
 
-			handler := New(zap.NewNop(), &storage)
+			handler := New(zap.NewNop(), &stg)
 
 			// Create new recorder
 			w := httptest.NewRecorder()
 			// Init handler
 			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
 			rtr.Handle(tt.server.path, handler)
 
 			// Create server
@@ -3,8 +3,8 @@ package withdrawallist
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pagination"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
 	"go.uber.org/zap"
@@ -22,30 +22,36 @@ func New(l *zap.Logger, s storage.Storage) *Handler {
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var currentUser models.User
-	if token, err := r.Cookie(ht.CookieUserIDName); err == nil {
-		currentUser, _ = h.stg.UserByToken(r.Context(), token.Value)
+	currentUser, ok := authenticator.User(r.Context())
+	if !ok {
+		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+		return
 	}
 
-	if currentUser.UserID == 0 {
-		http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+	flt, err := pagination.WithdrawFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	limit := flt.Limit
+	// One more withdrawal to know next page exists
+	flt.Limit++
 
-	wds, err := h.stg.WithdrawsByUserID(r.Context(), currentUser.UserID)
+	wds, err := h.stg.WithdrawsByUserID(r.Context(), currentUser.UserID, flt)
 	if err != nil {
 		h.lgr.Info("Internal error", zap.Error(err))
 		http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Println(len(wds))
-	fmt.Println("XXX")
-
 	if len(wds) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if len(wds) > limit {
+		wds = wds[:limit]
+		pagination.SetNext(w, wds[limit-1].ID)
+	}
 
 	body, err := json.Marshal(wds)
 	if err != nil {
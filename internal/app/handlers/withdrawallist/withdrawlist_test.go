@@ -4,9 +4,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
 	mod "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session/sessiontest"
 	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
 	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
@@ -14,9 +17,12 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
+	processedAt := time.Date(2021, 11, 22, 9, 0, 0, 0, time.Local)
+
 	type want struct {
 		code        int
 		response    string
@@ -69,6 +75,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusOK,
+				response:    `[{"order":"2377225624","sum":500,"status":"REFUNDED","processed_at":"` + processedAt.Format(time.RFC3339) + `"}]`,
 				contentType: "application/json; charset=utf-8",
 			},
 			server: server{
@@ -94,6 +101,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			},
 		},
 	}
+	ses, token := sessiontest.Token(t, 123)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
@@ -110,29 +119,31 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			if tt.server.withAuth {
 				cookie := &http.Cookie{
 					Name:  ht.CookieUserIDName,
-					Value: "test",
+					Value: token,
 					Path:  "/",
 				}
 				req.AddCookie(cookie)
 
 				var wds []mod.Withdraw
-				var wd mod.Withdraw
+				// Withdrawal is returned with its status
+				wd := mod.Withdraw{
+					ID:          1,
+					OrderID:     "2377225624",
+					Sum:         50000,
+					Status:      mod.WithdrawRefunded,
+					ProcessedAt: jsontime.JSONTime(processedAt),
+				}
 				wds = append(wds, wd)
 
 				var nullWds []mod.Withdraw
 
 				storage.
-					On("UserByToken", mock.Anything, mock.Anything).Return(
-					mod.User{
-						Login:  "test",
-						UserID: 123,
-					}, nil).
 					On("WithdrawsByUserID", mock.Anything, mock.MatchedBy(func(userID int) bool {
 						return tt.request.test == 0
-					})).Return(wds, nil).
+					}), mock.Anything).Return(wds, nil).
 					On("WithdrawsByUserID", mock.Anything, mock.MatchedBy(func(userID int) bool {
 						return tt.request.test == 2
-					})).Return(nullWds, nil)
+					}), mock.Anything).Return(nullWds, nil)
 			}
 
 			handler := New(zap.NewNop(), &storage)
@@ -141,6 +152,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			w := httptest.NewRecorder()
 			// Init handler
 			rtr := mux.NewRouter()
+			rtr.Use(authenticator.New(zap.NewNop(), ses).Auth)
 			rtr.Handle(tt.server.path, handler)
 
 			// Create server
@@ -0,0 +1,89 @@
+// Package authenticator implement middleware for authenticate user by access token
+// @author Vrulin Sergey (aka Alex Versus)
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// bearerPrefix prefix of token in authorization header
+const bearerPrefix = "Bearer "
+
+// ctxKey type of context key for authenticated user
+type ctxKey struct{}
+
+// identity authenticated user with claims of token
+type identity struct {
+	user   models.User
+	claims session.Claims
+}
+
+type Handler struct {
+	l   *zap.Logger
+	ses *session.Manager
+}
+
+// New constructor
+func New(l *zap.Logger, ses *session.Manager) *Handler {
+	return &Handler{l, ses}
+}
+
+// Auth check access token from authorization header or cookie and put user in context
+func (h Handler) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := h.ses.Authenticate(r.Context(), Token(r))
+		switch {
+		case errors.Is(err, session.ErrInvalidToken), errors.Is(err, session.ErrExpiredToken), errors.Is(err, session.ErrRevokedToken):
+			h.l.Debug("Authentication failed", zap.Error(err))
+			http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			h.l.Error("Check session error", zap.Error(err))
+			http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), claims)))
+	})
+}
+
+// Token get access token from authorization header or from cookie
+func Token(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+	}
+	if cookie, err := r.Cookie(ht.CookieUserIDName); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// WithUser put user of claims in context
+func WithUser(ctx context.Context, claims session.Claims) context.Context {
+	return context.WithValue(ctx, ctxKey{}, identity{
+		user:   models.User{UserID: claims.UserID},
+		claims: claims,
+	})
+}
+
+// User get authenticated user from context
+func User(ctx context.Context) (models.User, bool) {
+	id, ok := ctx.Value(ctxKey{}).(identity)
+
+	return id.user, ok
+}
+
+// Claims get token claims of authenticated user from context
+func Claims(ctx context.Context) (session.Claims, bool) {
+	id, ok := ctx.Value(ctxKey{}).(identity)
+
+	return id.claims, ok
+}
@@ -0,0 +1,97 @@
+package authenticator
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/middlewares/conveyor"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandler_Auth(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.AddSession(ctx, models.Session{ID: "test", UserID: 7, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, stg.AddSession(ctx, models.Session{ID: "revoked", UserID: 7, ExpiresAt: time.Now().Add(time.Hour), Revoked: true}))
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, time.Minute, stg)
+	sign := func(sessionID string) string {
+		token, err := ses.Sign(session.Claims{
+			UserID:    7,
+			SessionID: sessionID,
+			Type:      session.TypeAccess,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		})
+		require.NoError(t, err)
+		return token
+	}
+	token := sign("test")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usr, ok := User(r.Context())
+		assert.True(t, ok)
+		claims, ok := Claims(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "test", claims.SessionID)
+		_, _ = w.Write([]byte(strconv.Itoa(usr.UserID)))
+	})
+	h := conveyor.Conveyor(next, New(zap.NewNop(), ses).Auth)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		code   int
+	}{
+		{name: "Without token", code: http.StatusUnauthorized},
+		{name: "Bearer header", header: "Bearer " + token, code: http.StatusOK},
+		{name: "Cookie", cookie: token, code: http.StatusOK},
+		{name: "Header has priority", header: "Bearer " + token, cookie: "invalid", code: http.StatusOK},
+		{name: "Invalid header", header: "Bearer invalid", cookie: token, code: http.StatusUnauthorized},
+		{name: "Other scheme", header: "Basic " + token, code: http.StatusUnauthorized},
+		{name: "Invalid cookie", cookie: "invalid", code: http.StatusUnauthorized},
+		// Session revoked by other instance
+		{name: "Revoked session", header: "Bearer " + sign("revoked"), code: http.StatusUnauthorized},
+		{name: "Unknown session", header: "Bearer " + sign("unknown"), code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ht.CookieUserIDName, Value: tt.cookie, Path: "/"})
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, "7", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUser(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := User(req.Context())
+	assert.False(t, ok)
+
+	usr, ok := User(WithUser(req.Context(), session.Claims{UserID: 3}))
+	assert.True(t, ok)
+	assert.Equal(t, 3, usr.UserID)
+}
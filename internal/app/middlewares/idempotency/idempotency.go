@@ -0,0 +1,182 @@
+// Package idempotency implement middleware for replay response of request repeated with same key
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HeaderKey header with idempotency key of request
+const HeaderKey = "Idempotency-Key"
+
+// HeaderReplayed header of response replayed from storage
+const HeaderReplayed = "Idempotent-Replayed"
+
+// maxKeyLen max length of idempotency key
+const maxKeyLen = 255
+
+// Lease time after which unfinished request is considered abandoned and can be repeated with same key
+const Lease = time.Minute
+
+// saveTimeout limit saving of response, it isn't bound to request that can be cancelled by client
+const saveTimeout = 5 * time.Second
+
+// ErrKeyReused if key is used for other request
+var ErrKeyReused = errors.New("idempotency key is used for other request")
+
+// ErrInProgress if request with same key isn't finished
+var ErrInProgress = errors.New("request with idempotency key is in progress")
+
+type Handler struct {
+	lgr   *zap.Logger
+	stg   storage.Storage
+	lease time.Duration
+}
+
+// New constructor
+func New(lgr *zap.Logger, stg storage.Storage) *Handler {
+	return &Handler{lgr, stg, Lease}
+}
+
+// Idempotent save response of request with idempotency key and replay it on retry
+// Must be used after authenticator, keys are stored per user
+func (h Handler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLen {
+			http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+			return
+		}
+		usr, ok := authenticator.User(r.Context())
+		if !ok {
+			http.Error(w, ht.ErrNotAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, ht.ErrBadRequest.Error(), http.StatusBadRequest)
+			return
+		}
+		// Handler see empty body as before
+		r.Body = http.NoBody
+		if len(body) > 0 {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		hash := requestHash(r, body)
+		rec, created, err := h.stg.ReserveIdempotencyKey(r.Context(), models.IdempotencyRecord{
+			UserID:      usr.UserID,
+			Key:         key,
+			RequestHash: hash,
+		}, h.lease)
+		if err != nil {
+			h.lgr.Info("Internal error", zap.Error(err))
+			http.Error(w, ht.ErrInternalError.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !created {
+			switch {
+			case rec.RequestHash != hash:
+				http.Error(w, ErrKeyReused.Error(), http.StatusConflict)
+			case !rec.Done():
+				http.Error(w, ErrInProgress.Error(), http.StatusConflict)
+			default:
+				h.lgr.Debug("Replay response", zap.Int("user", usr.UserID), zap.String("key", key))
+				replay(w, rec)
+			}
+			return
+		}
+
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		// Result is saved even if client is gone, otherwise key stays in progress
+		ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+		defer cancel()
+
+		// Failed request can be repeated with same key
+		if rw.status() >= http.StatusInternalServerError {
+			if err := h.stg.DeleteIdempotencyKey(ctx, usr.UserID, key); err != nil {
+				h.lgr.Error("Release idempotency key error", zap.Error(err))
+			}
+			return
+		}
+
+		rec.Status = rw.status()
+		rec.ContentType = rw.Header().Get("Content-Type")
+		rec.Body = rw.body.Bytes()
+		if err := h.stg.CompleteIdempotencyKey(ctx, rec); err != nil {
+			h.lgr.Error("Save idempotent response error", zap.Error(err))
+		}
+	})
+}
+
+// requestHash hash of method, path and body of request
+func requestHash(r *http.Request, body []byte) string {
+	hsh := sha256.New()
+	hsh.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hsh.Write(body)
+
+	return hex.EncodeToString(hsh.Sum(nil))
+}
+
+// replay write saved response
+func replay(w http.ResponseWriter, rec models.IdempotencyRecord) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// responseRecorder copy status and body of response
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+// WriteHeader save status of response
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write save body of response
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	rw.body.Write(b)
+
+	return rw.ResponseWriter.Write(b)
+}
+
+// status of response, handler without write answer with ok
+func (rw *responseRecorder) status() int {
+	if rw.code == 0 {
+		return http.StatusOK
+	}
+
+	return rw.code
+}
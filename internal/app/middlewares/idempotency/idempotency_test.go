@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/withdraw"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// send request of user through handler
+func send(h http.Handler, userID int, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	req = req.WithContext(authenticator.WithUser(req.Context(), session.Claims{UserID: userID}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestHandler_Idempotent(t *testing.T) {
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	calls := 0
+	status := http.StatusOK
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	})
+	h := New(zap.NewNop(), stg).Idempotent(next)
+
+	// Request without key isn't saved
+	send(h, 1, "", `{}`)
+	send(h, 1, "", `{}`)
+	assert.Equal(t, 2, calls)
+
+	// Retry replay first response
+	first := send(h, 1, "key-1", `{"sum":1}`)
+	retry := send(h, 1, "key-1", `{"sum":1}`)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(HeaderReplayed))
+
+	// Same key with other body is conflict
+	assert.Equal(t, http.StatusConflict, send(h, 1, "key-1", `{"sum":2}`).Code)
+	// Keys are stored per user
+	send(h, 2, "key-1", `{"sum":2}`)
+	assert.Equal(t, 4, calls)
+
+	// Failed request can be repeated
+	status = http.StatusInternalServerError
+	send(h, 1, "key-2", `{}`)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, send(h, 1, "key-2", `{}`).Code)
+	assert.Equal(t, 6, calls)
+
+	// Request isn't repeated while first is in progress
+	_, created, err := stg.ReserveIdempotencyKey(context.Background(), models.IdempotencyRecord{
+		UserID:      1,
+		Key:         "key-3",
+		RequestHash: requestHash(httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", nil), []byte(`{}`)),
+	}, Lease)
+	require.NoError(t, err)
+	require.True(t, created)
+	assert.Equal(t, http.StatusConflict, send(h, 1, "key-3", `{}`).Code)
+	assert.Equal(t, 6, calls)
+
+	// Abandoned request can be repeated after lease
+	idm := New(zap.NewNop(), stg)
+	idm.lease = 0
+	assert.Equal(t, http.StatusConflict, send(idm.Idempotent(next), 1, "key-3", `{"sum":3}`).Code)
+	assert.Equal(t, http.StatusOK, send(idm.Idempotent(next), 1, "key-3", `{}`).Code)
+	assert.Equal(t, 7, calls)
+}
+
+// ctxStorage fail saving of keys with done context as db does
+type ctxStorage struct {
+	storage.Storage
+}
+
+// CompleteIdempotencyKey fail with done context
+func (s ctxStorage) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.Storage.CompleteIdempotencyKey(ctx, rec)
+}
+
+func TestHandler_IdempotentCancelled(t *testing.T) {
+	stg := ctxStorage{memory.New(zap.NewNop(), password.New(password.MinCost))}
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader("12345674"))
+	req.Header.Set(HeaderKey, "key-1")
+	ctx, cancel := context.WithCancel(authenticator.WithUser(req.Context(), session.Claims{UserID: 1}))
+	defer cancel()
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// Client is gone while request is handled
+		cancel()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	h := New(zap.NewNop(), stg).Idempotent(next)
+	h.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	// Result of cancelled request is saved and replayed
+	retry := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader("12345674"))
+	retry.Header.Set(HeaderKey, "key-1")
+	retry = retry.WithContext(authenticator.WithUser(retry.Context(), session.Claims{UserID: 1}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, retry)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "true", w.Header().Get(HeaderReplayed))
+	assert.Equal(t, 1, calls)
+}
+
+func TestHandler_IdempotentWithdraw(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Register(ctx, models.User{Login: "test", Password: "secret"}))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.AddPoints(ctx, 1, 10000, 12345674))
+	h := New(zap.NewNop(), stg).Idempotent(withdraw.New(zap.NewNop(), stg))
+
+	// Retries of client don't debit points again
+	body := `{"order":"2377225624","sum":40}`
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(h, 1, "withdraw-1", body).Code)
+	}
+
+	usr, err := stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(6000), usr.Points)
+	wds, err := stg.WithdrawsByUserID(ctx, 1, models.WithdrawFilter{})
+	require.NoError(t, err)
+	assert.Len(t, wds, 1)
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+)
+
+// Audited actions of operators
+const (
+	AuditUserList      = "user.list"
+	AuditUserView      = "user.view"
+	AuditOrderList     = "order.list"
+	AuditWithdrawList  = "withdrawal.list"
+	AuditLedgerView    = "ledger.view"
+	AuditLogView       = "audit.view"
+	AuditOrderRecheck  = "order.recheck"
+	AuditBalanceAdjust = "balance.adjust"
+	AuditUserBlock     = "user.block"
+	AuditUserUnblock   = "user.unblock"
+)
+
+// AuditEntry action of operator in admin API
+type AuditEntry struct {
+	ID     int64  `json:"id"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// UserID user affected by action, zero if action isn't about user
+	UserID int `json:"user_id,omitempty"`
+	// Target other entity of action, like order number
+	Target    string            `json:"target,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Details   string            `json:"details,omitempty"`
+	CreatedAt jsontime.JSONTime `json:"created_at"`
+}
+
+// AuditFilter filter of audit log by user
+type AuditFilter struct {
+	Page
+	UserID int
+}
+
+// UserFilter search users by login
+type UserFilter struct {
+	Page
+	// Login part of user login, empty for all users
+	Login string
+}
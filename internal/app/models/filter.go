@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Page of user list, items are sorted from last to first
+type Page struct {
+	// Limit of items, zero is unlimited
+	Limit int
+	// After identifier of last item of previous page, zero for first page
+	After int
+}
+
+// Period of time, zero bound isn't checked
+type Period struct {
+	// From inclusive start of period
+	From time.Time
+	// To exclusive end of period
+	To time.Time
+}
+
+// Contains check time in period
+func (p Period) Contains(t time.Time) bool {
+	if !p.From.IsZero() && t.Before(p.From) {
+		return false
+	}
+	if !p.To.IsZero() && !t.Before(p.To) {
+		return false
+	}
+
+	return true
+}
+
+// OrderFilter filter of user orders by statuses and upload time
+type OrderFilter struct {
+	Page
+	Period
+	Statuses []int
+}
+
+// WithdrawFilter filter of user withdrawals by statuses and processed time
+type WithdrawFilter struct {
+	Page
+	Period
+	Statuses []WithdrawStatus
+}
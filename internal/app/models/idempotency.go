@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyRecord saved result of request with idempotency key
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	// Status of response, zero while request is in progress
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// Done check response is saved
+func (r IdempotencyRecord) Done() bool {
+	return r.Status != 0
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// JobCheckOrder kind of job for check order status in accrual system
+const JobCheckOrder = "check_order"
+
+// JobWithdraw kind of job for process withdrawal
+const JobWithdraw = "withdraw"
+
+// Job task in durable queue
+type Job struct {
+	ID       int64
+	Kind     string
+	Key      string
+	Payload  []byte
+	Attempts int
+	RunAt    time.Time
+	// LockToken identify claim of worker, ack and retry work only with actual claim
+	LockToken string
+	LastError string
+}
+
+// DeadLetter task failed too many times
+// Dead letter can be replayed to jobs queue
+type DeadLetter struct {
+	ID        int64
+	Kind      string
+	Key       string
+	Payload   []byte
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
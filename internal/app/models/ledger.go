@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+)
+
+// Ledger entry types
+const (
+	LedgerAccrual    = "ACCRUAL"
+	LedgerWithdrawal = "WITHDRAWAL"
+	LedgerReversal   = "REVERSAL"
+	LedgerAdjustment = "ADJUSTMENT"
+)
+
+// LedgerEntry change of user balance
+type LedgerEntry struct {
+	ID           int               `json:"-"`
+	UserID       int               `json:"-"`
+	Type         string            `json:"type"`
+	Amount       money.Amount      `json:"amount"`
+	OrderID      string            `json:"order,omitempty"`
+	WithdrawalID int               `json:"-"`
+	CreatedAt    jsontime.JSONTime `json:"created_at"`
+}
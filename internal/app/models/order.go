@@ -1,6 +1,10 @@
 package models
 
-import "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"time"
+)
 
 // Order statuses
 const (
@@ -10,6 +14,25 @@ const (
 	PROCESSED
 )
 
+// orderStatuses names of order statuses
+var orderStatuses = map[string]int{
+	"NEW":        NEW,
+	"PROCESSING": PROCESSING,
+	"INVALID":    INVALID,
+	"PROCESSED":  PROCESSED,
+}
+
+// OrderStatusByName return order status by its name
+func OrderStatusByName(name string) (int, bool) {
+	status, ok := orderStatuses[name]
+
+	return status, ok
+}
+
+// OrderRecoverAfter time after which new order is checked by repeater
+// Event of new order is kept in broker memory after outbox relay, so it's lost on crash of instance
+const OrderRecoverAfter = time.Minute
+
 // Available statues in loyal machine
 const (
 	LoyalRegistered = "REGISTERED"
@@ -20,9 +43,9 @@ const (
 
 // LoyalOrder order type from loyal machine
 type LoyalOrder struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual"`
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual money.Amount `json:"accrual"`
 }
 
 // Order user list
@@ -31,9 +54,9 @@ type Order struct {
 	Code             string            `json:"number"`
 	UserID           int               `json:"-"`
 	CheckStatus      string            `json:"status"`
-	Accrual          float64           `json:"accrual,omitempty"`
+	Accrual          money.Amount      `json:"accrual,omitempty"`
 	UploadedAt       jsontime.JSONTime `json:"uploaded_at"`
 	Attempts         int               `json:"-"`
 	IsCheckDone      bool              `json:"-"`
-	AvailForWithdraw float64           `json:"-"`
+	AvailForWithdraw money.Amount      `json:"-"`
 }
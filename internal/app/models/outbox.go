@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"strconv"
+	"time"
+)
+
+// Topics of outbox events
+const (
+	// TopicOrderCreated order is registered and must be checked
+	TopicOrderCreated = "order.created"
+	// TopicWithdrawalCreated withdrawal is registered and must be processed
+	TopicWithdrawalCreated = "withdrawal.created"
+)
+
+// OutboxMessage event written in one transaction with business data
+type OutboxMessage struct {
+	ID        int64
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// WithdrawalEvent payload of withdrawal event
+type WithdrawalEvent struct {
+	ID      int          `json:"id"`
+	UserID  int          `json:"user_id"`
+	OrderID string       `json:"order"`
+	Sum     money.Amount `json:"sum"`
+}
+
+// NewOrderCreated event of new order
+// Order is found by code, so payload isn't needed
+func NewOrderCreated(code string) OutboxMessage {
+	return OutboxMessage{Topic: TopicOrderCreated, Key: code}
+}
+
+// NewWithdrawalCreated event of new withdrawal
+func NewWithdrawalCreated(ev WithdrawalEvent) (OutboxMessage, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+
+	return OutboxMessage{Topic: TopicWithdrawalCreated, Key: strconv.Itoa(ev.ID), Payload: payload}, nil
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Session of authorized user
+type Session struct {
+	ID        string
+	UserID    int
+	ExpiresAt time.Time
+	Revoked   bool
+}
@@ -0,0 +1,9 @@
+package models
+
+// Stats counters of storage for monitoring
+type Stats struct {
+	// Orders count of orders by check status
+	Orders map[int]int
+	// PendingWithdrawals count of withdrawals which aren't completed or refunded
+	PendingWithdrawals int
+}
@@ -1,17 +1,15 @@
 package models
 
-import "encoding/hex"
+import (
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+)
 
 // User model
 type User struct {
-	UserID    int     `json:"-"`
-	Login     string  `json:"login"`
-	Password  string  `json:"password"`
-	Points    float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
-}
-
-// HexPassword return hex password
-func (u *User) HexPassword() string {
-	return hex.EncodeToString([]byte(u.Password))
+	UserID    int          `json:"-"`
+	Login     string       `json:"login"`
+	Password  string       `json:"password"`
+	Points    money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
+	Blocked   bool         `json:"-"`
 }
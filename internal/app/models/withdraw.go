@@ -1,11 +1,61 @@
 package models
 
-import "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+import (
+	"encoding/json"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+)
+
+// WithdrawStatus state of withdrawal, stored as number
+type WithdrawStatus int
+
+// Withdrawal statuses
+// Completed status keep value of old processed status
+const (
+	WithdrawNew WithdrawStatus = iota
+	WithdrawCompleted
+	WithdrawProcessing
+	WithdrawFailed
+	WithdrawRefunded
+)
+
+// String return status name
+func (s WithdrawStatus) String() string {
+	switch s {
+	case WithdrawProcessing:
+		return "PROCESSING"
+	case WithdrawCompleted:
+		return "COMPLETED"
+	case WithdrawFailed:
+		return "FAILED"
+	case WithdrawRefunded:
+		return "REFUNDED"
+	default:
+		return "NEW"
+	}
+}
+
+// WithdrawStatusByName return withdrawal status by its name
+func WithdrawStatusByName(name string) (WithdrawStatus, bool) {
+	for s := WithdrawNew; s <= WithdrawRefunded; s++ {
+		if s.String() == name {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// MarshalJSON return status name
+func (s WithdrawStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
 
 type Withdraw struct {
+	ID          int               `json:"-"`
 	UserID      int               `json:"-"`
 	OrderID     string            `json:"order"`
-	Sum         float64           `json:"sum"`
-	Status      string            `json:"-"`
+	Sum         money.Amount      `json:"sum"`
+	Status      WithdrawStatus    `json:"status"`
 	ProcessedAt jsontime.JSONTime `json:"processed_at"`
 }
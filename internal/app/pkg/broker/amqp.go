@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/mq"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/pool"
+	"go.uber.org/zap"
+)
+
+// AMQP broker on rabbit mq
+// Retries and dead letters are managed by rabbit, all kinds share one queue
+type AMQP struct {
+	lgr  *zap.Logger
+	mq   *mq.Handler
+	pool *pool.Pool
+}
+
+// NewAMQP constructor
+func NewAMQP(lgr *zap.Logger, h *mq.Handler, workers int) *AMQP {
+	return &AMQP{
+		lgr:  lgr,
+		mq:   h,
+		pool: pool.New(workers),
+	}
+}
+
+// Publish message with confirm of rabbit
+func (a *AMQP) Publish(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return a.mq.Put(ctx, body)
+}
+
+// Subscribe run consumers for messages of kind
+// Message is acked only after it's handled
+func (a *AMQP) Subscribe(ctx context.Context, kind string, h Handler) error {
+	return a.pool.Run(ctx, func(ctx context.Context, workID int) error {
+		a.lgr.Info("MQ listener run", zap.String("kind", kind), zap.Int("work id", workID))
+		defer a.lgr.Info("MQ listener stop", zap.String("kind", kind), zap.Int("work id", workID))
+
+		return a.mq.Consume(ctx, func(ctx context.Context, body []byte) error {
+			return a.handle(ctx, kind, body, h)
+		})
+	})
+}
+
+// Resize implement resizer interface, unacked messages of stopped listeners are handled till the end
+func (a *AMQP) Resize(workers int) {
+	a.lgr.Info("Resize MQ listeners", zap.Int("from", a.pool.Size()), zap.Int("to", workers))
+	a.pool.Resize(workers)
+}
+
+// Ready return error if rabbit isn't connected
+func (a *AMQP) Ready(ctx context.Context) error {
+	return a.mq.Ready(ctx)
+}
+
+// Close rabbit connection
+func (a *AMQP) Close() {
+	a.mq.Close()
+}
+
+// handle decode message body and run handler
+func (a *AMQP) handle(ctx context.Context, kind string, body []byte, h Handler) error {
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		// Broken message can't be handled, so it isn't repeated
+		a.lgr.Error("Bad broker message", zap.ByteString("body", body), zap.Error(err))
+		return nil
+	}
+	if msg.Kind != kind {
+		a.lgr.Error("Message of other kind", zap.String("kind", msg.Kind), zap.String("key", msg.Key))
+		return fmt.Errorf("%w: unexpected kind %s", mq.ErrReject, msg.Kind)
+	}
+
+	err := h(ctx, msg)
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return fmt.Errorf("%w: %v", mq.ErrReject, err)
+	}
+
+	return err
+}
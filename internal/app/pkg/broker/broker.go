@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/queue"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/mq"
+	"go.uber.org/zap"
+)
+
+// ErrUnknownType if broker type not supported
+var ErrUnknownType = errors.New("broker type unknown")
+
+// Types of broker
+const (
+	TypeRabbitMQ = "rabbit"
+	TypeGO       = "go"
+	TypeQueue    = "queue"
+)
+
+// Broker transport of messages
+type Broker interface {
+	Publisher
+	Subscriber
+	// Close connections of transport
+	Close()
+}
+
+// Config of broker chosen by type
+type Config struct {
+	// Type of transport
+	Type string
+	// Host url of rabbit mq
+	Host string
+	// Subscriber config of go channel subscribers and count of rabbit listeners
+	Subscriber SubscriberConfig
+	// Rabbit config of rabbit mq handler
+	Rabbit mq.Config
+	// Queue config of durable queue workers
+	Queue queue.Config
+}
+
+// Workers return count of workers of broker type
+func (c Config) Workers() int {
+	if c.Type == TypeQueue {
+		return c.Queue.Workers
+	}
+
+	return c.Subscriber.Workers
+}
+
+// New create broker by config type
+func New(lgr *zap.Logger, cfg Config, stg storage.Storage) (Broker, error) {
+	switch cfg.Type {
+	case TypeRabbitMQ:
+		lgr.Info("Use rabbit mq broker")
+		h, err := mq.New(lgr, cfg.Host, cfg.Rabbit)
+		if err != nil {
+			return nil, err
+		}
+		return NewAMQP(lgr, h, cfg.Subscriber.Workers), nil
+
+	case TypeGO:
+		lgr.Info("Use go channel broker")
+		return NewChannel(lgr, stg, cfg.Subscriber), nil
+
+	case TypeQueue:
+		lgr.Info("Use durable queue broker")
+		return NewQueue(lgr, stg, cfg.Queue), nil
+	}
+
+	return nil, ErrUnknownType
+}
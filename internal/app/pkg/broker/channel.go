@@ -0,0 +1,195 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/graceful"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/pool"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Channel in-process broker on go channels
+// Messages are lost on restart, failed messages are retried and then moved to dead letters
+type Channel struct {
+	lgr     *zap.Logger
+	stg     storage.Storage
+	cfg     SubscriberConfig
+	pool    *pool.Pool
+	mu      sync.Mutex
+	kinds   map[string]chan Message
+	done    int64
+	failed  int64
+	retried int64
+	dead    int64
+}
+
+// NewChannel constructor
+func NewChannel(lgr *zap.Logger, stg storage.Storage, cfg SubscriberConfig) *Channel {
+	return &Channel{
+		lgr:   lgr,
+		stg:   stg,
+		cfg:   cfg,
+		pool:  pool.New(cfg.Workers),
+		kinds: make(map[string]chan Message),
+	}
+}
+
+// Publish put message in channel of kind
+func (c *Channel) Publish(ctx context.Context, msg Message) error {
+	select {
+	case c.channel(msg.Kind) <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe run workers for messages of kind
+// Failed messages are retried and then moved to dead letters, only systemic errors stop subscriber
+// Current messages are handled after stop until shutdown timeout
+func (c *Channel) Subscribe(ctx context.Context, kind string, h Handler) error {
+	taskCtx, cancel := graceful.Context(ctx, c.cfg.ShutdownTimeout)
+	defer cancel()
+	// Retries of message aren't interrupted by resize, only by stop of subscriber
+	currentCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	input := c.channel(kind)
+
+	return c.pool.Run(currentCtx, func(ctx context.Context, workID int) error {
+		c.lgr.Info("Subscribe", zap.String("kind", kind), zap.Int("work id", workID))
+		defer c.lgr.Info("Unsubscribe", zap.String("kind", kind), zap.Int("work id", workID))
+
+		for {
+			select {
+			case msg := <-input:
+				if err := c.run(currentCtx, taskCtx, msg, h); err != nil {
+					stop()
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// Resize implement resizer interface
+func (c *Channel) Resize(workers int) {
+	c.lgr.Info("Resize subscribers", zap.Int("from", c.pool.Size()), zap.Int("to", workers))
+	c.pool.Resize(workers)
+}
+
+// Close implement broker interface, messages in channels are dropped
+func (c *Channel) Close() {}
+
+// Stats return counters of messages
+func (c *Channel) Stats() Stats {
+	return Stats{
+		Done:    atomic.LoadInt64(&c.done),
+		Failed:  atomic.LoadInt64(&c.failed),
+		Retried: atomic.LoadInt64(&c.retried),
+		Dead:    atomic.LoadInt64(&c.dead),
+	}
+}
+
+// Depth return count of messages waiting in channels by kind
+func (c *Channel) Depth() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	depth := make(map[string]int, len(c.kinds))
+	for kind, ch := range c.kinds {
+		depth[kind] = len(ch)
+	}
+
+	return depth
+}
+
+// channel return go channel of kind
+func (c *Channel) channel(kind string) chan Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.kinds[kind]
+	if !ok {
+		ch = make(chan Message, c.cfg.Buffer)
+		c.kinds[kind] = ch
+	}
+
+	return ch
+}
+
+// run handle message with retries, return error only if subscriber must stop
+// Handler get task context, so it isn't interrupted by stop of subscriber
+func (c *Channel) run(ctx, taskCtx context.Context, msg Message, h Handler) error {
+	for attempt := 1; ; attempt++ {
+		err := h(taskCtx, msg)
+		if err == nil {
+			atomic.AddInt64(&c.done, 1)
+			return nil
+		}
+		// Stop on shutdown, message isn't failed
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		atomic.AddInt64(&c.failed, 1)
+
+		var fatal *FatalError
+		if errors.As(err, &fatal) {
+			c.lgr.Error("Message handled with fatal error", zap.Error(err))
+			return err
+		}
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) || c.cfg.Retry.Exhausted(attempt) {
+			atomic.AddInt64(&c.dead, 1)
+			bury(taskCtx, c.lgr, c.stg, msg, attempt, err)
+			return nil
+		}
+
+		delay := c.cfg.Retry.Delay(attempt)
+		c.lgr.Info(
+			"Message handled with error, retry later",
+			zap.String("kind", msg.Kind),
+			zap.String("key", msg.Key),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		atomic.AddInt64(&c.retried, 1)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// bury move failed message to dead letters
+func bury(ctx context.Context, lgr *zap.Logger, stg storage.Storage, msg Message, attempts int, reason error) {
+	lgr.Error(
+		"Message failed, move to dead letters",
+		zap.String("kind", msg.Kind),
+		zap.String("key", msg.Key),
+		zap.Int("attempt", attempts),
+		zap.Error(reason),
+	)
+
+	err := stg.AddDeadLetter(ctx, models.DeadLetter{
+		Kind:      msg.Kind,
+		Key:       msg.Key,
+		Payload:   msg.Payload,
+		Attempts:  attempts,
+		LastError: reason.Error(),
+	})
+	if err != nil {
+		// Message is lost, but other messages can be handled
+		lgr.Error("Add dead letter error", zap.Error(err))
+	}
+}
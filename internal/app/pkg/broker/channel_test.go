@@ -0,0 +1,181 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/queue"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSubscriberConfig config with short pauses
+func testSubscriberConfig() SubscriberConfig {
+	return SubscriberConfig{
+		Workers: 1,
+		Buffer:  10,
+		Retry:   retry.Exponential{Base: time.Millisecond, Max: 2 * time.Millisecond, MaxAttempts: 3},
+	}
+}
+
+func TestChannel_Subscribe(t *testing.T) {
+	errAccrual := errors.New("accrual error")
+	tests := []struct {
+		name    string
+		errs    []error
+		calls   int
+		stats   Stats
+		deadErr string
+	}{
+		{
+			name:  "Done",
+			errs:  []error{nil},
+			calls: 1,
+			stats: Stats{Done: 1},
+		},
+		{
+			name:  "Done after retry",
+			errs:  []error{errAccrual, nil},
+			calls: 2,
+			stats: Stats{Done: 1, Failed: 1, Retried: 1},
+		},
+		{
+			name:    "Dead after attempts",
+			errs:    []error{errAccrual, errAccrual, errAccrual},
+			calls:   3,
+			stats:   Stats{Failed: 3, Retried: 2, Dead: 1},
+			deadErr: "accrual error",
+		},
+		{
+			name:    "Permanent error",
+			errs:    []error{Permanent(errors.New("bad order code"))},
+			calls:   1,
+			stats:   Stats{Failed: 1, Dead: 1},
+			deadErr: "bad order code",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+			brk := NewChannel(zap.NewNop(), stg, testSubscriberConfig())
+
+			calls := 0
+			finished := make(chan struct{})
+			h := func(ctx context.Context, msg Message) error {
+				// Next message is handled after failed one
+				if msg.Key == "finish" {
+					close(finished)
+					return nil
+				}
+				err := tt.errs[calls]
+				calls++
+				return err
+			}
+			require.NoError(t, brk.Publish(ctx, Message{Kind: models.JobCheckOrder, Key: "12345674"}))
+			require.NoError(t, brk.Publish(ctx, Message{Kind: models.JobCheckOrder, Key: "finish"}))
+
+			done := make(chan error, 1)
+			go func() {
+				done <- brk.Subscribe(ctx, models.JobCheckOrder, h)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(time.Second):
+				t.Fatal("subscriber stopped")
+			}
+			cancel()
+			assert.ErrorIs(t, <-done, context.Canceled)
+
+			assert.Equal(t, tt.calls, calls)
+			tt.stats.Done++
+			assert.Equal(t, tt.stats, brk.Stats())
+
+			dls, err := stg.DeadLetters(context.Background())
+			require.NoError(t, err)
+			if tt.deadErr == "" {
+				assert.Empty(t, dls)
+				return
+			}
+			require.Len(t, dls, 1)
+			assert.Equal(t, models.JobCheckOrder, dls[0].Kind)
+			assert.Equal(t, "12345674", dls[0].Key)
+			assert.Equal(t, tt.calls, dls[0].Attempts)
+			assert.Equal(t, tt.deadErr, dls[0].LastError)
+		})
+	}
+}
+
+func TestChannel_Fatal(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	brk := NewChannel(zap.NewNop(), stg, testSubscriberConfig())
+
+	errDB := errors.New("database is down")
+	require.NoError(t, brk.Publish(ctx, Message{Kind: models.JobCheckOrder, Key: "12345674"}))
+
+	// Only systemic error stop subscriber
+	err := brk.Subscribe(ctx, models.JobCheckOrder, func(ctx context.Context, msg Message) error {
+		return Fatal(errDB)
+	})
+	assert.ErrorIs(t, err, errDB)
+	dls, err := stg.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dls)
+}
+
+func TestQueue_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	brk := NewQueue(zap.NewNop(), stg, queue.Config{
+		Workers:      1,
+		Batch:        10,
+		PollInterval: time.Millisecond,
+		Visibility:   time.Minute,
+		Retry:        retry.Exponential{Base: time.Millisecond, Max: time.Millisecond, MaxAttempts: 3},
+	})
+
+	// Message is put in durable queue once
+	for i := 0; i < 2; i++ {
+		require.NoError(t, brk.Publish(ctx, Message{Kind: models.JobCheckOrder, Key: "12345674", Payload: []byte("1")}))
+	}
+	require.NoError(t, brk.Publish(ctx, Message{Kind: models.JobCheckOrder, Key: "79927398713"}))
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	done := make(chan error, 1)
+	go func() {
+		done <- brk.Subscribe(ctx, models.JobCheckOrder, func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[msg.Key]++
+			if msg.Key == "79927398713" {
+				return Permanent(errors.New("bad order"))
+			}
+			return nil
+		})
+	}()
+
+	// Permanent error move message to dead letters without retry
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		dls, err := stg.DeadLetters(ctx)
+		return err == nil && len(dls) == 1 && len(handled) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"12345674": 1, "79927398713": 1}, handled)
+}
@@ -7,49 +7,97 @@ package broker
 
 import (
 	"context"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
-	"go.uber.org/zap"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"runtime"
+	"time"
 )
 
+// Handler process message, failed message is retried by transport
+type Handler func(ctx context.Context, msg Message) error
+
 // Subscriber define methods for consumers
 type Subscriber interface {
-	// Subscribe on publisher chan
-	Subscribe(ctx context.Context, input <-chan Task, workID int) error
+	// Subscribe handle messages of kind until context is done
+	Subscribe(ctx context.Context, kind string, h Handler) error
 }
 
-// SubscriberImpl describe subscriber model
-type SubscriberImpl struct {
-	lgr *zap.Logger
-	ent *env.Env
-	stg storage.Storage
+// FatalError systemic error which stop subscriber
+type FatalError struct {
+	Err error
 }
 
-// NewSubscriber create new consumer
-func NewSubscriber(lgr *zap.Logger, env *env.Env, stg storage.Storage) *SubscriberImpl {
-	return &SubscriberImpl{
-		lgr: lgr,
-		ent: env,
-		stg: stg,
-	}
+// Error implement error interface
+func (e *FatalError) Error() string {
+	return "fatal: " + e.Err.Error()
+}
+
+// Unwrap for errors.Is
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// Fatal mark task error as systemic, subscriber stop on it
+func Fatal(err error) error {
+	return &FatalError{err}
+}
+
+// PermanentError task error which can't be fixed by retry
+type PermanentError struct {
+	Err error
+}
+
+// Error implement error interface
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
 }
 
-// Subscribe on channel
-func (c *SubscriberImpl) Subscribe(ctx context.Context, input <-chan Task, workID int) error {
-	// Pusher run check orders in goroutines
-	c.lgr.Info("Subscribe", zap.Int("work id", workID))
-	defer c.lgr.Info("Unsubscribe", zap.Int("work id", workID))
-
-	for {
-		select {
-		case task := <-input:
-			c.lgr.Info("Subscriber get task", zap.Int("worker id", workID))
-			if err := task(ctx); err != nil {
-				c.lgr.Error("Task executed with error", zap.Error(err))
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+// Unwrap for errors.Is
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent mark task error as permanent, task is moved to dead letters without retry
+func Permanent(err error) error {
+	return &PermanentError{err}
+}
+
+// SubscriberConfig retry policy of subscriber
+type SubscriberConfig struct {
+	// Workers count of parallel handlers of messages, can be changed by Resize
+	Workers int
+	// Buffer capacity of go channel of kind, publisher wait when it's full
+	Buffer int
+	// Retry policy of failed messages, message is moved to dead letters after max attempts
+	Retry retry.Exponential
+	// ShutdownTimeout time for current messages to be handled after subscriber is stopped
+	ShutdownTimeout time.Duration
+}
+
+// DefaultSubscriberConfig return config for production
+func DefaultSubscriberConfig() SubscriberConfig {
+	return SubscriberConfig{
+		Workers: runtime.NumCPU(),
+		Buffer:  1000,
+		Retry: retry.Exponential{
+			Base:        100 * time.Millisecond,
+			Max:         5 * time.Second,
+			MaxAttempts: 5,
+			Jitter:      0.2,
+		},
+		ShutdownTimeout: 30 * time.Second,
 	}
 }
+
+// Resizer subscriber with count of workers changeable at runtime
+type Resizer interface {
+	// Resize change count of workers of each kind, stopped workers finish current messages
+	Resize(workers int)
+}
+
+// Stats counters of subscriber tasks
+type Stats struct {
+	Done    int64
+	Failed  int64
+	Retried int64
+	Dead    int64
+}
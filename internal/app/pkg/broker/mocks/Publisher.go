@@ -5,6 +5,8 @@ package mocks
 import (
 	context "context"
 
+	broker "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,29 +15,13 @@ type Publisher struct {
 	mock.Mock
 }
 
-// Channel provides a mock function with given fields:
-func (_m *Publisher) Channel() <-chan func(context.Context) error {
-	ret := _m.Called()
-
-	var r0 <-chan func(context.Context) error
-	if rf, ok := ret.Get(0).(func() <-chan func(context.Context) error); ok {
-		r0 = rf()
-	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(<-chan func(context.Context) error)
-		}
-	}
-
-	return r0
-}
-
-// Publish provides a mock function with given fields: task
-func (_m *Publisher) Publish(task func(context.Context) error) error {
-	ret := _m.Called(task)
+// Publish provides a mock function with given fields: ctx, msg
+func (_m *Publisher) Publish(ctx context.Context, msg broker.Message) error {
+	ret := _m.Called(ctx, msg)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(func(context.Context) error) error); ok {
-		r0 = rf(task)
+	if rf, ok := ret.Get(0).(func(context.Context, broker.Message) error); ok {
+		r0 = rf(ctx, msg)
 	} else {
 		r0 = ret.Error(0)
 	}
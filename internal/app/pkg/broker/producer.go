@@ -7,47 +7,18 @@ package broker
 
 import (
 	"context"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
-	"go.uber.org/zap"
 )
 
-// Task for producer
-type Task = func(ctx context.Context) error
+// Message serializable task of broker
+// Kind and Key identify task in dead letters
+type Message struct {
+	Kind    string `json:"kind"`
+	Key     string `json:"key"`
+	Payload []byte `json:"payload,omitempty"`
+}
 
 // Publisher define main methods for check order queue
 type Publisher interface {
-	// Publish task
-	Publish(task Task) error
-	// Channel return active publisher chan
-	Channel() <-chan Task
-}
-
-// PublisherImpl describe publisher model
-type PublisherImpl struct {
-	lgr   *zap.Logger
-	tasks chan Task
-	ent   *env.Env
-	stg   storage.Storage
-}
-
-// NewPublisher create new producer
-func NewPublisher(lgr *zap.Logger, ent *env.Env, stg storage.Storage) *PublisherImpl {
-	return &PublisherImpl{
-		lgr:   lgr,
-		ent:   ent,
-		stg:   stg,
-		tasks: make(chan Task, 1000),
-	}
-}
-
-// Publish task by producer
-func (p *PublisherImpl) Publish(task Task) error {
-	p.tasks <- task
-	return nil
-}
-
-// Channel return active publisher chan
-func (p *PublisherImpl) Channel() <-chan Task {
-	return p.tasks
+	// Publish message to transport
+	Publish(ctx context.Context, msg Message) error
 }
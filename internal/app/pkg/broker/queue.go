@@ -0,0 +1,57 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/queue"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"go.uber.org/zap"
+)
+
+// Queue durable broker on jobs queue of storage
+// Messages of same kind and key aren't duplicated while they wait in queue
+type Queue struct {
+	lgr *zap.Logger
+	stg storage.Storage
+	que *queue.Queue
+}
+
+// NewQueue constructor
+func NewQueue(lgr *zap.Logger, stg storage.Storage, cfg queue.Config) *Queue {
+	return &Queue{
+		lgr: lgr,
+		stg: stg,
+		que: queue.New(lgr, stg, cfg),
+	}
+}
+
+// Publish put message in jobs queue
+func (q *Queue) Publish(ctx context.Context, msg Message) error {
+	return q.stg.Enqueue(ctx, models.Job{Kind: msg.Kind, Key: msg.Key, Payload: msg.Payload})
+}
+
+// Subscribe run queue workers for jobs of kind
+// Retries and dead letters are managed by queue, permanent error move job to dead letters at once
+func (q *Queue) Subscribe(ctx context.Context, kind string, h Handler) error {
+	return q.que.Run(ctx, kind, func(ctx context.Context, job models.Job) error {
+		msg := Message{Kind: job.Kind, Key: job.Key, Payload: job.Payload}
+		err := h(ctx, msg)
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) {
+			bury(ctx, q.lgr, q.stg, msg, job.Attempts, err)
+			return nil
+		}
+
+		return err
+	})
+}
+
+// Resize implement resizer interface
+func (q *Queue) Resize(workers int) {
+	q.que.Resize(workers)
+}
+
+// Close implement broker interface, jobs stay in storage
+func (q *Queue) Close() {}
@@ -0,0 +1,213 @@
+// Package health implement liveness and readiness probes of service
+// Readiness fails if required dependency is down, worker is stopped or service is draining
+// @author Sergey Vrulin (aka Alex Versus)
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CheckTimeout max time of all checks of readiness probe
+const CheckTimeout = 2 * time.Second
+
+// Statuses of service
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// States of worker
+const (
+	WorkerRunning = "running"
+	WorkerStopped = "stopped"
+)
+
+// Check return error if dependency isn't available
+type Check func(ctx context.Context) error
+
+// Readier describe dependency which can report own readiness
+type Readier interface {
+	// Ready return error if dependency isn't available
+	Ready(ctx context.Context) error
+}
+
+// check named dependency check
+type check struct {
+	name string
+	fn   Check
+	// critical check failure makes service not ready, other failures only degrade it
+	critical bool
+}
+
+// Report body of probe response
+type Report struct {
+	Status  string            `json:"status"`
+	Checks  map[string]string `json:"checks,omitempty"`
+	Workers map[string]string `json:"workers,omitempty"`
+}
+
+// Health state of service
+type Health struct {
+	lgr      *zap.Logger
+	mu       sync.RWMutex
+	checks   []check
+	workers  map[string]string
+	draining bool
+}
+
+// New constructor
+func New(lgr *zap.Logger) *Health {
+	return &Health{
+		lgr:     lgr,
+		workers: make(map[string]string),
+	}
+}
+
+// AddCheck add dependency check to readiness probe
+// Failure of not critical check is reported, but service stays ready
+func (h *Health) AddCheck(name string, fn Check, critical bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, check{name: name, fn: fn, critical: critical})
+}
+
+// Worker mark background worker as running, returned func mark it as stopped
+func (h *Health) Worker(name string) func() {
+	h.setWorker(name, WorkerRunning)
+
+	return func() {
+		h.setWorker(name, WorkerStopped)
+	}
+}
+
+// Drain make service not ready, so balancer stop sending requests before shutdown
+func (h *Health) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.draining = true
+}
+
+// Live handle liveness probe, process is alive while it can answer
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	h.write(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready handle readiness probe
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), CheckTimeout)
+	defer cancel()
+
+	rep := h.Report(ctx)
+	status := http.StatusOK
+	if rep.Status == StatusFail || rep.Status == StatusDraining {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.write(w, status, rep)
+}
+
+// Report run checks and collect state of service
+func (h *Health) Report(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := append([]check(nil), h.checks...)
+	rep := Report{
+		Status:  StatusOK,
+		Checks:  make(map[string]string, len(checks)),
+		Workers: make(map[string]string, len(h.workers)),
+	}
+	for name, state := range h.workers {
+		rep.Workers[name] = state
+		if state != WorkerRunning {
+			rep.Status = StatusFail
+		}
+	}
+	draining := h.draining
+	h.mu.RUnlock()
+
+	// Checks are run in parallel, so slow dependency don't hide others
+	errs := make([]error, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			errs[i] = c.fn(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range checks {
+		if errs[i] == nil {
+			rep.Checks[c.name] = StatusOK
+			continue
+		}
+		rep.Checks[c.name] = errs[i].Error()
+		switch {
+		case c.critical:
+			rep.Status = StatusFail
+		case rep.Status == StatusOK:
+			rep.Status = StatusDegraded
+		}
+	}
+	if draining {
+		rep.Status = StatusDraining
+	}
+
+	return rep
+}
+
+// Failed return names of failed checks and stopped workers
+func (r Report) Failed() []string {
+	var names []string
+	for name, state := range r.Checks {
+		if state != StatusOK {
+			names = append(names, name)
+		}
+	}
+	for name, state := range r.Workers {
+		if state != WorkerRunning {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// setWorker save state of worker
+func (h *Health) setWorker(name, state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.workers[name] = state
+}
+
+// write probe response
+func (h *Health) write(w http.ResponseWriter, status int, rep Report) {
+	body, err := json.Marshal(rep)
+	if err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status != http.StatusOK {
+		h.lgr.Info("Service isn't ready", zap.String("status", rep.Status), zap.Strings("failed", rep.Failed()))
+	}
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if _, err = w.Write(body); err != nil {
+		h.lgr.Info("Internal error", zap.Error(err))
+	}
+}
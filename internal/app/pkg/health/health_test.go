@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ready call readiness probe and decode report
+func ready(t *testing.T, hlt *Health) (int, Report) {
+	w := httptest.NewRecorder()
+	hlt.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var rep Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rep))
+
+	return w.Code, rep
+}
+
+func TestHealth_Live(t *testing.T) {
+	hlt := New(zap.NewNop())
+	hlt.AddCheck("storage", func(ctx context.Context) error {
+		return errors.New("down")
+	}, true)
+
+	// Liveness doesn't depend on dependencies
+	w := httptest.NewRecorder()
+	hlt.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestHealth_Ready(t *testing.T) {
+	var storageErr, accrualErr error
+	hlt := New(zap.NewNop())
+	hlt.AddCheck("storage", func(ctx context.Context) error {
+		return storageErr
+	}, true)
+	hlt.AddCheck("accrual", func(ctx context.Context) error {
+		return accrualErr
+	}, false)
+	done := hlt.Worker("repeater")
+
+	code, rep := ready(t, hlt)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Report{
+		Status:  StatusOK,
+		Checks:  map[string]string{"storage": StatusOK, "accrual": StatusOK},
+		Workers: map[string]string{"repeater": WorkerRunning},
+	}, rep)
+
+	// Not critical dependency only degrade service
+	accrualErr = errors.New("circuit open")
+	code, rep = ready(t, hlt)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusDegraded, rep.Status)
+	assert.Equal(t, "circuit open", rep.Checks["accrual"])
+
+	storageErr = errors.New("connection refused")
+	code, rep = ready(t, hlt)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, rep.Status)
+	assert.Equal(t, []string{"accrual", "storage"}, rep.Failed())
+
+	// Stopped worker makes service not ready
+	storageErr, accrualErr = nil, nil
+	done()
+	code, rep = ready(t, hlt)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"repeater"}, rep.Failed())
+}
+
+func TestHealth_Drain(t *testing.T) {
+	hlt := New(zap.NewNop())
+	hlt.AddCheck("storage", func(ctx context.Context) error {
+		return nil
+	}, true)
+	code, _ := ready(t, hlt)
+	require.Equal(t, http.StatusOK, code)
+
+	hlt.Drain()
+	code, rep := ready(t, hlt)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDraining, rep.Status)
+}
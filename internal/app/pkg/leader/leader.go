@@ -0,0 +1,97 @@
+// Package leader implement election of one instance for background job
+// Leader hold distributed lock of job, other instances wait until lock is free
+package leader
+
+import (
+	"context"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"go.uber.org/zap"
+	"time"
+)
+
+// DefaultInterval how often followers try to take leadership and leader check its lock
+const DefaultInterval = 5 * time.Second
+
+// Job background job which must run only on one instance
+type Job func(ctx context.Context) error
+
+// Locker describe distributed locks
+type Locker interface {
+	// TryLock take named lock shared by all instances without wait
+	TryLock(ctx context.Context, name string) (storage.Lock, bool, error)
+}
+
+// Elector run jobs only while instance is leader
+type Elector struct {
+	lgr      *zap.Logger
+	lck      Locker
+	interval time.Duration
+}
+
+// New constructor
+func New(lgr *zap.Logger, lck Locker, interval time.Duration) *Elector {
+	return &Elector{lgr, lck, interval}
+}
+
+// Run wait leadership for job name and run job while leadership is held
+// Job context is canceled when leadership is lost, then instance tries to be leader again
+func (e *Elector) Run(ctx context.Context, name string, job Job) error {
+	for {
+		lck, ok, err := e.lck.TryLock(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			e.lgr.Error("Take leadership error", zap.String("job", name), zap.Error(err))
+		}
+		if ok {
+			if err := e.lead(ctx, name, lck, job); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-time.After(e.interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lead run job and check lock until job is ended or lock is lost
+// Return nil if leadership was lost
+func (e *Elector) lead(ctx context.Context, name string, lck storage.Lock, job Job) error {
+	e.lgr.Info("Leadership taken", zap.String("job", name))
+	defer func() {
+		// Parent context can be canceled already
+		if err := lck.Release(context.Background()); err != nil {
+			e.lgr.Info("Release leadership error", zap.String("job", name), zap.Error(err))
+		}
+		e.lgr.Info("Leadership released", zap.String("job", name))
+	}()
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- job(jobCtx)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			if err := lck.Alive(ctx); err != nil {
+				e.lgr.Error("Leadership lost", zap.String("job", name), zap.Error(err))
+				cancel()
+				<-done
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lostLock lock which is lost after first check
+type lostLock struct{}
+
+func (l lostLock) Alive(ctx context.Context) error {
+	return errors.New("connection closed")
+}
+
+func (l lostLock) Release(ctx context.Context) error {
+	return nil
+}
+
+// lostLocker give lock which is lost soon
+type lostLocker struct {
+	taken int32
+}
+
+func (l *lostLocker) TryLock(ctx context.Context, name string) (storage.Lock, bool, error) {
+	atomic.AddInt32(&l.taken, 1)
+	return lostLock{}, true, nil
+}
+
+func TestElector_Run(t *testing.T) {
+	// Instances share one storage like one database
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+
+	var running, maxRunning, leader int32
+	var mu sync.Mutex
+	job := func(id int32) Job {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			leader = id
+			mu.Unlock()
+
+			<-ctx.Done()
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return ctx.Err()
+		}
+	}
+
+	cancels := make(map[int32]context.CancelFunc)
+	wg := sync.WaitGroup{}
+	for i := int32(0); i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		elc := New(zap.NewNop(), stg, time.Millisecond)
+		wg.Add(1)
+		go func(id int32) {
+			defer wg.Done()
+			assert.ErrorIs(t, elc.Run(ctx, "repeater", job(id)), context.Canceled)
+		}(i)
+	}
+
+	// Stop leaders one by one like died instances, other instance take leadership
+	for len(cancels) > 0 {
+		var current int32
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			current = leader
+			_, alive := cancels[current]
+			return running == 1 && alive
+		}, time.Second, time.Millisecond)
+
+		cancels[current]()
+		delete(cancels, current)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxRunning)
+}
+
+func TestElector_LostLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lck := &lostLocker{}
+	var started int32
+	elc := New(zap.NewNop(), lck, time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		done <- elc.Run(ctx, "withdrawal", func(ctx context.Context) error {
+			atomic.AddInt32(&started, 1)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	// Job is stopped on lost lock and started again with new lock
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&started) > 2
+	}, time.Second, time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&lck.taken) > 2)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestElector_JobError(t *testing.T) {
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	elc := New(zap.NewNop(), stg, time.Millisecond)
+
+	errJob := errors.New("job error")
+	err := elc.Run(context.Background(), "repeater", func(ctx context.Context) error {
+		return errJob
+	})
+	assert.ErrorIs(t, err, errJob)
+
+	// Lock is released after job
+	lck, ok, err := stg.TryLock(context.Background(), "repeater")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, lck.Release(context.Background()))
+}
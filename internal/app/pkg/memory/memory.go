@@ -0,0 +1,1136 @@
+// Package memory implement in-memory storage for run project without database
+//
+// Vrulin Sergey (aka Alex Versus) 2021
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/encoder"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// user record in memory
+type user struct {
+	id        int
+	login     string
+	password  string
+	points    money.Amount
+	withdrawn money.Amount
+	blocked   bool
+}
+
+// order record in memory
+type order struct {
+	id               int
+	userID           int
+	code             string
+	status           int
+	accrual          money.Amount
+	availForWithdraw money.Amount
+	createdAt        time.Time
+	repeatAt         time.Time
+	attempts         int
+	isCheckDone      bool
+}
+
+// withdraw record in memory
+type withdraw struct {
+	id          int
+	userID      int
+	orderID     string
+	points      money.Amount
+	status      models.WithdrawStatus
+	processedAt time.Time
+	updatedAt   time.Time
+}
+
+// job record in memory
+type job struct {
+	models.Job
+	lockedUntil time.Time
+}
+
+// lock record in memory
+type lock struct {
+	m    *Memory
+	name string
+}
+
+// idempotencyKey key of idempotency record
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+// Memory storage
+type Memory struct {
+	mu          sync.RWMutex
+	lgr         *zap.Logger
+	hsr         *password.Hasher
+	users       map[int]*user
+	logins      map[string]int
+	sessions    map[string]models.Session
+	orders      map[int]*order
+	codes       map[string]int
+	withdrawals []*withdraw
+	ledger      []models.LedgerEntry
+	jobs        map[int64]*job
+	jobKeys     map[string]int64
+	deadLetters []models.DeadLetter
+	outbox      []models.OutboxMessage
+	audit       []models.AuditEntry
+	idempotency map[idempotencyKey]models.IdempotencyRecord
+	locks       map[string]*lock
+	userSeq     int
+	orderSeq    int
+	withdrawSeq int
+	jobSeq      int64
+	deadSeq     int64
+	outboxSeq   int64
+	auditSeq    int64
+}
+
+// New construct in-memory storage
+func New(lgr *zap.Logger, hsr *password.Hasher) *Memory {
+	return &Memory{
+		lgr:         lgr,
+		hsr:         hsr,
+		users:       make(map[int]*user),
+		logins:      make(map[string]int),
+		sessions:    make(map[string]models.Session),
+		orders:      make(map[int]*order),
+		codes:       make(map[string]int),
+		jobs:        make(map[int64]*job),
+		jobKeys:     make(map[string]int64),
+		locks:       make(map[string]*lock),
+		idempotency: make(map[idempotencyKey]models.IdempotencyRecord),
+	}
+}
+
+// Close storage
+func (m *Memory) Close() {
+	m.lgr.Info("Memory storage closed")
+}
+
+// Register register new user in storage
+func (m *Memory) Register(ctx context.Context, u models.User) error {
+	hash, err := m.hsr.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.logins[u.Login]; ok {
+		return storage.ErrLoginAlreadyExist
+	}
+
+	m.userSeq++
+	m.users[m.userSeq] = &user{
+		id:       m.userSeq,
+		login:    u.Login,
+		password: hash,
+	}
+	m.logins[u.Login] = m.userSeq
+
+	return nil
+}
+
+// HasAuth search user in storage
+func (m *Memory) HasAuth(ctx context.Context, u models.User) (bool, error) {
+	m.mu.RLock()
+	id, ok := m.logins[u.Login]
+	var hash string
+	if ok {
+		hash = m.users[id].password
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+
+	ok, needRehash := m.hsr.Compare(hash, u.Password)
+	if ok && needRehash {
+		// Legacy password replaced by new hash on successful login
+		newHash, err := m.hsr.Hash(u.Password)
+		if err != nil {
+			m.lgr.Info("Password rehash error", zap.Int("user", id), zap.Error(err))
+			return true, nil
+		}
+		m.mu.Lock()
+		if m.users[id].password == hash {
+			m.users[id].password = newHash
+		}
+		m.mu.Unlock()
+	}
+
+	return ok, nil
+}
+
+// UserByLogin get user by login
+func (m *Memory) UserByLogin(ctx context.Context, login string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.logins[login]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return m.userModel(m.users[id]), nil
+}
+
+// UserByID get user with balance by id
+func (m *Memory) UserByID(ctx context.Context, userID int) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usr, ok := m.users[userID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return m.userModel(usr), nil
+}
+
+// Users get page of users by part of login
+func (m *Memory) Users(ctx context.Context, flt models.UserFilter) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	login := strings.ToLower(flt.Login)
+	var found []*user
+	for _, usr := range m.users {
+		if (flt.After > 0 && usr.id >= flt.After) || !strings.Contains(strings.ToLower(usr.login), login) {
+			continue
+		}
+		found = append(found, usr)
+	}
+
+	// Last users first
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].id > found[j].id
+	})
+	if flt.Limit > 0 && len(found) > flt.Limit {
+		found = found[:flt.Limit]
+	}
+
+	var users []models.User
+	for _, usr := range found {
+		users = append(users, m.userModel(usr))
+	}
+
+	return users, nil
+}
+
+// BlockUser block or unblock user, sessions of blocked user are revoked
+func (m *Memory) BlockUser(ctx context.Context, userID int, blocked bool, audit models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usr, ok := m.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	usr.blocked = blocked
+	if blocked {
+		for id, ses := range m.sessions {
+			if ses.UserID == userID {
+				ses.Revoked = true
+				m.sessions[id] = ses
+			}
+		}
+	}
+	m.addAudit(audit)
+
+	return nil
+}
+
+// AdjustBalance change user balance by signed amount with ledger entry
+func (m *Memory) AdjustBalance(ctx context.Context, userID int, amount money.Amount, audit models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usr, ok := m.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if usr.points+amount < 0 {
+		return storage.ErrInsufficientFunds
+	}
+	m.addEntry(userID, models.LedgerAdjustment, amount, "", 0)
+	usr.points += amount
+	m.addAudit(audit)
+
+	return nil
+}
+
+// AddSession put new user session in storage
+func (m *Memory) AddSession(ctx context.Context, ses models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[ses.ID] = ses
+
+	return nil
+}
+
+// SessionByID get session by identifier
+func (m *Memory) SessionByID(ctx context.Context, id string) (models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ses, ok := m.sessions[id]
+	if !ok {
+		return ses, sql.ErrNoRows
+	}
+
+	return ses, nil
+}
+
+// RevokeSession mark session as revoked
+func (m *Memory) RevokeSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ses, ok := m.sessions[id]; ok {
+		ses.Revoked = true
+		m.sessions[id] = ses
+	}
+
+	return nil
+}
+
+// PutOrder put order in storage
+func (m *Memory) PutOrder(ctx context.Context, ord models.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.codes[ord.Code]; ok {
+		return storage.ErrOrderAlreadyExist
+	}
+
+	m.orderSeq++
+	now := time.Now()
+	m.orders[m.orderSeq] = &order{
+		id:        m.orderSeq,
+		userID:    ord.UserID,
+		code:      ord.Code,
+		status:    models.NEW,
+		createdAt: now,
+		// Order is found by repeater if its event is lost
+		repeatAt: now.Add(models.OrderRecoverAfter),
+	}
+	m.codes[ord.Code] = m.orderSeq
+	m.addOutbox(models.NewOrderCreated(ord.Code))
+
+	return nil
+}
+
+// SetStatus update status to order by code
+func (m *Memory) SetStatus(ctx context.Context, orderCode int, status int, timeout int, points money.Amount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setStatus(orderCode, status, timeout, points)
+
+	return nil
+}
+
+// PostponeCheck move next check of order without attempt
+func (m *Memory) PostponeCheck(ctx context.Context, orderCode int, timeout int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.codes[strconv.Itoa(orderCode)]
+	if !ok {
+		return nil
+	}
+	ord := m.orders[id]
+	if ord.isCheckDone {
+		return nil
+	}
+	if timeout < 1 {
+		timeout = 1
+	}
+	ord.repeatAt = time.Now().Add(time.Duration(timeout) * time.Second)
+
+	return nil
+}
+
+// setStatus update status without lock and return true if order was changed
+func (m *Memory) setStatus(orderCode int, status int, timeout int, points money.Amount) bool {
+	id, ok := m.codes[strconv.Itoa(orderCode)]
+	if !ok {
+		return false
+	}
+	ord := m.orders[id]
+	if ord.isCheckDone {
+		return false
+	}
+
+	// If it's ended status
+	if status == models.PROCESSED || status == models.INVALID {
+		ord.status = status
+		ord.accrual = points
+		ord.availForWithdraw = points
+		ord.isCheckDone = true
+		return true
+	}
+
+	if timeout < 1 {
+		timeout = 1
+	}
+	ord.status = status
+	ord.accrual = points
+	ord.repeatAt = time.Now().Add(time.Duration(timeout) * time.Second)
+	ord.attempts++
+
+	return true
+}
+
+// AddPoints add points to user and done check
+func (m *Memory) AddPoints(ctx context.Context, userID int, points money.Amount, orderCode int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usr, ok := m.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	// Order can be processed only once
+	if m.setStatus(orderCode, models.PROCESSED, 0, points) {
+		m.addEntry(userID, models.LedgerAccrual, points, strconv.Itoa(orderCode), 0)
+		usr.points += points
+	}
+
+	return nil
+}
+
+// Orders get user orders list
+func (m *Memory) Orders(ctx context.Context, userID int, flt models.OrderFilter) ([]models.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []*order
+	for _, ord := range m.orders {
+		if ord.userID != userID || (flt.After > 0 && ord.id >= flt.After) || !flt.Contains(ord.createdAt) {
+			continue
+		}
+		if len(flt.Statuses) > 0 && !containsInt(flt.Statuses, ord.status) {
+			continue
+		}
+		found = append(found, ord)
+	}
+
+	// Last orders first
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].id > found[j].id
+	})
+	if flt.Limit > 0 && len(found) > flt.Limit {
+		found = found[:flt.Limit]
+	}
+
+	var orders []models.Order
+	for _, ord := range found {
+		orders = append(orders, m.toModel(ord))
+	}
+
+	return orders, nil
+}
+
+// OrderByCode get order by code
+func (m *Memory) OrderByCode(ctx context.Context, code int) (models.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.codes[strconv.Itoa(code)]
+	if !ok {
+		return models.Order{}, sql.ErrNoRows
+	}
+
+	return m.toModel(m.orders[id]), nil
+}
+
+// OrdersForCheck get chunk for check in loyalty machine
+func (m *Memory) OrdersForCheck(ctx context.Context, limit int) ([]models.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orders []models.Order
+	now := time.Now()
+	for _, ord := range m.orders {
+		if ord.isCheckDone || ord.repeatAt.IsZero() || !ord.repeatAt.Before(now) {
+			continue
+		}
+		orders = append(orders, m.toModel(ord))
+		if len(orders) == limit {
+			break
+		}
+	}
+
+	return orders, nil
+}
+
+// ResetOrderCheck return order to check in loyalty machine
+func (m *Memory) ResetOrderCheck(ctx context.Context, code int, audit models.AuditEntry) (models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.codes[strconv.Itoa(code)]
+	if !ok {
+		return models.Order{}, sql.ErrNoRows
+	}
+	ord := m.orders[id]
+	// Processed order can't be checked again, otherwise points are added twice
+	if ord.status == models.PROCESSED {
+		return models.Order{}, storage.ErrOrderProcessed
+	}
+	ord.isCheckDone = false
+	ord.attempts = 0
+	ord.repeatAt = time.Now()
+	audit.UserID = ord.userID
+	m.addAudit(audit)
+
+	return m.toModel(ord), nil
+}
+
+// AddWithdraw check user balance, debit points and add withdraw to queue
+func (m *Memory) AddWithdraw(ctx context.Context, ord models.Order, points money.Amount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usr, ok := m.users[ord.UserID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if usr.points < points {
+		return storage.ErrInsufficientFunds
+	}
+	for _, wd := range m.withdrawals {
+		if wd.orderID == ord.ID && wd.status != models.WithdrawRefunded {
+			return storage.ErrWithdrawAlreadyExist
+		}
+	}
+
+	msg, err := models.NewWithdrawalCreated(models.WithdrawalEvent{
+		ID:      m.withdrawSeq + 1,
+		UserID:  ord.UserID,
+		OrderID: ord.ID,
+		Sum:     points,
+	})
+	if err != nil {
+		return err
+	}
+
+	m.withdrawSeq++
+	m.withdrawals = append(m.withdrawals, &withdraw{
+		id:        m.withdrawSeq,
+		userID:    ord.UserID,
+		orderID:   ord.ID,
+		points:    points,
+		status:    models.WithdrawNew,
+		updatedAt: time.Now(),
+	})
+	m.addEntry(ord.UserID, models.LedgerWithdrawal, -points, ord.ID, m.withdrawSeq)
+	usr.points -= points
+	usr.withdrawn += points
+	m.addOutbox(msg)
+
+	return nil
+}
+
+// ActiveWithdrawals get withdrawals which aren't finished
+func (m *Memory) ActiveWithdrawals(ctx context.Context, stale time.Duration, limit int) ([]models.Withdraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var wds []models.Withdraw
+	for _, wd := range m.withdrawals {
+		switch wd.status {
+		case models.WithdrawNew, models.WithdrawFailed:
+		case models.WithdrawProcessing:
+			if time.Since(wd.updatedAt) < stale {
+				continue
+			}
+		default:
+			continue
+		}
+		wds = append(wds, wd.model())
+		if len(wds) == limit {
+			break
+		}
+	}
+
+	return wds, nil
+}
+
+// WithdrawalByID get withdrawal by identifier
+func (m *Memory) WithdrawalByID(ctx context.Context, id int) (models.Withdraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wd := m.withdrawal(id)
+	if wd == nil {
+		return models.Withdraw{}, sql.ErrNoRows
+	}
+
+	return wd.model(), nil
+}
+
+// SetWithdrawStatus move withdrawal from one status to other
+func (m *Memory) SetWithdrawStatus(ctx context.Context, id int, from, to models.WithdrawStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wd := m.withdrawal(id)
+	if wd == nil || wd.status != from {
+		return storage.ErrWithdrawStatus
+	}
+	wd.status = to
+	wd.updatedAt = time.Now()
+	if to == models.WithdrawCompleted {
+		wd.processedAt = wd.updatedAt
+	}
+
+	return nil
+}
+
+// RefundWithdrawal return points of failed withdrawal to user
+func (m *Memory) RefundWithdrawal(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wd := m.withdrawal(id)
+	if wd == nil || wd.status != models.WithdrawFailed {
+		return storage.ErrWithdrawStatus
+	}
+	usr, ok := m.users[wd.userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	wd.status = models.WithdrawRefunded
+	wd.updatedAt = time.Now()
+	m.addEntry(wd.userID, models.LedgerReversal, wd.points, wd.orderID, wd.id)
+	usr.points += wd.points
+	usr.withdrawn -= wd.points
+
+	return nil
+}
+
+// WithdrawsByUserID get page of user withdrawals by filter
+func (m *Memory) WithdrawsByUserID(ctx context.Context, userID int, flt models.WithdrawFilter) ([]models.Withdraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var wds []models.Withdraw
+	// Last withdrawals first
+	for i := len(m.withdrawals) - 1; i >= 0; i-- {
+		wd := m.withdrawals[i].model()
+		if wd.UserID != userID || (flt.After > 0 && wd.ID >= flt.After) || !flt.Contains(time.Time(wd.ProcessedAt)) {
+			continue
+		}
+		if len(flt.Statuses) > 0 && !containsStatus(flt.Statuses, wd.Status) {
+			continue
+		}
+		wds = append(wds, wd)
+		if flt.Limit > 0 && len(wds) == flt.Limit {
+			break
+		}
+	}
+
+	return wds, nil
+}
+
+// BalanceHistory get ledger entries of user balance
+func (m *Memory) BalanceHistory(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.LedgerEntry
+	// Last entries first
+	for i := len(m.ledger) - 1; i >= 0; i-- {
+		if m.ledger[i].UserID == userID {
+			entries = append(entries, m.ledger[i])
+		}
+	}
+
+	return entries, nil
+}
+
+// Enqueue put job in durable queue
+func (m *Memory) Enqueue(ctx context.Context, jb models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueue(jb)
+
+	return nil
+}
+
+// enqueue put job in queue without lock
+func (m *Memory) enqueue(jb models.Job) {
+	if jb.RunAt.IsZero() {
+		jb.RunAt = time.Now()
+	}
+	key := jb.Kind + "/" + jb.Key
+	if id, ok := m.jobKeys[key]; ok {
+		if exist := m.jobs[id]; jb.RunAt.Before(exist.RunAt) {
+			exist.RunAt = jb.RunAt
+		}
+		return
+	}
+
+	m.jobSeq++
+	jb.ID = m.jobSeq
+	jb.Attempts = 0
+	jb.LockToken = ""
+	m.jobs[jb.ID] = &job{Job: jb}
+	m.jobKeys[key] = jb.ID
+}
+
+// ClaimJobs lock ready jobs of kind for visibility timeout
+func (m *Memory) ClaimJobs(ctx context.Context, kind string, limit int, visibility time.Duration) ([]models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var ready []*job
+	for _, jb := range m.jobs {
+		if jb.Kind != kind || jb.RunAt.After(now) || jb.lockedUntil.After(now) {
+			continue
+		}
+		ready = append(ready, jb)
+	}
+	// Oldest jobs first
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].RunAt.Before(ready[j].RunAt)
+	})
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+
+	var jobs []models.Job
+	token := encoder.RandomString(32)
+	for _, jb := range ready {
+		jb.lockedUntil = now.Add(visibility)
+		jb.LockToken = token
+		jb.Attempts++
+		jobs = append(jobs, jb.Job)
+	}
+
+	return jobs, nil
+}
+
+// AckJob remove done job from queue
+func (m *Memory) AckJob(ctx context.Context, jb models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.lockedJob(jb); err != nil {
+		return err
+	}
+	delete(m.jobs, jb.ID)
+	delete(m.jobKeys, jb.Kind+"/"+jb.Key)
+
+	return nil
+}
+
+// RetryJob release job and schedule next attempt after delay
+func (m *Memory) RetryJob(ctx context.Context, jb models.Job, delay time.Duration, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exist, err := m.lockedJob(jb)
+	if err != nil {
+		return err
+	}
+	exist.lockedUntil = time.Time{}
+	exist.LockToken = ""
+	exist.RunAt = time.Now().Add(delay)
+	exist.LastError = reason
+
+	return nil
+}
+
+// lockedJob get job record if claim of job is actual
+func (m *Memory) lockedJob(jb models.Job) (*job, error) {
+	exist, ok := m.jobs[jb.ID]
+	if !ok || exist.LockToken == "" || exist.LockToken != jb.LockToken {
+		return nil, storage.ErrJobLockLost
+	}
+
+	return exist, nil
+}
+
+// BuryJob move claimed job to dead letters
+func (m *Memory) BuryJob(ctx context.Context, jb models.Job, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exist, err := m.lockedJob(jb)
+	if err != nil {
+		return err
+	}
+	delete(m.jobs, exist.ID)
+	delete(m.jobKeys, exist.Kind+"/"+exist.Key)
+	m.addDeadLetter(models.DeadLetter{
+		Kind:      exist.Kind,
+		Key:       exist.Key,
+		Payload:   exist.Payload,
+		Attempts:  exist.Attempts,
+		LastError: reason,
+	})
+
+	return nil
+}
+
+// AddDeadLetter put failed task in dead letters
+func (m *Memory) AddDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addDeadLetter(dl)
+
+	return nil
+}
+
+// addDeadLetter append dead letter without lock
+func (m *Memory) addDeadLetter(dl models.DeadLetter) {
+	m.deadSeq++
+	dl.ID = m.deadSeq
+	dl.FailedAt = time.Now()
+	m.deadLetters = append(m.deadLetters, dl)
+}
+
+// DeadLetters get last dead letters
+func (m *Memory) DeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var dls []models.DeadLetter
+	// Last dead letters first
+	for i := len(m.deadLetters) - 1; i >= 0 && len(dls) < 1000; i-- {
+		dls = append(dls, m.deadLetters[i])
+	}
+
+	return dls, nil
+}
+
+// ReplayDeadLetter move dead letter back to jobs queue
+func (m *Memory) ReplayDeadLetter(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, dl := range m.deadLetters {
+		if dl.ID != id {
+			continue
+		}
+		m.deadLetters = append(m.deadLetters[:i], m.deadLetters[i+1:]...)
+		m.enqueue(models.Job{Kind: dl.Kind, Key: dl.Key, Payload: dl.Payload})
+
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+// addOutbox put event to outbox without lock
+func (m *Memory) addOutbox(msg models.OutboxMessage) {
+	m.outboxSeq++
+	msg.ID = m.outboxSeq
+	msg.CreatedAt = time.Now()
+	m.outbox = append(m.outbox, msg)
+}
+
+// ReserveIdempotencyKey save record of new request with idempotency key
+func (m *Memory) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if stored, ok := m.idempotency[k]; ok {
+		abandoned := !stored.Done() && stored.RequestHash == rec.RequestHash && time.Since(stored.CreatedAt) > lease
+		if !abandoned {
+			return stored, false, nil
+		}
+	}
+	rec.Status = 0
+	rec.CreatedAt = time.Now()
+	m.idempotency[k] = rec
+
+	return rec, true, nil
+}
+
+// CompleteIdempotencyKey save response of request with idempotency key
+func (m *Memory) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if stored, ok := m.idempotency[k]; ok {
+		stored.Status = rec.Status
+		stored.ContentType = rec.ContentType
+		stored.Body = rec.Body
+		m.idempotency[k] = stored
+	}
+
+	return nil
+}
+
+// DeleteIdempotencyKey release key of user for new request
+func (m *Memory) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, idempotencyKey{userID, key})
+
+	return nil
+}
+
+// AddAudit put action of operator in audit log
+func (m *Memory) AddAudit(ctx context.Context, audit models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addAudit(audit)
+
+	return nil
+}
+
+// addAudit append action to audit log without lock
+func (m *Memory) addAudit(audit models.AuditEntry) {
+	m.auditSeq++
+	audit.ID = m.auditSeq
+	audit.CreatedAt = jsontime.JSONTime(time.Now())
+	m.audit = append(m.audit, audit)
+}
+
+// AuditLog get page of audit log
+func (m *Memory) AuditLog(ctx context.Context, flt models.AuditFilter) ([]models.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	// Last actions first
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		entry := m.audit[i]
+		if (flt.UserID > 0 && entry.UserID != flt.UserID) || (flt.After > 0 && entry.ID >= int64(flt.After)) {
+			continue
+		}
+		entries = append(entries, entry)
+		if flt.Limit > 0 && len(entries) == flt.Limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// Ping memory storage is always available
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Stats get counters of orders and withdrawals
+func (m *Memory) Stats(ctx context.Context) (models.Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := models.Stats{Orders: make(map[int]int)}
+	for _, ord := range m.orders {
+		stats.Orders[ord.status]++
+	}
+	for _, wd := range m.withdrawals {
+		if wd.status != models.WithdrawCompleted && wd.status != models.WithdrawRefunded {
+			stats.PendingWithdrawals++
+		}
+	}
+
+	return stats, nil
+}
+
+// Outbox get oldest undelivered events
+func (m *Memory) Outbox(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if limit > len(m.outbox) {
+		limit = len(m.outbox)
+	}
+	msgs := make([]models.OutboxMessage, limit)
+	copy(msgs, m.outbox)
+
+	return msgs, nil
+}
+
+// DeleteOutbox remove delivered event
+func (m *Memory) DeleteOutbox(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, msg := range m.outbox {
+		if msg.ID == id {
+			m.outbox = append(m.outbox[:i], m.outbox[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// TryLock take named lock, lock is shared by all users of storage
+func (m *Memory) TryLock(ctx context.Context, name string) (storage.Lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.locks[name]; ok {
+		return nil, false, nil
+	}
+	lck := &lock{m: m, name: name}
+	m.locks[name] = lck
+
+	return lck, true, nil
+}
+
+// Alive check lock is held
+func (l *lock) Alive(ctx context.Context) error {
+	l.m.mu.RLock()
+	defer l.m.mu.RUnlock()
+
+	if l.m.locks[l.name] != l {
+		return storage.ErrLockLost
+	}
+
+	return nil
+}
+
+// Release free lock
+func (l *lock) Release(ctx context.Context) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+
+	if l.m.locks[l.name] == l {
+		delete(l.m.locks, l.name)
+	}
+
+	return nil
+}
+
+// withdrawal find withdrawal by id without lock
+func (m *Memory) withdrawal(id int) *withdraw {
+	for _, wd := range m.withdrawals {
+		if wd.id == id {
+			return wd
+		}
+	}
+
+	return nil
+}
+
+// model convert withdraw record to model
+// Unfinished withdrawal has time of last change as processed time
+func (wd *withdraw) model() models.Withdraw {
+	processedAt := wd.processedAt
+	if processedAt.IsZero() {
+		processedAt = wd.updatedAt
+	}
+
+	return models.Withdraw{
+		ID:          wd.id,
+		UserID:      wd.userID,
+		OrderID:     wd.orderID,
+		Sum:         wd.points,
+		Status:      wd.status,
+		ProcessedAt: jsontime.JSONTime(processedAt),
+	}
+}
+
+// addEntry append entry to ledger without lock
+func (m *Memory) addEntry(userID int, entryType string, amount money.Amount, orderID string, withdrawalID int) {
+	m.ledger = append(m.ledger, models.LedgerEntry{
+		ID:           len(m.ledger) + 1,
+		UserID:       userID,
+		Type:         entryType,
+		Amount:       amount,
+		OrderID:      orderID,
+		WithdrawalID: withdrawalID,
+		CreatedAt:    jsontime.JSONTime(time.Now()),
+	})
+}
+
+// userModel convert user record to model
+func (m *Memory) userModel(usr *user) models.User {
+	return models.User{
+		UserID:    usr.id,
+		Login:     usr.login,
+		Points:    usr.points,
+		Withdrawn: usr.withdrawn,
+		Blocked:   usr.blocked,
+	}
+}
+
+// toModel convert order record to model
+func (m *Memory) toModel(ord *order) models.Order {
+	return models.Order{
+		ID:               strconv.Itoa(ord.id),
+		Code:             ord.code,
+		UserID:           ord.userID,
+		CheckStatus:      statusName(ord.status),
+		Accrual:          ord.accrual,
+		UploadedAt:       jsontime.JSONTime(ord.createdAt),
+		Attempts:         ord.attempts,
+		IsCheckDone:      ord.isCheckDone,
+		AvailForWithdraw: ord.availForWithdraw,
+	}
+}
+
+// containsInt check value in list
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsStatus check withdrawal status in list
+func containsStatus(list []models.WithdrawStatus, v models.WithdrawStatus) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// statusName return status name for order
+func statusName(status int) string {
+	switch status {
+	case models.PROCESSING:
+		return "PROCESSING"
+	case models.INVALID:
+		return "INVALID"
+	case models.PROCESSED:
+		return "PROCESSED"
+	default:
+		return "NEW"
+	}
+}
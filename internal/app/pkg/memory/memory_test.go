@@ -0,0 +1,334 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/outbox"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var _ storage.Storage = (*Memory)(nil)
+
+func TestMemory_Auth(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+
+	require.NoError(t, stg.Register(ctx, usr))
+	assert.ErrorIs(t, stg.Register(ctx, usr), storage.ErrLoginAlreadyExist)
+
+	ok, err := stg.HasAuth(ctx, usr)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = stg.HasAuth(ctx, models.User{Login: "test", Password: "wrong"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = stg.UserByLogin(ctx, "unknown")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	current, err := stg.UserByLogin(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, 1, current.UserID)
+	assert.Equal(t, "test", current.Login)
+}
+
+func TestMemory_LegacyPassword(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	assert.NotEqual(t, "secret", stg.users[1].password)
+
+	// Password saved before hashing was introduced
+	legacy := hex.EncodeToString([]byte("secret"))
+	stg.users[1].password = legacy
+
+	ok, err := stg.HasAuth(ctx, models.User{Login: "test", Password: "wrong"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, legacy, stg.users[1].password)
+
+	ok, err = stg.HasAuth(ctx, usr)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.NotEqual(t, legacy, stg.users[1].password)
+
+	ok, err = stg.HasAuth(ctx, usr)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemory_Sessions(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+
+	// Each device has own session
+	require.NoError(t, stg.AddSession(ctx, models.Session{ID: "first", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, stg.AddSession(ctx, models.Session{ID: "second", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, stg.RevokeSession(ctx, "first"))
+
+	ses, err := stg.SessionByID(ctx, "first")
+	require.NoError(t, err)
+	assert.True(t, ses.Revoked)
+
+	ses, err = stg.SessionByID(ctx, "second")
+	require.NoError(t, err)
+	assert.False(t, ses.Revoked)
+
+	_, err = stg.SessionByID(ctx, "unknown")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestMemory_OrderLifecycle(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	current, err := stg.UserByLogin(ctx, "test")
+	require.NoError(t, err)
+
+	_, err = stg.OrderByCode(ctx, 12345674)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	ord := models.Order{UserID: current.UserID, Code: "12345674"}
+	require.NoError(t, stg.PutOrder(ctx, ord))
+	assert.ErrorIs(t, stg.PutOrder(ctx, ord), storage.ErrOrderAlreadyExist)
+
+	// New order isn't checked by repeater while its event is delivered
+	orders, err := stg.OrdersForCheck(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	require.NoError(t, stg.SetStatus(ctx, 12345674, models.PROCESSING, 1, 0))
+	found, err := stg.OrderByCode(ctx, 12345674)
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSING", found.CheckStatus)
+	assert.Equal(t, 1, found.Attempts)
+
+	require.NoError(t, stg.AddPoints(ctx, current.UserID, 72998, 12345674))
+	found, err = stg.OrderByCode(ctx, 12345674)
+	require.NoError(t, err)
+	assert.True(t, found.IsCheckDone)
+	assert.Equal(t, money.Amount(72998), found.Accrual)
+
+	// Ended order don't change status
+	require.NoError(t, stg.SetStatus(ctx, 12345674, models.PROCESSING, 1, 0))
+	orders, err = stg.Orders(ctx, current.UserID, models.OrderFilter{})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "PROCESSED", orders[0].CheckStatus)
+
+	current, err = stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(72998), current.Points)
+}
+
+func TestMemory_LostOrderEvent(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+
+	// Event is removed from outbox once it's in channel of broker
+	chn := broker.NewChannel(zap.NewNop(), stg, broker.DefaultSubscriberConfig())
+	rly := outbox.New(zap.NewNop(), stg, outbox.DefaultConfig())
+	rly.Handle(models.TopicOrderCreated, func(ctx context.Context, msg models.OutboxMessage) error {
+		return chn.Publish(ctx, broker.Message{Kind: models.JobCheckOrder, Key: msg.Key})
+	})
+	delivered, err := rly.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	msgs, err := stg.Outbox(ctx, 10)
+	require.NoError(t, err)
+	require.Empty(t, msgs)
+
+	// Instance crashed before consumer read channel, order is checked by repeater
+	ord := stg.orders[stg.codes["12345674"]]
+	assert.WithinDuration(t, time.Now().Add(models.OrderRecoverAfter), ord.repeatAt, time.Second)
+	ord.repeatAt = ord.repeatAt.Add(-models.OrderRecoverAfter - time.Second)
+
+	orders, err := stg.OrdersForCheck(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "12345674", orders[0].Code)
+}
+
+func TestMemory_Withdraw(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.AddPoints(ctx, 1, 100, 12345674))
+
+	ord := models.Order{UserID: 1, ID: "2377225624", Code: "2377225624"}
+	require.NoError(t, stg.AddWithdraw(ctx, ord, 40))
+	// Order is paid once
+	assert.ErrorIs(t, stg.AddWithdraw(ctx, ord, 10), storage.ErrWithdrawAlreadyExist)
+
+	current, err := stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(60), current.Points)
+	assert.Equal(t, money.Amount(40), current.Withdrawn)
+
+	wds, err := stg.ActiveWithdrawals(ctx, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, wds, 1)
+	id := wds[0].ID
+
+	// Status is changed only from expected one
+	require.NoError(t, stg.SetWithdrawStatus(ctx, id, models.WithdrawNew, models.WithdrawProcessing))
+	assert.ErrorIs(t, stg.SetWithdrawStatus(ctx, id, models.WithdrawNew, models.WithdrawProcessing), storage.ErrWithdrawStatus)
+	wds, err = stg.ActiveWithdrawals(ctx, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, wds)
+	// Processing withdrawal is taken again when stale
+	wds, err = stg.ActiveWithdrawals(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, wds, 1)
+
+	require.NoError(t, stg.SetWithdrawStatus(ctx, id, models.WithdrawProcessing, models.WithdrawCompleted))
+	wd, err := stg.WithdrawalByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "2377225624", wd.OrderID)
+	assert.Equal(t, models.WithdrawCompleted, wd.Status)
+	// Only failed withdrawal is refunded
+	assert.ErrorIs(t, stg.RefundWithdrawal(ctx, id), storage.ErrWithdrawStatus)
+	_, err = stg.WithdrawalByID(ctx, id+1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	entries, err := stg.BalanceHistory(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.LedgerWithdrawal, entries[0].Type)
+	assert.Equal(t, money.Amount(-40), entries[0].Amount)
+	assert.Equal(t, "2377225624", entries[0].OrderID)
+	assert.Equal(t, models.LedgerAccrual, entries[1].Type)
+	assert.Equal(t, money.Amount(100), entries[1].Amount)
+	assert.Equal(t, "12345674", entries[1].OrderID)
+}
+
+func TestMemory_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(code int) {
+			defer wg.Done()
+			assert.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: strconv.Itoa(code)}))
+			assert.NoError(t, stg.AddPoints(ctx, 1, 1, code))
+			_, err := stg.Orders(ctx, 1, models.OrderFilter{})
+			assert.NoError(t, err)
+		}(i + 1)
+	}
+	wg.Wait()
+
+	orders, err := stg.Orders(ctx, 1, models.OrderFilter{})
+	require.NoError(t, err)
+	assert.Len(t, orders, 100)
+
+	current, err := stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(100), current.Points)
+}
+
+func TestMemory_AddWithdrawConcurrent(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+	usr := models.User{Login: "test", Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.AddPoints(ctx, 1, 100, 12345674))
+	// Repeated accrual don't add points
+	require.NoError(t, stg.AddPoints(ctx, 1, 100, 12345674))
+
+	var success, declined int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := stg.AddWithdraw(ctx, models.Order{UserID: 1, ID: strconv.Itoa(i)}, 1)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&success, 1)
+			case errors.Is(err, storage.ErrInsufficientFunds):
+				atomic.AddInt64(&declined, 1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(100), success)
+	assert.Equal(t, int64(200), declined)
+
+	current, err := stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(0), current.Points)
+	assert.Equal(t, money.Amount(100), current.Withdrawn)
+}
+
+func TestMemory_Jobs(t *testing.T) {
+	ctx := context.Background()
+	stg := New(zap.NewNop(), password.New(password.MinCost))
+
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "1"}))
+	// Same key isn't duplicated
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "1"}))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "2", RunAt: time.Now().Add(time.Hour)}))
+
+	jobs, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "1", jobs[0].Key)
+	assert.Equal(t, 1, jobs[0].Attempts)
+
+	// Claimed job is hidden for other workers
+	other, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, other)
+
+	require.NoError(t, stg.RetryJob(ctx, jobs[0], 0, "accrual error"))
+	// Retry release claim
+	assert.ErrorIs(t, stg.AckJob(ctx, jobs[0]), storage.ErrJobLockLost)
+
+	again, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+	assert.Equal(t, 2, again[0].Attempts)
+	assert.Equal(t, "accrual error", again[0].LastError)
+	require.NoError(t, stg.AckJob(ctx, again[0]))
+
+	// Job is claimed again after visibility timeout
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "3"}))
+	lost, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, lost, 1)
+	time.Sleep(5 * time.Millisecond)
+	reclaimed, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, reclaimed, 1)
+	assert.ErrorIs(t, stg.AckJob(ctx, lost[0]), storage.ErrJobLockLost)
+	require.NoError(t, stg.AckJob(ctx, reclaimed[0]))
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"time"
+)
+
+// statsTimeout max time of storage query on scrape
+const statsTimeout = 5 * time.Second
+
+// orderStatuses names of order statuses for labels
+var orderStatuses = map[int]string{
+	models.NEW:        "NEW",
+	models.PROCESSING: "PROCESSING",
+	models.INVALID:    "INVALID",
+	models.PROCESSED:  "PROCESSED",
+}
+
+// Depther describe broker with in-process buffers of messages
+type Depther interface {
+	// Depth return count of waiting messages by kind
+	Depth() map[string]int
+}
+
+// StatsSource describe storage with counters
+type StatsSource interface {
+	// Stats get counters of orders and withdrawals
+	Stats(ctx context.Context) (models.Stats, error)
+}
+
+// WatchDepth export depth of broker buffers on scrape
+func (m *Metrics) WatchDepth(src Depther) {
+	m.reg.MustRegister(&depthCollector{
+		src: src,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "broker", "queue_depth"),
+			"Messages waiting in broker channel by kind.",
+			[]string{"kind"},
+			nil,
+		),
+	})
+}
+
+// WatchStorage export counters of storage on scrape
+func (m *Metrics) WatchStorage(src StatsSource) {
+	m.reg.MustRegister(&statsCollector{
+		src: src,
+		orders: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "orders"),
+			"Orders by check status.",
+			[]string{"status"},
+			nil,
+		),
+		pending: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "withdrawals_pending"),
+			"Withdrawals which aren't completed or refunded.",
+			nil,
+			nil,
+		),
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stats_error"),
+			"Is last query of storage counters failed.",
+			nil,
+			nil,
+		),
+	})
+}
+
+// depthCollector read depth of broker buffers
+type depthCollector struct {
+	src  Depther
+	desc *prometheus.Desc
+}
+
+// Describe implement prometheus collector
+func (c *depthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implement prometheus collector
+func (c *depthCollector) Collect(ch chan<- prometheus.Metric) {
+	for kind, depth := range c.src.Depth() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depth), kind)
+	}
+}
+
+// statsCollector read counters of storage
+type statsCollector struct {
+	src     StatsSource
+	orders  *prometheus.Desc
+	pending *prometheus.Desc
+	errors  *prometheus.Desc
+}
+
+// Describe implement prometheus collector
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.orders
+	ch <- c.pending
+	ch <- c.errors
+}
+
+// Collect implement prometheus collector
+// Failed query don't break other metrics, it's reported by error gauge
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.src.Stats(ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.errors, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.GaugeValue, 0)
+
+	for status, name := range orderStatuses {
+		ch <- prometheus.MustNewConstMetric(c.orders, prometheus.GaugeValue, float64(stats.Orders[status]), name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(stats.PendingWithdrawals))
+}
@@ -0,0 +1,125 @@
+// Package metrics implement prometheus metrics of service
+// Collectors are registered in injected registry, so tests can check them in own registry
+// @author Sergey Vrulin (aka Alex Versus)
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// namespace prefix of all metrics
+const namespace = "gophermart"
+
+// Results of order check in accrual system except received statuses
+const (
+	CheckRateLimited = "rate_limited"
+	CheckError       = "error"
+	CheckUnknown     = "unknown"
+)
+
+// Names of background loops
+const (
+	LoopRepeater   = "repeater"
+	LoopWithdrawal = "withdrawal"
+)
+
+// Metrics collectors of service
+type Metrics struct {
+	reg           *prometheus.Registry
+	httpDuration  *prometheus.HistogramVec
+	checks        *prometheus.CounterVec
+	checkDuration prometheus.Histogram
+	loopDuration  *prometheus.HistogramVec
+}
+
+// New create collectors and register them in registry
+func New(reg *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		reg: reg,
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		checks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "accrual_checks_total",
+			Help:      "Order checks in accrual system by received status, rate limit or error.",
+		}, []string{"result"}),
+		checkDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "accrual_check_duration_seconds",
+			Help:      "Duration of requests to accrual system.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		loopDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "loop_iteration_duration_seconds",
+			Help:      "Duration of iterations of background loops.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"loop"}),
+	}
+	reg.MustRegister(m.httpDuration, m.checks, m.checkDuration, m.loopDuration)
+
+	return m
+}
+
+// Handler expose metrics of registry
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+// Middleware measure requests of router by route template
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			// Template don't grow labels by path params
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		m.httpDuration.
+			WithLabelValues(route, r.Method, strconv.Itoa(sw.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveCheck count result of order check and duration of request to accrual system
+func (m *Metrics) ObserveCheck(result string, d time.Duration) {
+	m.checks.WithLabelValues(result).Inc()
+	m.checkDuration.Observe(d.Seconds())
+}
+
+// ObserveLoop save duration of background loop iteration
+func (m *Metrics) ObserveLoop(loop string, d time.Duration) {
+	m.loopDuration.WithLabelValues(loop).Observe(d.Seconds())
+}
+
+// Check count of order checks with result
+func (m *Metrics) Check(result string) prometheus.Counter {
+	return m.checks.WithLabelValues(result)
+}
+
+// statusWriter remember status code of response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader save status code
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
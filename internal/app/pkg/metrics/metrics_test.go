@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// depthFunc depth of broker by function
+type depthFunc func() map[string]int
+
+func (f depthFunc) Depth() map[string]int {
+	return f()
+}
+
+// statsFunc storage counters by function
+type statsFunc func() (models.Stats, error)
+
+func (f statsFunc) Stats(ctx context.Context) (models.Stats, error) {
+	return f()
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	mtr := New(prometheus.NewRegistry())
+	rtr := mux.NewRouter()
+	rtr.Use(mtr.Middleware)
+	rtr.HandleFunc("/api/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	rtr.Handle("/metrics", mtr.Handler())
+
+	for _, target := range []string{"/api/orders/1", "/api/orders/2"} {
+		rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := ioutil.ReadAll(w.Body)
+	require.NoError(t, err)
+	// Requests are grouped by route template
+	assert.Contains(
+		t,
+		string(body),
+		`gophermart_http_request_duration_seconds_count{code="202",method="POST",route="/api/orders/{number}"} 2`,
+	)
+}
+
+func TestMetrics_Check(t *testing.T) {
+	mtr := New(prometheus.NewRegistry())
+	mtr.ObserveCheck(models.LoyalProcessed, time.Millisecond)
+	mtr.ObserveCheck(models.LoyalProcessed, time.Millisecond)
+	mtr.ObserveCheck(CheckRateLimited, time.Millisecond)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(mtr.Check(models.LoyalProcessed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(mtr.Check(CheckRateLimited)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(mtr.Check(CheckError)))
+}
+
+func TestMetrics_Watch(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mtr := New(reg)
+	mtr.WatchDepth(depthFunc(func() map[string]int {
+		return map[string]int{models.JobCheckOrder: 3}
+	}))
+	var statsErr error
+	mtr.WatchStorage(statsFunc(func() (models.Stats, error) {
+		return models.Stats{Orders: map[int]int{models.NEW: 2, models.PROCESSED: 5}, PendingWithdrawals: 1}, statsErr
+	}))
+
+	expected := `
+# HELP gophermart_broker_queue_depth Messages waiting in broker channel by kind.
+# TYPE gophermart_broker_queue_depth gauge
+gophermart_broker_queue_depth{kind="` + models.JobCheckOrder + `"} 3
+# HELP gophermart_orders Orders by check status.
+# TYPE gophermart_orders gauge
+gophermart_orders{status="INVALID"} 0
+gophermart_orders{status="NEW"} 2
+gophermart_orders{status="PROCESSED"} 5
+gophermart_orders{status="PROCESSING"} 0
+# HELP gophermart_stats_error Is last query of storage counters failed.
+# TYPE gophermart_stats_error gauge
+gophermart_stats_error 0
+# HELP gophermart_withdrawals_pending Withdrawals which aren't completed or refunded.
+# TYPE gophermart_withdrawals_pending gauge
+gophermart_withdrawals_pending 1
+`
+	names := []string{
+		"gophermart_broker_queue_depth",
+		"gophermart_orders",
+		"gophermart_stats_error",
+		"gophermart_withdrawals_pending",
+	}
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), names...))
+
+	// Failed storage query is reported without counters
+	statsErr = errors.New("storage is down")
+	expected = `
+# HELP gophermart_stats_error Is last query of storage counters failed.
+# TYPE gophermart_stats_error gauge
+gophermart_stats_error 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), names[1:]...))
+}
@@ -0,0 +1,110 @@
+// Package outbox implement relay of events from outbox table to broker
+// Events are written in one transaction with business data and delivered at least once
+package outbox
+
+import (
+	"context"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Handler deliver event to broker
+// Event can be delivered again, so consumers must be idempotent
+type Handler func(ctx context.Context, msg models.OutboxMessage) error
+
+// Config of relay
+type Config struct {
+	// Batch max count of events read at once
+	Batch int
+	// PollInterval pause between reads when outbox is empty or broker failed
+	PollInterval time.Duration
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		Batch:        100,
+		PollInterval: time.Second,
+	}
+}
+
+// Relay deliver events from outbox to handlers by topic
+// Only one relay must run for keep order of events
+type Relay struct {
+	lgr      *zap.Logger
+	stg      storage.Storage
+	cfg      Config
+	handlers map[string]Handler
+}
+
+// New constructor
+func New(lgr *zap.Logger, stg storage.Storage, cfg Config) *Relay {
+	return &Relay{
+		lgr:      lgr,
+		stg:      stg,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle set handler of topic events
+// Must be called before run
+func (r *Relay) Handle(topic string, h Handler) {
+	r.handlers[topic] = h
+}
+
+// Run deliver events until context is done
+func (r *Relay) Run(ctx context.Context) error {
+	r.lgr.Info("Outbox relay run")
+	defer r.lgr.Info("Outbox relay stop")
+
+	for {
+		delivered, err := r.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.lgr.Error("Outbox relay error", zap.Error(err))
+		}
+		// Outbox can have more events
+		if delivered == r.cfg.Batch && err == nil {
+			continue
+		}
+
+		select {
+		case <-time.After(r.cfg.PollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Relay deliver one batch of events, return count of delivered events
+// Delivery stop on first failed event, it's repeated on next call
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	msgs, err := r.stg.Outbox(ctx, r.cfg.Batch)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, msg := range msgs {
+		h, ok := r.handlers[msg.Topic]
+		if !ok {
+			// Event can't be delivered, so it's removed
+			r.lgr.Error("Handler of outbox topic not found", zap.String("topic", msg.Topic), zap.String("key", msg.Key))
+		} else if err := h(ctx, msg); err != nil {
+			r.lgr.Info(
+				"Outbox event isn't delivered, repeat later",
+				zap.String("topic", msg.Topic),
+				zap.String("key", msg.Key),
+				zap.Error(err),
+			)
+			return i, nil
+		}
+		// Event is delivered again if it isn't deleted
+		if err := r.stg.DeleteOutbox(ctx, msg.ID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/queue"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/withdrawal"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestRelay_Relay(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Register(ctx, models.User{Login: "test", Password: "secret"}))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.AddPoints(ctx, 1, 100, 12345674))
+	require.NoError(t, stg.AddWithdraw(ctx, models.Order{UserID: 1, ID: "2377225624"}, 40))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "79927398713"}))
+
+	jobs := broker.NewQueue(zap.NewNop(), stg, queue.DefaultConfig())
+	var orders []string
+	fail := true
+	rly := New(zap.NewNop(), stg, Config{Batch: 10, PollInterval: time.Millisecond})
+	rly.Handle(models.TopicOrderCreated, func(ctx context.Context, msg models.OutboxMessage) error {
+		if msg.Key == "79927398713" && fail {
+			return errors.New("broker is down")
+		}
+		orders = append(orders, msg.Key)
+		return nil
+	})
+	rly.Handle(models.TopicWithdrawalCreated, func(ctx context.Context, msg models.OutboxMessage) error {
+		return withdrawal.HandleEvent(ctx, jobs, msg)
+	})
+
+	// Delivery stop on failed event
+	delivered, err := rly.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"12345674"}, orders)
+
+	// Failed event is delivered on next call
+	fail = false
+	delivered, err = rly.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []string{"12345674", "79927398713"}, orders)
+
+	msgs, err := stg.Outbox(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	// Withdrawal is processed by message, repeated message don't change it
+	claimed, err := stg.ClaimJobs(ctx, models.JobWithdraw, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	msg := broker.Message{Kind: claimed[0].Kind, Key: claimed[0].Key, Payload: claimed[0].Payload}
+	wpr := withdrawal.New(zap.NewNop(), stg, withdrawal.NewFakeGateway(0), metrics.New(prometheus.NewRegistry()), withdrawal.DefaultConfig())
+	require.NoError(t, wpr.HandleMessage(ctx, msg))
+	require.NoError(t, wpr.HandleMessage(ctx, msg))
+
+	wds, err := stg.WithdrawsByUserID(ctx, 1, models.WithdrawFilter{})
+	require.NoError(t, err)
+	require.Len(t, wds, 1)
+	assert.Equal(t, models.WithdrawCompleted, wds[0].Status)
+}
+
+func TestRelay_UnknownTopic(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+
+	// Event without handler can't be delivered and don't block others
+	rly := New(zap.NewNop(), stg, DefaultConfig())
+	delivered, err := rly.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	msgs, err := stg.Outbox(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
@@ -0,0 +1,171 @@
+// Package pagination parse page, period and statuses of user lists from query
+// Lists are paged by opaque cursor, cursor of next page is returned in header
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLimit items on page if limit isn't defined
+const DefaultLimit = 100
+
+// MaxLimit max items on page
+const MaxLimit = 1000
+
+// HeaderNext header with cursor of next page
+const HeaderNext = "X-Next-Cursor"
+
+// dateLayout layout of date without time
+const dateLayout = "2006-01-02"
+
+// ErrBadQuery if query params of list are invalid
+var ErrBadQuery = errors.New("bad list query")
+
+// Page parse limit and cursor from query
+func Page(q url.Values) (models.Page, error) {
+	page := models.Page{Limit: DefaultLimit}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return page, ErrBadQuery
+		}
+		page.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		after, err := decode(v)
+		if err != nil {
+			return page, ErrBadQuery
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// Period parse from and to params in RFC3339 or date format
+// Date in to param include whole day
+func Period(q url.Values) (models.Period, error) {
+	var period models.Period
+	var err error
+	if v := q.Get("from"); v != "" {
+		if period.From, err = parseTime(v, false); err != nil {
+			return period, ErrBadQuery
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if period.To, err = parseTime(v, true); err != nil {
+			return period, ErrBadQuery
+		}
+	}
+	if !period.From.IsZero() && !period.To.IsZero() && !period.From.Before(period.To) {
+		return period, ErrBadQuery
+	}
+
+	return period, nil
+}
+
+// Statuses get status names from repeated or comma separated params
+func Statuses(q url.Values) []string {
+	var names []string
+	for _, v := range q["status"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// OrderFilter parse page, upload period and statuses of orders from query
+func OrderFilter(q url.Values) (models.OrderFilter, error) {
+	var flt models.OrderFilter
+	var err error
+	if flt.Page, err = Page(q); err != nil {
+		return flt, err
+	}
+	if flt.Period, err = Period(q); err != nil {
+		return flt, err
+	}
+	for _, name := range Statuses(q) {
+		status, ok := models.OrderStatusByName(name)
+		if !ok {
+			return flt, ErrBadQuery
+		}
+		flt.Statuses = append(flt.Statuses, status)
+	}
+
+	return flt, nil
+}
+
+// WithdrawFilter parse page, processed period and statuses of withdrawals from query
+func WithdrawFilter(q url.Values) (models.WithdrawFilter, error) {
+	var flt models.WithdrawFilter
+	var err error
+	if flt.Page, err = Page(q); err != nil {
+		return flt, err
+	}
+	if flt.Period, err = Period(q); err != nil {
+		return flt, err
+	}
+	for _, name := range Statuses(q) {
+		status, ok := models.WithdrawStatusByName(name)
+		if !ok {
+			return flt, ErrBadQuery
+		}
+		flt.Statuses = append(flt.Statuses, status)
+	}
+
+	return flt, nil
+}
+
+// SetNext write cursor of page after item
+func SetNext(w http.ResponseWriter, lastID int) {
+	w.Header().Set(HeaderNext, encode(lastID))
+}
+
+// encode identifier to cursor
+func encode(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// decode identifier from cursor
+func decode(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, ErrBadQuery
+	}
+
+	return id, nil
+}
+
+// parseTime parse time or date, end of day is used for date at end of period
+func parseTime(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, v, time.Local)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
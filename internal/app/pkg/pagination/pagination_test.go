@@ -0,0 +1,56 @@
+package pagination
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPage(t *testing.T) {
+	page, err := Page(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLimit, page.Limit)
+	assert.Equal(t, 0, page.After)
+
+	// Cursor of next page point after last item
+	w := httptest.NewRecorder()
+	SetNext(w, 42)
+	page, err = Page(url.Values{"limit": {"10"}, "cursor": {w.Header().Get(HeaderNext)}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, page.Limit)
+	assert.Equal(t, 42, page.After)
+
+	for _, q := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"1001"}},
+		{"limit": {"ten"}},
+		{"cursor": {"42"}},
+		{"cursor": {encode(-1)}},
+	} {
+		_, err = Page(q)
+		assert.ErrorIs(t, err, ErrBadQuery, q.Encode())
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	period, err := Period(url.Values{"from": {"2021-11-20T10:00:00Z"}, "to": {"2021-11-21"}})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC), period.From.UTC())
+	// Date at end of period include whole day
+	assert.Equal(t, time.Date(2021, 11, 22, 0, 0, 0, 0, time.Local), period.To)
+	assert.True(t, period.Contains(time.Date(2021, 11, 21, 23, 0, 0, 0, time.Local)))
+	assert.False(t, period.Contains(period.To))
+
+	_, err = Period(url.Values{"from": {"yesterday"}})
+	assert.ErrorIs(t, err, ErrBadQuery)
+	_, err = Period(url.Values{"from": {"2021-11-21"}, "to": {"2021-11-20"}})
+	assert.ErrorIs(t, err, ErrBadQuery)
+}
+
+func TestStatuses(t *testing.T) {
+	names := Statuses(url.Values{"status": {"new, Processing", "INVALID"}})
+	assert.Equal(t, []string{"NEW", "PROCESSING", "INVALID"}, names)
+}
@@ -0,0 +1,69 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"hash/fnv"
+)
+
+// sqlTryLock take session advisory lock without wait
+const sqlTryLock = "SELECT pg_try_advisory_lock($1)"
+
+// sqlUnlock release session advisory lock
+const sqlUnlock = "SELECT pg_advisory_unlock($1)"
+
+// advisoryLock session advisory lock held by dedicated connection
+// Lock is released by database when connection of died instance is closed
+type advisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// TryLock take named advisory lock without wait
+func (s *Pg) TryLock(ctx context.Context, name string) (storage.Lock, bool, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := lockKey(name)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, sqlTryLock, key).Scan(&ok); err != nil {
+		_ = conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, conn.Close()
+	}
+
+	return &advisoryLock{conn, key}, true, nil
+}
+
+// Alive check connection which hold lock
+func (l *advisoryLock) Alive(ctx context.Context) error {
+	return l.conn.PingContext(ctx)
+}
+
+// Release unlock and return connection to pool
+// Connection which can hold lock yet is discarded, lock is released by database on its close
+func (l *advisoryLock) Release(ctx context.Context) error {
+	if _, err := l.conn.ExecContext(ctx, sqlUnlock, l.key); err != nil {
+		// Bad connection is closed by pool instead of reuse
+		_ = l.conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		return err
+	}
+
+	return l.conn.Close()
+}
+
+// lockKey map lock name to advisory lock key
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+
+	return int64(h.Sum64())
+}
@@ -0,0 +1,69 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+// errUnlock fail of unlock query
+var errUnlock = errors.New("unlock failed")
+
+// failDriver open connections which fail all queries and count closed ones
+type failDriver struct {
+	closed int64
+}
+
+// Open implement driver interface
+func (d *failDriver) Open(name string) (driver.Conn, error) {
+	return &failConn{d}, nil
+}
+
+// failConn connection of fail driver
+type failConn struct {
+	drv *failDriver
+}
+
+// Prepare implement driver connection interface
+func (c *failConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errUnlock
+}
+
+// ExecContext fail query
+func (c *failConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return nil, errUnlock
+}
+
+// Close count closed connections
+func (c *failConn) Close() error {
+	atomic.AddInt64(&c.drv.closed, 1)
+	return nil
+}
+
+// Begin implement driver connection interface
+func (c *failConn) Begin() (driver.Tx, error) {
+	return nil, errUnlock
+}
+
+func TestAdvisoryLock_ReleaseFailed(t *testing.T) {
+	ctx := context.Background()
+	drv := &failDriver{}
+	sql.Register("pg_fail_unlock", drv)
+	db, err := sql.Open("pg_fail_unlock", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	lck := &advisoryLock{conn, lockKey("test")}
+
+	// Connection can hold lock yet, so it isn't returned to pool
+	assert.ErrorIs(t, lck.Release(ctx), errUnlock)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&drv.closed))
+	assert.Equal(t, 0, db.Stats().Idle)
+}
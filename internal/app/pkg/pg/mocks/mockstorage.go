@@ -7,8 +7,9 @@ import (
 	"database/sql"
 	mock "github.com/stretchr/testify/mock"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/pg"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/jsontime"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
 	"strconv"
 	"time"
 )
@@ -17,10 +18,10 @@ import (
 type MockStorage struct {
 	mock.Mock
 	storage    map[string]models.User
-	tokens     map[string]string
+	sessions   map[string]models.Session
 	orders     map[int]string
 	ordercodes map[int]int
-	userpoints map[int]float64
+	userpoints map[int]money.Amount
 }
 
 // Auth provides a mock function with given fields: u
@@ -42,32 +43,59 @@ func (_m *MockStorage) Register(ctx context.Context, u models.User) error {
 	}
 
 	if _, ok := _m.storage[u.Login]; ok {
-		return pg.ErrLoginAlreadyExist
+		return storage.ErrLoginAlreadyExist
 	}
+	u.UserID = len(_m.storage) + 1
 	_m.storage[u.Login] = u
 
 	return nil
 }
 
-// SetToken provides a mock function with given fields: u
-func (_m *MockStorage) SetToken(ctx context.Context, u models.User, t string) error {
-	if _m.tokens == nil {
-		_m.tokens = make(map[string]string)
+// UserByLogin get user from mock storage
+func (_m *MockStorage) UserByLogin(ctx context.Context, login string) (models.User, error) {
+	if usr, ok := _m.storage[login]; ok {
+		return usr, nil
 	}
-	_m.tokens[u.Login] = t
+	return models.User{}, storage.ErrUserNotFound
+}
+
+// UserByID get user from mock storage
+func (_m *MockStorage) UserByID(ctx context.Context, userID int) (models.User, error) {
+	for _, usr := range _m.storage {
+		if usr.UserID == userID {
+			usr.Points = _m.userpoints[userID]
+			return usr, nil
+		}
+	}
+	return models.User{}, storage.ErrUserNotFound
+}
+
+// AddSession put session in mock storage
+func (_m *MockStorage) AddSession(ctx context.Context, ses models.Session) error {
+	if _m.sessions == nil {
+		_m.sessions = make(map[string]models.Session)
+	}
+	_m.sessions[ses.ID] = ses
 
 	return nil
 }
 
-// UserByToken without logic
-func (_m *MockStorage) UserByToken(ctx context.Context, token string) (models.User, error) {
-	usr := models.User{}
-	for k, v := range _m.tokens {
-		if v == token {
-			usr.Login = k
-		}
+// SessionByID get session from mock storage
+func (_m *MockStorage) SessionByID(ctx context.Context, id string) (models.Session, error) {
+	if ses, ok := _m.sessions[id]; ok {
+		return ses, nil
 	}
-	return usr, nil
+	return models.Session{}, sql.ErrNoRows
+}
+
+// RevokeSession revoke session in mock storage
+func (_m *MockStorage) RevokeSession(ctx context.Context, id string) error {
+	if ses, ok := _m.sessions[id]; ok {
+		ses.Revoked = true
+		_m.sessions[id] = ses
+	}
+
+	return nil
 }
 
 // PutOrder put order in process for check status
@@ -77,7 +105,7 @@ func (_m *MockStorage) PutOrder(ctx context.Context, ord models.Order) error {
 	}
 	for _, v := range _m.orders {
 		if v == ord.Code {
-			return pg.ErrOrderAlreadyExist
+			return storage.ErrOrderAlreadyExist
 		}
 	}
 	_m.orders[ord.UserID] = ord.Code
@@ -100,7 +128,7 @@ func (_m *MockStorage) HasOrder(ctx context.Context, userID int, code int) bool
 }
 
 // SetStatus update status for order
-func (_m *MockStorage) SetStatus(ctx context.Context, orderCode int, status, timeout int, points float64) error {
+func (_m *MockStorage) SetStatus(ctx context.Context, orderCode int, status, timeout int, points money.Amount) error {
 	if _m.ordercodes == nil {
 		_m.ordercodes = make(map[int]int)
 	}
@@ -108,8 +136,13 @@ func (_m *MockStorage) SetStatus(ctx context.Context, orderCode int, status, tim
 	return nil
 }
 
+// PostponeCheck move next check of order
+func (_m *MockStorage) PostponeCheck(ctx context.Context, orderCode int, timeout int) error {
+	return nil
+}
+
 // AddPoints add points to user
-func (_m *MockStorage) AddPoints(ctx context.Context, userID int, points float64, orderCode int) error {
+func (_m *MockStorage) AddPoints(ctx context.Context, userID int, points money.Amount, orderCode int) error {
 	_m.SetStatus(ctx, orderCode, models.PROCESSED, 0, 20)
 	_m.userpoints[userID] += points
 
@@ -117,7 +150,7 @@ func (_m *MockStorage) AddPoints(ctx context.Context, userID int, points float64
 }
 
 // Orders get all orders by user
-func (_m *MockStorage) Orders(ctx context.Context, userID int) ([]models.Order, error) {
+func (_m *MockStorage) Orders(ctx context.Context, userID int, flt models.OrderFilter) ([]models.Order, error) {
 	var orders []models.Order
 
 	for k, v := range _m.orders {
@@ -150,7 +183,7 @@ func (_m *MockStorage) OrderByCode(ctx context.Context, code int) (models.Order,
 }
 
 // OrdersForCheck implement check orders mock
-func (_m *MockStorage) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
+func (_m *MockStorage) OrdersForCheck(ctx context.Context, limit int) ([]models.Order, error) {
 	var orders []models.Order
 	var userOrder models.Order
 	userOrder.UploadedAt = jsontime.JSONTime(time.Now())
@@ -161,15 +194,11 @@ func (_m *MockStorage) OrdersForCheck(ctx context.Context) ([]models.Order, erro
 	return orders, nil
 }
 
-func (_m *MockStorage) Withdraw(ctx context.Context, ord models.Order, points float64) error {
+func (_m *MockStorage) AddWithdraw(ctx context.Context, ord models.Order, points money.Amount) error {
 	return nil
 }
 
-func (_m *MockStorage) AddWithdraw(ctx context.Context, ord models.Order, points float64) error {
-	return nil
-}
-
-func (_m *MockStorage) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, error) {
+func (_m *MockStorage) ActiveWithdrawals(ctx context.Context, stale time.Duration, limit int) ([]models.Withdraw, error) {
 	var wds []models.Withdraw
 	var wd models.Withdraw
 	wds = append(wds, wd)
@@ -177,7 +206,19 @@ func (_m *MockStorage) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw
 	return wds, nil
 }
 
-func (_m *MockStorage) WithdrawsByUserID(ctx context.Context, userID int) ([]models.Withdraw, error) {
+func (_m *MockStorage) WithdrawalByID(ctx context.Context, id int) (models.Withdraw, error) {
+	return models.Withdraw{ID: id}, nil
+}
+
+func (_m *MockStorage) SetWithdrawStatus(ctx context.Context, id int, from, to models.WithdrawStatus) error {
+	return nil
+}
+
+func (_m *MockStorage) RefundWithdrawal(ctx context.Context, id int) error {
+	return nil
+}
+
+func (_m *MockStorage) WithdrawsByUserID(ctx context.Context, userID int, flt models.WithdrawFilter) ([]models.Withdraw, error) {
 	var wds []models.Withdraw
 	var wd models.Withdraw
 	wds = append(wds, wd)
@@ -185,6 +226,110 @@ func (_m *MockStorage) WithdrawsByUserID(ctx context.Context, userID int) ([]mod
 	return wds, nil
 }
 
+func (_m *MockStorage) BalanceHistory(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	for k, v := range _m.userpoints {
+		if k == userID {
+			entries = append(entries, models.LedgerEntry{
+				UserID:    k,
+				Type:      models.LedgerAccrual,
+				Amount:    v,
+				CreatedAt: jsontime.JSONTime(time.Now()),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+func (_m *MockStorage) Enqueue(ctx context.Context, job models.Job) error {
+	return nil
+}
+
+func (_m *MockStorage) ClaimJobs(ctx context.Context, kind string, limit int, visibility time.Duration) ([]models.Job, error) {
+	return nil, nil
+}
+
+func (_m *MockStorage) AckJob(ctx context.Context, job models.Job) error {
+	return nil
+}
+
+func (_m *MockStorage) RetryJob(ctx context.Context, job models.Job, delay time.Duration, reason string) error {
+	return nil
+}
+
+func (_m *MockStorage) BuryJob(ctx context.Context, job models.Job, reason string) error {
+	return nil
+}
+
+func (_m *MockStorage) AddDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	return nil
+}
+
+func (_m *MockStorage) DeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	return nil, nil
+}
+
+func (_m *MockStorage) ReplayDeadLetter(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (_m *MockStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	return rec, true, nil
+}
+
+func (_m *MockStorage) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	return nil
+}
+
+func (_m *MockStorage) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	return nil
+}
+
+func (_m *MockStorage) Outbox(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	return nil, nil
+}
+
+func (_m *MockStorage) DeleteOutbox(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (_m *MockStorage) Users(ctx context.Context, flt models.UserFilter) ([]models.User, error) {
+	return nil, nil
+}
+
+func (_m *MockStorage) BlockUser(ctx context.Context, userID int, blocked bool, audit models.AuditEntry) error {
+	return nil
+}
+
+func (_m *MockStorage) AdjustBalance(ctx context.Context, userID int, amount money.Amount, audit models.AuditEntry) error {
+	return nil
+}
+
+func (_m *MockStorage) ResetOrderCheck(ctx context.Context, code int, audit models.AuditEntry) (models.Order, error) {
+	return models.Order{}, nil
+}
+
+func (_m *MockStorage) AddAudit(ctx context.Context, audit models.AuditEntry) error {
+	return nil
+}
+
+func (_m *MockStorage) AuditLog(ctx context.Context, flt models.AuditFilter) ([]models.AuditEntry, error) {
+	return nil, nil
+}
+
+func (_m *MockStorage) Stats(ctx context.Context) (models.Stats, error) {
+	return models.Stats{}, nil
+}
+
+func (_m *MockStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (_m *MockStorage) TryLock(ctx context.Context, name string) (storage.Lock, bool, error) {
+	return nil, false, nil
+}
+
 func (_m *MockStorage) Close() {
 	return
 }
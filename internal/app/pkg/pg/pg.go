@@ -4,46 +4,105 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
 	"github.com/pressly/goose/v3"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/migrations"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/encoder"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
 	"go.uber.org/zap"
 	"time"
 )
 
+// execer common interface for db and transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 // Pg storage
 type Pg struct {
-	db *sql.DB
-	l  *zap.Logger
+	db  *sql.DB
+	l   *zap.Logger
+	hsr *password.Hasher
 }
 
-// ErrLoginAlreadyExist if login already exist in storage
-var ErrLoginAlreadyExist = errors.New("already exist")
+// sqlNewRecord for new record in db
+const sqlNewUser = "INSERT INTO users (id, login, password) VALUES (default, $1, $2)"
 
-// ErrUserNotFound if not found user by code
-var ErrUserNotFound = errors.New("user not exist")
+// sqlGetUserPassword get password hash of user
+const sqlGetUserPassword = "SELECT id, password FROM users WHERE login=$1"
 
-// ErrOrderAlreadyExist if found order code
-var ErrOrderAlreadyExist = errors.New("order exists")
+// sqlUpdatePassword replace password hash if it wasn't changed
+const sqlUpdatePassword = "UPDATE users SET password=$1 WHERE id=$2 AND password=$3"
 
-// sqlNewRecord for new record in db
-const sqlNewUser = "INSERT INTO users (id, login, password) VALUES (default, $1, $2)"
+// sqlGetUserByLogin get user by login
+const sqlGetUserByLogin = "SELECT id, login, points, withdrawn, blocked_at IS NOT NULL FROM users WHERE login=$1"
+
+// sqlGetUserByID get user by id
+const sqlGetUserByID = "SELECT id, login, points, withdrawn, blocked_at IS NOT NULL FROM users WHERE id=$1"
+
+// sqlGetUsers search users by part of login
+const sqlGetUsers = `
+	SELECT id, login, points, withdrawn, blocked_at IS NOT NULL
+	FROM users
+	WHERE ($1 = '' OR strpos(lower(login), lower($1)) > 0)
+	  AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT NULLIF($3, 0)
+`
+
+// sqlBlockUser set or clear block time of user
+const sqlBlockUser = `
+	UPDATE users SET blocked_at=CASE WHEN $2 THEN COALESCE(blocked_at, now()) END WHERE id=$1
+`
+
+// sqlGetUserPointsForUpdate lock user row and get balance
+const sqlGetUserPointsForUpdate = "SELECT points FROM users WHERE id=$1 FOR UPDATE"
 
-// sqlGetUser check user
-const sqlGetUser = "SELECT 1 FROM users WHERE login=$1 AND password=$2"
+// sqlNewSession create new session
+const sqlNewSession = "INSERT INTO sessions (id, user_id, expires_at) VALUES ($1, $2, $3)"
 
-// sqlUpdateToken for set delete flag
-const sqlUpdateToken = "UPDATE users SET auth_token=$1 WHERE login=$2"
+// sqlGetSession get session by id
+const sqlGetSession = "SELECT id, user_id, expires_at, revoked_at IS NOT NULL FROM sessions WHERE id=$1"
 
-// sqlCheckToken get user id by token
-const sqlCheckToken = "SELECT id, points, withdrawn FROM users WHERE auth_token=$1"
+// sqlRevokeSession set logout time of session
+const sqlRevokeSession = "UPDATE sessions SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL"
+
+// sqlRevokeUserSessions set logout time of all user sessions
+const sqlRevokeUserSessions = "UPDATE sessions SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL"
+
+// sqlReserveIdempotencyKey save new key, used key is taken over only if same request isn't finished after lease in ms
+const sqlReserveIdempotencyKey = `
+	INSERT INTO idempotency_keys (user_id, key, request_hash) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, key) DO UPDATE SET created_at=now()
+	WHERE idempotency_keys.status=0
+		AND idempotency_keys.request_hash=EXCLUDED.request_hash
+		AND idempotency_keys.created_at < now() - $4 * interval '1 millisecond'
+`
+
+// sqlGetIdempotencyKey get saved key with response
+const sqlGetIdempotencyKey = `
+	SELECT user_id, key, request_hash, status, content_type, body, created_at
+	FROM idempotency_keys
+	WHERE user_id=$1 AND key=$2
+`
+
+// sqlCompleteIdempotencyKey save response of request
+const sqlCompleteIdempotencyKey = `
+	UPDATE idempotency_keys SET status=$3, content_type=$4, body=$5 WHERE user_id=$1 AND key=$2
+`
+
+// sqlDeleteIdempotencyKey remove key
+const sqlDeleteIdempotencyKey = "DELETE FROM idempotency_keys WHERE user_id=$1 AND key=$2"
 
 // sqlNewOrder create new order
-const sqlNewOrder = "INSERT INTO orders (id, user_id, code, check_status) VALUES (default, $1, $2, $3)"
+const sqlNewOrder = "INSERT INTO orders (id, user_id, code, check_status, repeat_at) VALUES (default, $1, $2, $3, $4)"
+
+// sqlPostponeCheck move next check of order without attempt
+const sqlPostponeCheck = "UPDATE orders SET repeat_at=$2 WHERE code=$1 AND is_check_done=false"
 
 // sqlUpdateStatus update status order
 const sqlUpdateStatus = `
@@ -58,7 +117,7 @@ const sqlUpdateDoneStatus = `
 	accrual=$2, 
 	is_check_done=true, 
 	avail_for_withdraw=$4 
-	WHERE code=$3
+	WHERE code=$3 AND is_check_done=false
 `
 
 // sqlAddPoints update user points
@@ -67,22 +126,52 @@ const sqlAddPoints = "UPDATE users SET points=points+$1 WHERE id=$2"
 // sqlSubAvailPointsInOrder update user points in order
 const sqlSubAvailPointsInOrder = "UPDATE orders SET avail_for_withdraw=avail_for_withdraw-$1 WHERE id=$2"
 
-// sqlUserSubPoints update user points
-const sqlUserSubPoints = "UPDATE users SET points=points-$1, withdrawn=withdrawn+$2 WHERE id=$3"
+// sqlUserSubPoints update user points if balance is enough
+const sqlUserSubPoints = "UPDATE users SET points=points-$1, withdrawn=withdrawn+$2 WHERE id=$3 AND points>=$1"
 
 // sqlAddWithdrawToQueue add queue
-const sqlAddWithdrawToQueue = "INSERT INTO withdrawals (id, user_id, order_id, points) VALUES (default, $1, $2, $3)"
+const sqlAddWithdrawToQueue = "INSERT INTO withdrawals (id, user_id, order_number, points) VALUES (default, $1, $2, $3) RETURNING id"
+
+// sqlAddAdjustmentEntry add manual adjustment entry to ledger
+const sqlAddAdjustmentEntry = "INSERT INTO ledger (user_id, type, amount) VALUES ($1, $2, $3)"
+
+// sqlAddAccrualEntry add accrual entry to ledger by order code
+const sqlAddAccrualEntry = `
+	INSERT INTO ledger (user_id, type, amount, order_id)
+	SELECT $1, $2, $3, id FROM orders WHERE code=$4
+`
+
+// sqlAddWithdrawalEntry add withdrawal entry to ledger
+const sqlAddWithdrawalEntry = "INSERT INTO ledger (user_id, type, amount, withdrawal_id) VALUES ($1, $2, $3, $4)"
+
+// sqlGetLedgerByUserID get balance history of user
+const sqlGetLedgerByUserID = `
+	SELECT l.id, l.type, l.amount, COALESCE(o.code, w.order_number, ''), l.created_at
+	FROM ledger AS l
+	LEFT JOIN orders AS o ON o.id = l.order_id
+	LEFT JOIN withdrawals AS w ON w.id = l.withdrawal_id
+	WHERE l.user_id=$1
+	ORDER BY l.id DESC
+`
+
+// sqlSetWithdrawStatus move withdrawal from one status to other
+const sqlSetWithdrawStatus = `
+	UPDATE withdrawals
+	SET status=$3, updated_at=now(), processed_at=CASE WHEN $4 THEN now() ELSE processed_at END
+	WHERE id=$1 AND status=$2
+`
 
-// sqlWithdrawUpdate update status to withdraw
-const sqlWithdrawUpdate = `
-	UPDATE withdrawals 
-	SET status=1, processed_at=now()
-	WHERE user_id=$1 AND order_id=$2 AND points=$3
+// sqlRefundWithdrawal mark failed withdrawal as refunded
+const sqlRefundWithdrawal = `
+	UPDATE withdrawals SET status=$2, updated_at=now() WHERE id=$1 AND status=$3 RETURNING user_id, points
 `
 
+// sqlUserRefundPoints return points of withdrawal to user
+const sqlUserRefundPoints = "UPDATE users SET points=points+$1, withdrawn=withdrawn-$1 WHERE id=$2"
+
 // sqlGetOrders get all user orders
 const sqlGetOrders = `
-	SELECT code AS number,
+	SELECT id, code AS number,
 		   CASE
 			   WHEN check_status = 1 THEN 'PROCESSING'
 			   WHEN check_status = 2 THEN 'INVALID'
@@ -94,7 +183,12 @@ const sqlGetOrders = `
 		   accrual
 	FROM orders
 	WHERE user_id = $1
+	  AND ($2 = 0 OR id < $2)
+	  AND (COALESCE(cardinality($3::smallint[]), 0) = 0 OR check_status = ANY($3))
+	  AND ($4::timestamptz IS NULL OR created_at >= $4)
+	  AND ($5::timestamptz IS NULL OR created_at < $5)
 	ORDER BY id DESC
+	LIMIT NULLIF($6, 0)
 `
 
 // sqlGetOrder get order by code
@@ -108,32 +202,127 @@ const sqlGetOrder = `
 const sqlGetOrdersForCheck = `
 	SELECT code, user_id, check_attempts
 	FROM orders WHERE is_check_done=false
-	AND repeat_at < NOW() at time zone 'utc' LIMIT 1000
+	AND repeat_at < NOW() at time zone 'utc' LIMIT $1
+`
+
+// sqlGetOrderStatusForUpdate lock order row and get check status
+const sqlGetOrderStatusForUpdate = "SELECT check_status FROM orders WHERE code=$1 FOR UPDATE"
+
+// sqlResetOrderCheck return order to check in loyalty machine
+const sqlResetOrderCheck = `
+	UPDATE orders SET is_check_done=false, check_attempts=0, repeat_at=NOW() at time zone 'utc'
+	WHERE code=$1
+	RETURNING id, code, user_id, check_attempts
 `
 
 // sqlGetWithdrawals get withdrawals for withdraw
 const sqlGetWithdrawals = `
-	SELECT user_id, order_id, points FROM withdrawals WHERE status=0 ORDER BY processed_at DESC LIMIT 1000
+	SELECT id, user_id, order_number, points, status, COALESCE(processed_at, updated_at)
+	FROM withdrawals
+	WHERE status IN ($1, $2) OR (status=$3 AND updated_at < now() - $4 * interval '1 millisecond')
+	ORDER BY id
+	LIMIT $5
+`
+
+// sqlGetWithdrawalByID get withdrawal by id
+const sqlGetWithdrawalByID = `
+	SELECT id, user_id, order_number, points, status, COALESCE(processed_at, updated_at) FROM withdrawals WHERE id=$1
 `
 
 // sqlGetWithdrawalsByUserID get list withdrawal by user id
 const sqlGetWithdrawalsByUserID = `
-	SELECT w.points, o.code, processed_at,
-	 CASE
-			   WHEN status = 1 THEN 'PROCESSED'
-			   ELSE 'NEW'
-			   END
-				AS status
-	FROM withdrawals AS w
-	JOIN orders AS o ON o.id = w.order_id
-	WHERE w.user_id=$1 
-	ORDER BY processed_at DESC
+	SELECT id, points, order_number, COALESCE(processed_at, updated_at), status
+	FROM withdrawals
+	WHERE user_id=$1
+	  AND ($2 = 0 OR id < $2)
+	  AND (COALESCE(cardinality($3::smallint[]), 0) = 0 OR status = ANY($3))
+	  AND ($4::timestamptz IS NULL OR COALESCE(processed_at, updated_at) >= $4)
+	  AND ($5::timestamptz IS NULL OR COALESCE(processed_at, updated_at) < $5)
+	ORDER BY id DESC
+	LIMIT NULLIF($6, 0)
+`
+
+// sqlEnqueueJob add job or move run time of existing job earlier
+const sqlEnqueueJob = `
+	INSERT INTO jobs (kind, key, payload, run_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (kind, key) DO UPDATE SET run_at=LEAST(jobs.run_at, EXCLUDED.run_at)
+`
+
+// sqlClaimJobs lock ready jobs, jobs locked by other transactions are skipped
+const sqlClaimJobs = `
+	UPDATE jobs
+	SET locked_until=now() + $3 * interval '1 millisecond', lock_token=$4, attempts=attempts + 1
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE kind=$1 AND run_at<=now() AND (locked_until IS NULL OR locked_until<now())
+		ORDER BY run_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, kind, key, payload, attempts, run_at, lock_token, COALESCE(last_error, '')
+`
+
+// sqlAckJob delete done job
+const sqlAckJob = "DELETE FROM jobs WHERE id=$1 AND lock_token=$2"
+
+// sqlRetryJob release job and schedule next attempt
+const sqlRetryJob = `
+	UPDATE jobs
+	SET locked_until=NULL, lock_token=NULL, run_at=now() + $3 * interval '1 millisecond', last_error=$4
+	WHERE id=$1 AND lock_token=$2
+`
+
+// sqlBuryJob delete claimed job and return its data for dead letter
+const sqlBuryJob = "DELETE FROM jobs WHERE id=$1 AND lock_token=$2 RETURNING kind, key, payload, attempts"
+
+// sqlAddDeadLetter add failed task to dead letters
+const sqlAddDeadLetter = "INSERT INTO dead_letters (kind, key, payload, attempts, last_error) VALUES ($1, $2, $3, $4, $5)"
+
+// sqlGetDeadLetters get last dead letters
+const sqlGetDeadLetters = `
+	SELECT id, kind, key, payload, attempts, COALESCE(last_error, ''), failed_at
+	FROM dead_letters
+	ORDER BY id DESC
+	LIMIT 1000
 `
 
+// sqlDeleteDeadLetter delete dead letter and return its data for replay
+const sqlDeleteDeadLetter = "DELETE FROM dead_letters WHERE id=$1 RETURNING kind, key, payload"
+
+// sqlAddOutbox add event to outbox
+const sqlAddOutbox = "INSERT INTO outbox (topic, key, payload) VALUES ($1, $2, $3)"
+
+// sqlGetOutbox get oldest events of outbox
+const sqlGetOutbox = "SELECT id, topic, key, payload, created_at FROM outbox ORDER BY id LIMIT $1"
+
+// sqlDeleteOutbox delete delivered event
+const sqlDeleteOutbox = "DELETE FROM outbox WHERE id=$1"
+
+// sqlAddAudit add action of operator to audit log
+const sqlAddAudit = `
+	INSERT INTO audit_log (actor, action, user_id, target, reason, details) VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+// sqlGetAuditLog get actions of operators
+const sqlGetAuditLog = `
+	SELECT id, actor, action, COALESCE(user_id, 0), target, reason, details, created_at
+	FROM audit_log
+	WHERE ($1 = 0 OR user_id = $1)
+	  AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT NULLIF($3, 0)
+`
+
+// sqlCountOrders count orders by check status
+const sqlCountOrders = "SELECT check_status, count(*) FROM orders GROUP BY check_status"
+
+// sqlCountPendingWithdrawals count withdrawals which aren't finished
+const sqlCountPendingWithdrawals = "SELECT count(*) FROM withdrawals WHERE status IN ($1, $2, $3)"
+
 // New New new Pg with not null fields
-func New(ctx context.Context, l *zap.Logger, e *env.Env) (*Pg, error) {
+func New(ctx context.Context, l *zap.Logger, dsn string, hsr *password.Hasher) (*Pg, error) {
 	// Database init
-	connect, err := sql.Open("postgres", e.DatabaseDsn)
+	connect, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +336,7 @@ func New(ctx context.Context, l *zap.Logger, e *env.Env) (*Pg, error) {
 		panic(err)
 	}
 
-	return &Pg{connect, l}, nil
+	return &Pg{connect, l, hsr}, nil
 }
 
 // Close connection
@@ -160,13 +349,15 @@ func (s *Pg) Close() {
 
 // Register register new user in storage
 func (s *Pg) Register(ctx context.Context, user models.User) error {
-	if _, err := s.db.ExecContext(ctx, sqlNewUser, user.Login, user.HexPassword()); err != nil {
-		if err, ok := err.(*pq.Error); ok {
-			if err.Code == pgerrcode.UniqueViolation {
-				return ErrLoginAlreadyExist
-			}
-			return err
+	hash, err := s.hsr.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, sqlNewUser, user.Login, hash); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code == pgerrcode.UniqueViolation {
+			return storage.ErrLoginAlreadyExist
 		}
+		return err
 	}
 
 	return nil
@@ -174,84 +365,257 @@ func (s *Pg) Register(ctx context.Context, user models.User) error {
 
 // HasAuth search user in storage
 func (s *Pg) HasAuth(ctx context.Context, u models.User) (bool, error) {
-	return s.rowExists(ctx, sqlGetUser, u.Login, u.HexPassword())
+	var id int
+	var hash string
+	err := s.db.QueryRowContext(ctx, sqlGetUserPassword, u.Login).Scan(&id, &hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	ok, needRehash := s.hsr.Compare(hash, u.Password)
+	if ok && needRehash {
+		// Legacy password replaced by new hash on successful login
+		s.rehash(ctx, id, hash, u.Password)
+	}
+
+	return ok, nil
 }
 
-// SetToken update token to user
-func (s *Pg) SetToken(ctx context.Context, u models.User, t string) error {
-	_, err := s.db.ExecContext(ctx, sqlUpdateToken, t, u.Login)
+// rehash save new hash of password, failure don't break authorization
+func (s *Pg) rehash(ctx context.Context, userID int, oldHash, pass string) {
+	hash, err := s.hsr.Hash(pass)
+	if err == nil {
+		_, err = s.db.ExecContext(ctx, sqlUpdatePassword, hash, userID, oldHash)
+	}
+	if err != nil {
+		s.l.Info("Password rehash error", zap.Int("user", userID), zap.Error(err))
+	}
+}
 
-	return err
+// UserByLogin get user by login
+func (s *Pg) UserByLogin(ctx context.Context, login string) (models.User, error) {
+	var usr models.User
+	err := s.db.QueryRowContext(ctx, sqlGetUserByLogin, login).
+		Scan(&usr.UserID, &usr.Login, &usr.Points, &usr.Withdrawn, &usr.Blocked)
+	if err != nil {
+		return usr, storage.ErrUserNotFound
+	}
+
+	return usr, nil
 }
 
-// UserByToken check if token exist
-func (s *Pg) UserByToken(ctx context.Context, t string) (models.User, error) {
+// UserByID get user with balance by id
+func (s *Pg) UserByID(ctx context.Context, userID int) (models.User, error) {
 	var usr models.User
-	err := s.db.QueryRowContext(ctx, sqlCheckToken, t).Scan(&usr.UserID, &usr.Points, &usr.Withdrawn)
+	err := s.db.QueryRowContext(ctx, sqlGetUserByID, userID).
+		Scan(&usr.UserID, &usr.Login, &usr.Points, &usr.Withdrawn, &usr.Blocked)
 	if err != nil {
-		return usr, ErrUserNotFound
+		return usr, storage.ErrUserNotFound
 	}
 
 	return usr, nil
 }
 
-// PutOrder put order in storage
-func (s *Pg) PutOrder(ctx context.Context, ord models.Order) error {
-	if _, err := s.db.ExecContext(ctx, sqlNewOrder, ord.UserID, ord.Code, models.NEW); err != nil {
-		if err, ok := err.(*pq.Error); ok {
-			if err.Code == pgerrcode.UniqueViolation {
-				return ErrOrderAlreadyExist
-			}
+// Users get page of users by part of login
+func (s *Pg) Users(ctx context.Context, flt models.UserFilter) ([]models.User, error) {
+	var users []models.User
+	rows, err := s.db.QueryContext(ctx, sqlGetUsers, flt.Login, flt.After, flt.Limit)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var usr models.User
+		if err := rows.Scan(&usr.UserID, &usr.Login, &usr.Points, &usr.Withdrawn, &usr.Blocked); err != nil {
+			return users, err
+		}
+		users = append(users, usr)
+	}
+
+	return users, rows.Err()
+}
+
+// BlockUser block or unblock user, sessions of blocked user are revoked
+func (s *Pg) BlockUser(ctx context.Context, userID int, blocked bool, audit models.AuditEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, sqlBlockUser, userID, blocked)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if blocked {
+		if _, err := tx.ExecContext(ctx, sqlRevokeUserSessions, userID); err != nil {
 			return err
 		}
 	}
+	if err := s.addAudit(ctx, tx, audit); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-// SetStatus update status to order by code
-func (s *Pg) SetStatus(ctx context.Context, orderCode int, status int, timeout int, points float64) error {
-	// If it's ended status
-	if status == models.PROCESSED || status == models.INVALID {
-		_, err := s.db.ExecContext(ctx, sqlUpdateDoneStatus, status, points, orderCode, points)
+// AdjustBalance change user balance by signed amount with ledger entry
+func (s *Pg) AdjustBalance(ctx context.Context, userID int, amount money.Amount, audit models.AuditEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var points money.Amount
+	if err := tx.QueryRowContext(ctx, sqlGetUserPointsForUpdate, userID).Scan(&points); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		return err
+	}
+	if points+amount < 0 {
+		return storage.ErrInsufficientFunds
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlAddAdjustmentEntry, userID, models.LedgerAdjustment, amount); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sqlAddPoints, amount, userID); err != nil {
+		return err
+	}
+	if err := s.addAudit(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddSession put new user session in storage
+func (s *Pg) AddSession(ctx context.Context, ses models.Session) error {
+	_, err := s.db.ExecContext(ctx, sqlNewSession, ses.ID, ses.UserID, ses.ExpiresAt)
+
+	return err
+}
+
+// SessionByID get session by identifier
+func (s *Pg) SessionByID(ctx context.Context, id string) (models.Session, error) {
+	var ses models.Session
+	err := s.db.QueryRowContext(ctx, sqlGetSession, id).Scan(&ses.ID, &ses.UserID, &ses.ExpiresAt, &ses.Revoked)
+
+	return ses, err
+}
+
+// RevokeSession mark session as revoked
+func (s *Pg) RevokeSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, sqlRevokeSession, id)
+
+	return err
+}
+
+// PutOrder put order and its event in storage
+func (s *Pg) PutOrder(ctx context.Context, ord models.Order) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Order is found by repeater if its event is lost
+	repeatAt := time.Now().Add(models.OrderRecoverAfter).In(time.UTC)
+	if _, err := tx.ExecContext(ctx, sqlNewOrder, ord.UserID, ord.Code, models.NEW, repeatAt); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code == pgerrcode.UniqueViolation {
+			return storage.ErrOrderAlreadyExist
+		}
+		return err
+	}
+	if err := s.addOutbox(ctx, tx, models.NewOrderCreated(ord.Code)); err != nil {
 		return err
 	}
 
+	return tx.Commit()
+}
+
+// SetStatus update status to order by code
+func (s *Pg) SetStatus(ctx context.Context, orderCode int, status int, timeout int, points money.Amount) error {
+	_, err := s.setStatus(ctx, s.db, orderCode, status, timeout, points)
+
+	return err
+}
+
+// PostponeCheck move next check of order without attempt
+func (s *Pg) PostponeCheck(ctx context.Context, orderCode int, timeout int) error {
 	if timeout < 1 {
 		timeout = 1
 	}
 	repeatAt := time.Now().Add(time.Duration(timeout) * time.Second).In(time.UTC)
-	_, err := s.db.ExecContext(ctx, sqlUpdateStatus, status, orderCode, points, repeatAt)
+	_, err := s.db.ExecContext(ctx, sqlPostponeCheck, orderCode, repeatAt)
 
 	return err
 }
 
-// Check if exist record by query
-func (s *Pg) rowExists(ctx context.Context, query string, args ...interface{}) (bool, error) {
-	var exists bool
-	query = fmt.Sprintf("SELECT exists (%s)", query)
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
+// setStatus update status in db or transaction and return true if order was changed
+func (s *Pg) setStatus(ctx context.Context, ex execer, orderCode int, status int, timeout int, points money.Amount) (bool, error) {
+	var res sql.Result
+	var err error
+	// If it's ended status
+	if status == models.PROCESSED || status == models.INVALID {
+		res, err = ex.ExecContext(ctx, sqlUpdateDoneStatus, status, points, orderCode, points)
+	} else {
+		if timeout < 1 {
+			timeout = 1
+		}
+		repeatAt := time.Now().Add(time.Duration(timeout) * time.Second).In(time.UTC)
+		res, err = ex.ExecContext(ctx, sqlUpdateStatus, status, orderCode, points, repeatAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
 		return false, err
 	}
 
-	return exists, nil
+	return affected > 0, nil
 }
 
 // AddPoints add points to user and done check
-func (s *Pg) AddPoints(ctx context.Context, userID int, points float64, orderCode int) error {
-	tx, err := s.db.Begin()
+func (s *Pg) AddPoints(ctx context.Context, userID int, points money.Amount, orderCode int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
 	defer tx.Rollback()
 
-	if err := s.SetStatus(ctx, orderCode, models.PROCESSED, 0, points); err != nil {
+	// Order can be processed only once
+	changed, err := s.setStatus(ctx, tx, orderCode, models.PROCESSED, 0, points)
+	if err != nil {
 		return err
 	}
+	if !changed {
+		return nil
+	}
 
-	_, err = s.db.ExecContext(ctx, sqlAddPoints, points, userID)
+	if _, err = tx.ExecContext(ctx, sqlAddAccrualEntry, userID, models.LedgerAccrual, points, orderCode); err != nil {
+		return err
+	}
+
+	// User points is cached sum of ledger
+	_, err = tx.ExecContext(ctx, sqlAddPoints, points, userID)
 	if err != nil {
 		return err
 	}
@@ -260,27 +624,33 @@ func (s *Pg) AddPoints(ctx context.Context, userID int, points float64, orderCod
 }
 
 // Orders get user orders list
-func (s *Pg) Orders(ctx context.Context, userID int) ([]models.Order, error) {
+func (s *Pg) Orders(ctx context.Context, userID int, flt models.OrderFilter) ([]models.Order, error) {
 	var orders []models.Order
-	rows, err := s.db.QueryContext(ctx, sqlGetOrders, userID)
-	if err != nil {
-		return orders, err
-	}
-
-	err = rows.Err()
+	rows, err := s.db.QueryContext(
+		ctx,
+		sqlGetOrders,
+		userID,
+		flt.After,
+		pq.Array(flt.Statuses),
+		nullTime(flt.From),
+		nullTime(flt.To),
+		flt.Limit,
+	)
 	if err != nil {
 		return orders, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var userOrder models.Order
-		err = rows.Scan(&userOrder.Code, &userOrder.CheckStatus, &userOrder.UploadedAt, &userOrder.Accrual)
+		userOrder := models.Order{UserID: userID}
+		err = rows.Scan(&userOrder.ID, &userOrder.Code, &userOrder.CheckStatus, &userOrder.UploadedAt, &userOrder.Accrual)
 		if err != nil {
 			return orders, err
 		}
 		orders = append(orders, userOrder)
 	}
-	return orders, nil
+
+	return orders, rows.Err()
 }
 
 // OrderByCode get order by code
@@ -300,17 +670,13 @@ func (s *Pg) OrderByCode(ctx context.Context, code int) (models.Order, error) {
 }
 
 // OrdersForCheck get chunk for check in loyalty machine
-func (s *Pg) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
+func (s *Pg) OrdersForCheck(ctx context.Context, limit int) ([]models.Order, error) {
 	var orders []models.Order
-	rows, err := s.db.QueryContext(ctx, sqlGetOrdersForCheck)
-	if err != nil {
-		return orders, err
-	}
-
-	err = rows.Err()
+	rows, err := s.db.QueryContext(ctx, sqlGetOrdersForCheck, limit)
 	if err != nil {
 		return orders, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var userOrder models.Order
@@ -321,85 +687,524 @@ func (s *Pg) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
 		orders = append(orders, userOrder)
 	}
 
-	return orders, nil
+	return orders, rows.Err()
 }
 
-// AddWithdraw add withdraw to queue
-func (s *Pg) AddWithdraw(ctx context.Context, ord models.Order, points float64) error {
-	tx, err := s.db.Begin()
+// ResetOrderCheck return order to check in loyalty machine
+func (s *Pg) ResetOrderCheck(ctx context.Context, code int, audit models.AuditEntry) (models.Order, error) {
+	var ord models.Order
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ord, err
+	}
+	defer tx.Rollback()
+
+	var status int
+	if err := tx.QueryRowContext(ctx, sqlGetOrderStatusForUpdate, code).Scan(&status); err != nil {
+		return ord, err
+	}
+	// Processed order can't be checked again, otherwise points are added twice
+	if status == models.PROCESSED {
+		return ord, storage.ErrOrderProcessed
+	}
+
+	err = tx.QueryRowContext(ctx, sqlResetOrderCheck, code).Scan(&ord.ID, &ord.Code, &ord.UserID, &ord.Attempts)
+	if err != nil {
+		return ord, err
+	}
+	audit.UserID = ord.UserID
+	if err := s.addAudit(ctx, tx, audit); err != nil {
+		return ord, err
+	}
+
+	return ord, tx.Commit()
+}
+
+// AddWithdraw check user balance, debit points and add withdraw to queue
+func (s *Pg) AddWithdraw(ctx context.Context, ord models.Order, points money.Amount) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := s.db.ExecContext(ctx, sqlAddWithdrawToQueue, ord.UserID, ord.ID, points); err != nil {
+	// Conditional update lock user row and check balance atomically
+	res, err := tx.ExecContext(ctx, sqlUserSubPoints, points, points, ord.UserID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrInsufficientFunds
+	}
+
+	var withdrawalID int
+	if err := tx.QueryRowContext(ctx, sqlAddWithdrawToQueue, ord.UserID, ord.ID, points).Scan(&withdrawalID); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code == pgerrcode.UniqueViolation {
+			return storage.ErrWithdrawAlreadyExist
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlAddWithdrawalEntry, ord.UserID, models.LedgerWithdrawal, -points, withdrawalID); err != nil {
 		return err
 	}
 
-	_, err = s.db.ExecContext(ctx, sqlUserSubPoints, points, points, ord.UserID)
+	msg, err := models.NewWithdrawalCreated(models.WithdrawalEvent{
+		ID:      withdrawalID,
+		UserID:  ord.UserID,
+		OrderID: ord.ID,
+		Sum:     points,
+	})
 	if err != nil {
 		return err
 	}
+	if err := s.addOutbox(ctx, tx, msg); err != nil {
+		return err
+	}
 
 	return tx.Commit()
 }
 
-// Withdraw points from user account
-func (s *Pg) Withdraw(ctx context.Context, ord models.Order, points float64) error {
-	_, err := s.db.ExecContext(ctx, sqlWithdrawUpdate, ord.UserID, ord.ID, points)
+// ActiveWithdrawals get withdrawals which aren't finished
+func (s *Pg) ActiveWithdrawals(ctx context.Context, stale time.Duration, limit int) ([]models.Withdraw, error) {
+	var wds []models.Withdraw
+	rows, err := s.db.QueryContext(
+		ctx,
+		sqlGetWithdrawals,
+		models.WithdrawNew,
+		models.WithdrawFailed,
+		models.WithdrawProcessing,
+		stale.Milliseconds(),
+		limit,
+	)
+	if err != nil {
+		return wds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wd models.Withdraw
+		err = rows.Scan(&wd.ID, &wd.UserID, &wd.OrderID, &wd.Sum, &wd.Status, &wd.ProcessedAt)
+		if err != nil {
+			return wds, err
+		}
+		wds = append(wds, wd)
+	}
+
+	return wds, rows.Err()
+}
+
+// WithdrawalByID get withdrawal by identifier
+func (s *Pg) WithdrawalByID(ctx context.Context, id int) (models.Withdraw, error) {
+	var wd models.Withdraw
+	err := s.db.QueryRowContext(ctx, sqlGetWithdrawalByID, id).
+		Scan(&wd.ID, &wd.UserID, &wd.OrderID, &wd.Sum, &wd.Status, &wd.ProcessedAt)
+
+	return wd, err
+}
+
+// SetWithdrawStatus move withdrawal from one status to other
+func (s *Pg) SetWithdrawStatus(ctx context.Context, id int, from, to models.WithdrawStatus) error {
+	res, err := s.db.ExecContext(ctx, sqlSetWithdrawStatus, id, from, to, to == models.WithdrawCompleted)
 	if err != nil {
 		return err
 	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrWithdrawStatus
+	}
 
 	return nil
 }
 
-// ActiveWithdrawals get active withdrawals from list
-func (s *Pg) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, error) {
-	var wds []models.Withdraw
-	rows, err := s.db.QueryContext(ctx, sqlGetWithdrawals)
+// RefundWithdrawal return points of failed withdrawal to user
+func (s *Pg) RefundWithdrawal(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return wds, err
+		return err
 	}
+	defer tx.Rollback()
 
-	err = rows.Err()
+	var userID int
+	var points money.Amount
+	err = tx.QueryRowContext(ctx, sqlRefundWithdrawal, id, models.WithdrawRefunded, models.WithdrawFailed).Scan(&userID, &points)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrWithdrawStatus
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlUserRefundPoints, points, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sqlAddWithdrawalEntry, userID, models.LedgerReversal, points, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// WithdrawsByUserID get list of user withdrawals
+func (s *Pg) WithdrawsByUserID(ctx context.Context, userID int, flt models.WithdrawFilter) ([]models.Withdraw, error) {
+	statuses := make([]int, 0, len(flt.Statuses))
+	for _, status := range flt.Statuses {
+		statuses = append(statuses, int(status))
+	}
+
+	var wds []models.Withdraw
+	rows, err := s.db.QueryContext(
+		ctx,
+		sqlGetWithdrawalsByUserID,
+		userID,
+		flt.After,
+		pq.Array(statuses),
+		nullTime(flt.From),
+		nullTime(flt.To),
+		flt.Limit,
+	)
 	if err != nil {
 		return wds, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var wd models.Withdraw
-		err = rows.Scan(&wd.UserID, &wd.OrderID, &wd.Sum)
+		wd := models.Withdraw{UserID: userID}
+		err = rows.Scan(&wd.ID, &wd.Sum, &wd.OrderID, &wd.ProcessedAt, &wd.Status)
 		if err != nil {
 			return wds, err
 		}
 		wds = append(wds, wd)
 	}
 
-	return wds, nil
+	return wds, rows.Err()
 }
 
-// WithdrawsByUserID get list of user withdrawals
-func (s *Pg) WithdrawsByUserID(ctx context.Context, userID int) ([]models.Withdraw, error) {
-	var wds []models.Withdraw
-	rows, err := s.db.QueryContext(ctx, sqlGetWithdrawalsByUserID, userID)
+// BalanceHistory get ledger entries of user balance
+func (s *Pg) BalanceHistory(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	rows, err := s.db.QueryContext(ctx, sqlGetLedgerByUserID, userID)
 	if err != nil {
-		return wds, err
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := models.LedgerEntry{UserID: userID}
+		err = rows.Scan(&entry.ID, &entry.Type, &entry.Amount, &entry.OrderID, &entry.CreatedAt)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Enqueue put job in durable queue
+func (s *Pg) Enqueue(ctx context.Context, job models.Job) error {
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
 	}
+	_, err := s.db.ExecContext(ctx, sqlEnqueueJob, job.Kind, job.Key, job.Payload, job.RunAt)
 
-	err = rows.Err()
+	return err
+}
+
+// ClaimJobs lock ready jobs of kind for visibility timeout
+func (s *Pg) ClaimJobs(ctx context.Context, kind string, limit int, visibility time.Duration) ([]models.Job, error) {
+	var jobs []models.Job
+	rows, err := s.db.QueryContext(ctx, sqlClaimJobs, kind, limit, visibility.Milliseconds(), encoder.RandomString(32))
 	if err != nil {
-		return wds, err
+		return jobs, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var wd models.Withdraw
-		err = rows.Scan(&wd.Sum, &wd.OrderID, &wd.ProcessedAt, &wd.Status)
+		var job models.Job
+		err = rows.Scan(&job.ID, &job.Kind, &job.Key, &job.Payload, &job.Attempts, &job.RunAt, &job.LockToken, &job.LastError)
 		if err != nil {
-			return wds, err
+			return jobs, err
 		}
-		wds = append(wds, wd)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// AckJob remove done job from queue
+func (s *Pg) AckJob(ctx context.Context, job models.Job) error {
+	res, err := s.db.ExecContext(ctx, sqlAckJob, job.ID, job.LockToken)
+	if err != nil {
+		return err
+	}
+
+	return jobChanged(res)
+}
+
+// RetryJob release job and schedule next attempt after delay
+func (s *Pg) RetryJob(ctx context.Context, job models.Job, delay time.Duration, reason string) error {
+	res, err := s.db.ExecContext(ctx, sqlRetryJob, job.ID, job.LockToken, delay.Milliseconds(), reason)
+	if err != nil {
+		return err
+	}
+
+	return jobChanged(res)
+}
+
+// jobChanged return error if claim of job isn't actual
+func jobChanged(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrJobLockLost
+	}
+
+	return nil
+}
+
+// BuryJob move claimed job to dead letters
+func (s *Pg) BuryJob(ctx context.Context, job models.Job, reason string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	dl := models.DeadLetter{LastError: reason}
+	err = tx.QueryRowContext(ctx, sqlBuryJob, job.ID, job.LockToken).Scan(&dl.Kind, &dl.Key, &dl.Payload, &dl.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrJobLockLost
+		}
+		return err
+	}
+	if err := s.addDeadLetter(ctx, tx, dl); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddDeadLetter put failed task in dead letters
+func (s *Pg) AddDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	return s.addDeadLetter(ctx, s.db, dl)
+}
+
+// addDeadLetter put failed task in dead letters in db or transaction
+func (s *Pg) addDeadLetter(ctx context.Context, ex execer, dl models.DeadLetter) error {
+	_, err := ex.ExecContext(ctx, sqlAddDeadLetter, dl.Kind, dl.Key, dl.Payload, dl.Attempts, dl.LastError)
+
+	return err
+}
+
+// DeadLetters get last dead letters
+func (s *Pg) DeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	var dls []models.DeadLetter
+	rows, err := s.db.QueryContext(ctx, sqlGetDeadLetters)
+	if err != nil {
+		return dls, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dl models.DeadLetter
+		err = rows.Scan(&dl.ID, &dl.Kind, &dl.Key, &dl.Payload, &dl.Attempts, &dl.LastError, &dl.FailedAt)
+		if err != nil {
+			return dls, err
+		}
+		dls = append(dls, dl)
+	}
+
+	return dls, rows.Err()
+}
+
+// ReplayDeadLetter move dead letter back to jobs queue
+func (s *Pg) ReplayDeadLetter(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var job models.Job
+	if err := tx.QueryRowContext(ctx, sqlDeleteDeadLetter, id).Scan(&job.Kind, &job.Key, &job.Payload); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sqlEnqueueJob, job.Kind, job.Key, job.Payload, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addOutbox put event to outbox in db or transaction
+func (s *Pg) addOutbox(ctx context.Context, ex execer, msg models.OutboxMessage) error {
+	_, err := ex.ExecContext(ctx, sqlAddOutbox, msg.Topic, msg.Key, msg.Payload)
+
+	return err
+}
+
+// ReserveIdempotencyKey save record of new request with idempotency key
+func (s *Pg) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	res, err := s.db.ExecContext(ctx, sqlReserveIdempotencyKey, rec.UserID, rec.Key, rec.RequestHash, lease.Milliseconds())
+	if err != nil {
+		return rec, false, err
 	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return rec, false, err
+	}
+	if affected > 0 {
+		return rec, true, nil
+	}
+
+	var stored models.IdempotencyRecord
+	err = s.db.QueryRowContext(ctx, sqlGetIdempotencyKey, rec.UserID, rec.Key).Scan(
+		&stored.UserID,
+		&stored.Key,
+		&stored.RequestHash,
+		&stored.Status,
+		&stored.ContentType,
+		&stored.Body,
+		&stored.CreatedAt,
+	)
+
+	return stored, false, err
+}
+
+// CompleteIdempotencyKey save response of request with idempotency key
+func (s *Pg) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	_, err := s.db.ExecContext(ctx, sqlCompleteIdempotencyKey, rec.UserID, rec.Key, rec.Status, rec.ContentType, rec.Body)
+
+	return err
+}
+
+// DeleteIdempotencyKey release key of user for new request
+func (s *Pg) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	_, err := s.db.ExecContext(ctx, sqlDeleteIdempotencyKey, userID, key)
+
+	return err
+}
+
+// AddAudit put action of operator in audit log
+func (s *Pg) AddAudit(ctx context.Context, audit models.AuditEntry) error {
+	return s.addAudit(ctx, s.db, audit)
+}
+
+// addAudit put action of operator in audit log in db or transaction
+func (s *Pg) addAudit(ctx context.Context, ex execer, audit models.AuditEntry) error {
+	userID := sql.NullInt64{Int64: int64(audit.UserID), Valid: audit.UserID != 0}
+	_, err := ex.ExecContext(ctx, sqlAddAudit, audit.Actor, audit.Action, userID, audit.Target, audit.Reason, audit.Details)
+
+	return err
+}
+
+// AuditLog get page of audit log
+func (s *Pg) AuditLog(ctx context.Context, flt models.AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	rows, err := s.db.QueryContext(ctx, sqlGetAuditLog, flt.UserID, flt.After, flt.Limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.Actor,
+			&entry.Action,
+			&entry.UserID,
+			&entry.Target,
+			&entry.Reason,
+			&entry.Details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Outbox get oldest undelivered events
+func (s *Pg) Outbox(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	rows, err := s.db.QueryContext(ctx, sqlGetOutbox, limit)
+	if err != nil {
+		return msgs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.OutboxMessage
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &msg.CreatedAt); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, rows.Err()
+}
+
+// DeleteOutbox remove delivered event
+func (s *Pg) DeleteOutbox(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, sqlDeleteOutbox, id)
+
+	return err
+}
+
+// Stats get counters of orders and withdrawals
+func (s *Pg) Stats(ctx context.Context) (models.Stats, error) {
+	stats := models.Stats{Orders: make(map[int]int)}
+	rows, err := s.db.QueryContext(ctx, sqlCountOrders)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status, count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return stats, err
+		}
+		stats.Orders[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	err = s.db.QueryRowContext(
+		ctx,
+		sqlCountPendingWithdrawals,
+		models.WithdrawNew,
+		models.WithdrawProcessing,
+		models.WithdrawFailed,
+	).Scan(&stats.PendingWithdrawals)
+
+	return stats, err
+}
+
+// Ping check connect to database
+func (s *Pg) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
 
-	return wds, nil
+// nullTime convert zero time to null
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
@@ -0,0 +1,427 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestPg connect to test database or skip test
+func newTestPg(t *testing.T) *Pg {
+	dsn := os.Getenv("DATABASE_URI")
+	if dsn == "" {
+		t.Skip("DATABASE_URI not defined")
+	}
+
+	stg, err := New(context.Background(), zap.NewNop(), dsn, password.New(password.MinCost))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+
+	return stg
+}
+
+func TestPg_AddWithdrawConcurrent(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	usr := models.User{Login: "withdraw_" + suffix, Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	current, err := stg.UserByLogin(ctx, usr.Login)
+	require.NoError(t, err)
+
+	code := int(time.Now().UnixNano() % 1000000000)
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: current.UserID, Code: strconv.Itoa(code)}))
+	require.NoError(t, stg.AddPoints(ctx, current.UserID, 100, code))
+	// Repeated accrual don't add points
+	require.NoError(t, stg.AddPoints(ctx, current.UserID, 100, code))
+
+	var success, declined int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ord := models.Order{UserID: current.UserID, ID: suffix + strconv.Itoa(i)}
+			err := stg.AddWithdraw(ctx, ord, 1)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&success, 1)
+			case errors.Is(err, storage.ErrInsufficientFunds):
+				atomic.AddInt64(&declined, 1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(100), success)
+	assert.Equal(t, int64(200), declined)
+
+	current, err = stg.UserByID(ctx, current.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(0), current.Points)
+	assert.Equal(t, money.Amount(100), current.Withdrawn)
+
+	// Balance is equal to sum of ledger entries
+	entries, err := stg.BalanceHistory(ctx, current.UserID)
+	require.NoError(t, err)
+	assert.Len(t, entries, 101)
+	var sum money.Amount
+	for _, entry := range entries {
+		sum += entry.Amount
+	}
+	assert.Equal(t, current.Points, sum)
+}
+
+func TestPg_RefundWithdrawal(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	usr := models.User{Login: "refund_" + suffix, Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	current, err := stg.UserByLogin(ctx, usr.Login)
+	require.NoError(t, err)
+
+	code := int(time.Now().UnixNano() % 1000000000)
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: current.UserID, Code: strconv.Itoa(code)}))
+	require.NoError(t, stg.AddPoints(ctx, current.UserID, 100, code))
+	ord := models.Order{UserID: current.UserID, ID: suffix}
+	require.NoError(t, stg.AddWithdraw(ctx, ord, 40))
+	// Order is paid once
+	assert.ErrorIs(t, stg.AddWithdraw(ctx, ord, 10), storage.ErrWithdrawAlreadyExist)
+
+	// Withdrawal id is known from its event
+	msgs, err := stg.Outbox(ctx, 1000)
+	require.NoError(t, err)
+	var ev models.WithdrawalEvent
+	for _, msg := range msgs {
+		var cur models.WithdrawalEvent
+		if msg.Topic == models.TopicWithdrawalCreated && json.Unmarshal(msg.Payload, &cur) == nil && cur.UserID == current.UserID {
+			ev = cur
+		}
+	}
+	require.NotZero(t, ev.ID)
+
+	// Only failed withdrawal is refunded
+	assert.ErrorIs(t, stg.RefundWithdrawal(ctx, ev.ID), storage.ErrWithdrawStatus)
+	require.NoError(t, stg.SetWithdrawStatus(ctx, ev.ID, models.WithdrawNew, models.WithdrawProcessing))
+	assert.ErrorIs(t, stg.SetWithdrawStatus(ctx, ev.ID, models.WithdrawNew, models.WithdrawProcessing), storage.ErrWithdrawStatus)
+	require.NoError(t, stg.SetWithdrawStatus(ctx, ev.ID, models.WithdrawProcessing, models.WithdrawFailed))
+	require.NoError(t, stg.RefundWithdrawal(ctx, ev.ID))
+	assert.ErrorIs(t, stg.RefundWithdrawal(ctx, ev.ID), storage.ErrWithdrawStatus)
+
+	wd, err := stg.WithdrawalByID(ctx, ev.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawRefunded, wd.Status)
+	assert.Equal(t, suffix, wd.OrderID)
+
+	wds, err := stg.WithdrawsByUserID(ctx, current.UserID, models.WithdrawFilter{})
+	require.NoError(t, err)
+	require.Len(t, wds, 1)
+	assert.Equal(t, suffix, wds[0].OrderID)
+
+	current, err = stg.UserByID(ctx, current.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(100), current.Points)
+	assert.Equal(t, money.Amount(0), current.Withdrawn)
+}
+
+func TestPg_LegacyPassword(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	usr := models.User{Login: "legacy_" + strconv.FormatInt(time.Now().UnixNano(), 10), Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	// Password saved before hashing was introduced
+	legacy := hex.EncodeToString([]byte(usr.Password))
+	_, err := stg.db.ExecContext(ctx, "UPDATE users SET password=$1 WHERE login=$2", legacy, usr.Login)
+	require.NoError(t, err)
+
+	ok, err := stg.HasAuth(ctx, models.User{Login: usr.Login, Password: "wrong"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = stg.HasAuth(ctx, usr)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	var hash string
+	require.NoError(t, stg.db.QueryRowContext(ctx, "SELECT password FROM users WHERE login=$1", usr.Login).Scan(&hash))
+	assert.NotEqual(t, legacy, hash)
+
+	ok, err = stg.HasAuth(ctx, usr)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestPg_ClaimJobsConcurrent(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	// Own kind isolate test from jobs of running service
+	kind := "test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: kind, Key: strconv.Itoa(i)}))
+	}
+	// Same key isn't duplicated
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: kind, Key: "0"}))
+
+	var mu sync.Mutex
+	claimed := make(map[string]int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				jobs, err := stg.ClaimJobs(ctx, kind, 3, time.Minute)
+				if !assert.NoError(t, err) || len(jobs) == 0 {
+					return
+				}
+				for _, job := range jobs {
+					mu.Lock()
+					claimed[job.Key]++
+					mu.Unlock()
+					assert.NoError(t, stg.AckJob(ctx, job))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each job is claimed only once
+	assert.Len(t, claimed, 50)
+	for key, count := range claimed {
+		assert.Equal(t, 1, count, key)
+	}
+}
+
+func TestPg_RetryJob(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	kind := "test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: kind, Key: "1"}))
+
+	jobs, err := stg.ClaimJobs(ctx, kind, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.NoError(t, stg.RetryJob(ctx, jobs[0], 0, "accrual error"))
+	// Retry release claim
+	assert.ErrorIs(t, stg.AckJob(ctx, jobs[0]), storage.ErrJobLockLost)
+
+	again, err := stg.ClaimJobs(ctx, kind, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+	assert.Equal(t, 2, again[0].Attempts)
+	assert.Equal(t, "accrual error", again[0].LastError)
+	require.NoError(t, stg.AckJob(ctx, again[0]))
+}
+
+func TestPg_TryLock(t *testing.T) {
+	// Two instances share one database
+	first := newTestPg(t)
+	second := newTestPg(t)
+	ctx := context.Background()
+	name := "test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	lck, ok, err := first.TryLock(ctx, name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, lck.Alive(ctx))
+
+	_, ok, err = second.TryLock(ctx, name)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, lck.Release(ctx))
+	lck, ok, err = second.TryLock(ctx, name)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Lock of died instance is released by database
+	second.Close()
+	assert.Error(t, lck.Alive(ctx))
+	lck, ok, err = first.TryLock(ctx, name)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, lck.Release(ctx))
+}
+
+func TestPg_DeadLetters(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	kind := "test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: kind, Key: "1", Payload: []byte("payload")}))
+	jobs, err := stg.ClaimJobs(ctx, kind, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	require.NoError(t, stg.BuryJob(ctx, jobs[0], "accrual error"))
+	// Buried job isn't in queue
+	assert.ErrorIs(t, stg.BuryJob(ctx, jobs[0], "accrual error"), storage.ErrJobLockLost)
+
+	var dead models.DeadLetter
+	dls, err := stg.DeadLetters(ctx)
+	require.NoError(t, err)
+	for _, dl := range dls {
+		if dl.Kind == kind {
+			dead = dl
+		}
+	}
+	require.NotZero(t, dead.ID)
+	assert.Equal(t, "1", dead.Key)
+	assert.Equal(t, []byte("payload"), dead.Payload)
+	assert.Equal(t, 1, dead.Attempts)
+	assert.Equal(t, "accrual error", dead.LastError)
+
+	require.NoError(t, stg.ReplayDeadLetter(ctx, dead.ID))
+	assert.ErrorIs(t, stg.ReplayDeadLetter(ctx, dead.ID), sql.ErrNoRows)
+
+	jobs, err = stg.ClaimJobs(ctx, kind, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "1", jobs[0].Key)
+	require.NoError(t, stg.AckJob(ctx, jobs[0]))
+}
+
+func TestPg_Outbox(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	usr := models.User{Login: "outbox_" + suffix, Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	current, err := stg.UserByLogin(ctx, usr.Login)
+	require.NoError(t, err)
+
+	code := strconv.Itoa(int(time.Now().UnixNano() % 1000000000))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: current.UserID, Code: code}))
+	// Event isn't written if order isn't added
+	assert.ErrorIs(t, stg.PutOrder(ctx, models.Order{UserID: current.UserID, Code: code}), storage.ErrOrderAlreadyExist)
+
+	msgs, err := stg.Outbox(ctx, 1000)
+	require.NoError(t, err)
+	var found []models.OutboxMessage
+	for _, msg := range msgs {
+		if msg.Topic == models.TopicOrderCreated && msg.Key == code {
+			found = append(found, msg)
+		}
+	}
+	require.Len(t, found, 1)
+
+	require.NoError(t, stg.DeleteOutbox(ctx, found[0].ID))
+	msgs, err = stg.Outbox(ctx, 1000)
+	require.NoError(t, err)
+	for _, msg := range msgs {
+		assert.NotEqual(t, found[0].ID, msg.ID)
+	}
+}
+
+func TestPg_OrdersPage(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	userID := int(time.Now().UnixNano() % 1000000)
+	base := int(time.Now().UnixNano()%100000000) * 10
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: userID, Code: strconv.Itoa(base + i)}))
+	}
+	require.NoError(t, stg.SetStatus(ctx, base+1, models.INVALID, 0, 0))
+
+	// Last orders first
+	orders, err := stg.Orders(ctx, userID, models.OrderFilter{Page: models.Page{Limit: 2}})
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, strconv.Itoa(base+2), orders[0].Code)
+
+	after, err := strconv.Atoi(orders[1].ID)
+	require.NoError(t, err)
+	orders, err = stg.Orders(ctx, userID, models.OrderFilter{Page: models.Page{Limit: 2, After: after}})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, strconv.Itoa(base), orders[0].Code)
+
+	orders, err = stg.Orders(ctx, userID, models.OrderFilter{Statuses: []int{models.INVALID}})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "INVALID", orders[0].CheckStatus)
+
+	orders, err = stg.Orders(ctx, userID, models.OrderFilter{Period: models.Period{From: time.Now().Add(time.Hour)}})
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+}
+
+func TestPg_Admin(t *testing.T) {
+	stg := newTestPg(t)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	usr := models.User{Login: "admin_" + suffix, Password: "secret"}
+	require.NoError(t, stg.Register(ctx, usr))
+	current, err := stg.UserByLogin(ctx, usr.Login)
+	require.NoError(t, err)
+	require.NoError(t, stg.AddSession(ctx, models.Session{ID: suffix, UserID: current.UserID, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	users, err := stg.Users(ctx, models.UserFilter{Login: "ADMIN_" + suffix})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, current.UserID, users[0].UserID)
+
+	audit := models.AuditEntry{Actor: "operator", UserID: current.UserID, Reason: "test"}
+	audit.Action = models.AuditBalanceAdjust
+	assert.ErrorIs(t, stg.AdjustBalance(ctx, current.UserID, -1, audit), storage.ErrInsufficientFunds)
+	require.NoError(t, stg.AdjustBalance(ctx, current.UserID, 10, audit))
+	assert.ErrorIs(t, stg.AdjustBalance(ctx, -1, 10, audit), storage.ErrUserNotFound)
+
+	audit.Action = models.AuditUserBlock
+	require.NoError(t, stg.BlockUser(ctx, current.UserID, true, audit))
+	current, err = stg.UserByID(ctx, current.UserID)
+	require.NoError(t, err)
+	assert.True(t, current.Blocked)
+	assert.Equal(t, money.Amount(10), current.Points)
+	ses, err := stg.SessionByID(ctx, suffix)
+	require.NoError(t, err)
+	assert.True(t, ses.Revoked)
+
+	code := int(time.Now().UnixNano() % 1000000000)
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: current.UserID, Code: strconv.Itoa(code)}))
+	audit = models.AuditEntry{Actor: "operator", Action: models.AuditOrderRecheck, Target: strconv.Itoa(code)}
+	ord, err := stg.ResetOrderCheck(ctx, code, audit)
+	require.NoError(t, err)
+	assert.Equal(t, current.UserID, ord.UserID)
+	require.NoError(t, stg.AddPoints(ctx, current.UserID, 5, code))
+	_, err = stg.ResetOrderCheck(ctx, code, audit)
+	assert.ErrorIs(t, err, storage.ErrOrderProcessed)
+
+	entries, err := stg.AuditLog(ctx, models.AuditFilter{UserID: current.UserID})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.AuditOrderRecheck, entries[0].Action)
+	assert.Equal(t, models.AuditUserBlock, entries[1].Action)
+	assert.Equal(t, "test", entries[2].Reason)
+
+	history, err := stg.BalanceHistory(ctx, current.UserID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.LedgerAdjustment, history[1].Type)
+}
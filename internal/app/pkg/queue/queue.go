@@ -0,0 +1,193 @@
+// Package queue implement workers of durable job queue in storage
+// Jobs are claimed with visibility timeout, so several instances can share the work
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/graceful"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/pool"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"go.uber.org/zap"
+	"runtime"
+	"time"
+)
+
+// releaseTimeout max time of return of not handled job to queue
+const releaseTimeout = 5 * time.Second
+
+// errShutdown reason of job return to queue
+var errShutdown = errors.New("worker stopped")
+
+// Handler process claimed job, failed job is retried later
+type Handler func(ctx context.Context, job models.Job) error
+
+// Config of workers
+type Config struct {
+	// Workers count of parallel workers of kind, can be changed by Resize
+	Workers int
+	// Batch max count of jobs claimed by worker at once
+	Batch int
+	// PollInterval pause between claims when queue is empty
+	PollInterval time.Duration
+	// Visibility time while claimed job is hidden for other workers
+	// Must be longer than handling of batch
+	Visibility time.Duration
+	// Retry policy of failed jobs, job is moved to dead letters after max attempts
+	Retry retry.Exponential
+	// ShutdownTimeout time for current jobs to be handled after workers are stopped
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		Workers:      runtime.NumCPU(),
+		Batch:        1,
+		PollInterval: time.Second,
+		Visibility:   2 * time.Minute,
+		Retry: retry.Exponential{
+			Base:        time.Second,
+			Max:         10 * time.Minute,
+			MaxAttempts: 10,
+			Jitter:      0.2,
+		},
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Queue run workers for jobs in storage
+type Queue struct {
+	lgr  *zap.Logger
+	stg  storage.Storage
+	cfg  Config
+	pool *pool.Pool
+}
+
+// New constructor
+func New(lgr *zap.Logger, stg storage.Storage, cfg Config) *Queue {
+	return &Queue{lgr, stg, cfg, pool.New(cfg.Workers)}
+}
+
+// Resize change count of workers of each kind, stopped workers finish current jobs
+func (q *Queue) Resize(workers int) {
+	q.lgr.Info("Resize queue workers", zap.Int("from", q.pool.Size()), zap.Int("to", workers))
+	q.pool.Resize(workers)
+}
+
+// Run start workers for jobs of kind and block until context is done
+// Current jobs are handled after stop until shutdown timeout, then they are returned to queue
+func (q *Queue) Run(ctx context.Context, kind string, h Handler) error {
+	taskCtx, cancel := graceful.Context(ctx, q.cfg.ShutdownTimeout)
+	defer cancel()
+
+	return q.pool.Run(ctx, func(ctx context.Context, workID int) error {
+		return q.work(ctx, taskCtx, workID, kind, h)
+	})
+}
+
+// work claim and handle jobs until context is done
+func (q *Queue) work(ctx, taskCtx context.Context, workID int, kind string, h Handler) error {
+	q.lgr.Info("Queue worker run", zap.String("kind", kind), zap.Int("work id", workID))
+	defer q.lgr.Info("Queue worker stop", zap.String("kind", kind), zap.Int("work id", workID))
+
+	for {
+		claimed, err := q.process(ctx, taskCtx, kind, h)
+		if err != nil && ctx.Err() == nil {
+			q.lgr.Error("Claim jobs error", zap.Error(err))
+		}
+		// Queue can have more ready jobs
+		if claimed > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-time.After(q.cfg.PollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Process claim one batch of jobs and handle it, return count of claimed jobs
+func (q *Queue) Process(ctx context.Context, kind string, h Handler) (int, error) {
+	return q.process(ctx, ctx, kind, h)
+}
+
+// process claim batch until context is done and handle jobs with task context
+func (q *Queue) process(ctx, taskCtx context.Context, kind string, h Handler) (int, error) {
+	jobs, err := q.stg.ClaimJobs(ctx, kind, q.cfg.Batch, q.cfg.Visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, job := range jobs {
+		// Rest of batch isn't started after stop
+		if err := ctx.Err(); err != nil {
+			for _, rest := range jobs[i:] {
+				q.release(rest)
+			}
+			return len(jobs), err
+		}
+		q.handle(taskCtx, job, h)
+	}
+
+	return len(jobs), nil
+}
+
+// handle run handler and ack or retry job
+func (q *Queue) handle(ctx context.Context, job models.Job, h Handler) {
+	err := h(ctx, job)
+	if err == nil {
+		if err := q.stg.AckJob(ctx, job); err != nil {
+			q.lgr.Error("Ack job error", zap.Int64("job id", job.ID), zap.Error(err))
+		}
+		return
+	}
+	// Interrupted job is returned to queue
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		q.release(job)
+		return
+	}
+
+	if q.cfg.Retry.Exhausted(job.Attempts) {
+		q.lgr.Error(
+			"Job failed too many times, move to dead letters",
+			zap.String("kind", job.Kind),
+			zap.String("key", job.Key),
+			zap.Int("attempt", job.Attempts),
+			zap.Error(err),
+		)
+		if err := q.stg.BuryJob(ctx, job, err.Error()); err != nil {
+			q.lgr.Error("Bury job error", zap.Int64("job id", job.ID), zap.Error(err))
+		}
+		return
+	}
+
+	delay := q.cfg.Retry.Delay(job.Attempts)
+	q.lgr.Info(
+		"Job failed, retry later",
+		zap.String("kind", job.Kind),
+		zap.String("key", job.Key),
+		zap.Int("attempt", job.Attempts),
+		zap.Duration("delay", delay),
+		zap.Error(err),
+	)
+	if err := q.stg.RetryJob(ctx, job, delay, err.Error()); err != nil {
+		q.lgr.Error("Retry job error", zap.Int64("job id", job.ID), zap.Error(err))
+	}
+}
+
+// release return not handled job to queue at once, so other instance don't wait visibility timeout
+func (q *Queue) release(job models.Job) {
+	// Context of task is canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	q.lgr.Info("Return job to queue", zap.String("kind", job.Kind), zap.String("key", job.Key))
+	if err := q.stg.RetryJob(ctx, job, 0, errShutdown.Error()); err != nil {
+		q.lgr.Error("Return job error", zap.Int64("job id", job.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConfig config with short pauses
+func testConfig() Config {
+	return Config{
+		Workers:      4,
+		Batch:        2,
+		PollInterval: time.Millisecond,
+		Visibility:   time.Minute,
+		Retry:        retry.Exponential{Base: time.Millisecond, Max: 4 * time.Millisecond, MaxAttempts: 3},
+	}
+}
+
+func TestQueue_Process(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "1"}))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "2"}))
+
+	que := New(zap.NewNop(), stg, testConfig())
+	var handled []string
+	claimed, err := que.Process(ctx, models.JobCheckOrder, func(ctx context.Context, job models.Job) error {
+		handled = append(handled, job.Key)
+		if job.Key == "2" {
+			return errors.New("accrual error")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.ElementsMatch(t, []string{"1", "2"}, handled)
+
+	// Failed job is repeated after pause, done job is removed
+	time.Sleep(5 * time.Millisecond)
+	jobs, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "2", jobs[0].Key)
+	assert.Equal(t, "accrual error", jobs[0].LastError)
+}
+
+func TestQueue_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := New(zap.NewNop(), stg, testConfig()).Run(ctx, models.JobCheckOrder, func(ctx context.Context, job models.Job) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[job.Key]++
+			// First attempt of each job fails
+			if job.Attempts == 1 {
+				return errors.New("accrual error")
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	}()
+
+	keys := []string{"1", "2", "3", "4", "5"}
+	for _, key := range keys {
+		require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: key}))
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range keys {
+			if handled[key] < 2 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	// Each job is done after one retry
+	for _, key := range keys {
+		assert.Equal(t, 2, handled[key], key)
+	}
+}
+
+func TestQueue_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "1"}))
+
+	que := New(zap.NewNop(), stg, testConfig())
+	failed := func(ctx context.Context, job models.Job) error {
+		return errors.New("accrual error")
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+		claimed, err := que.Process(ctx, models.JobCheckOrder, failed)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+	}
+
+	// Job is moved to dead letters after last attempt
+	jobs, err := stg.ClaimJobs(ctx, models.JobCheckOrder, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	dls, err := stg.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dls, 1)
+	assert.Equal(t, "1", dls[0].Key)
+	assert.Equal(t, 3, dls[0].Attempts)
+	assert.Equal(t, "accrual error", dls[0].LastError)
+
+	// Replayed job is handled again
+	require.NoError(t, stg.ReplayDeadLetter(ctx, dls[0].ID))
+	claimed, err := que.Process(ctx, models.JobCheckOrder, func(ctx context.Context, job models.Job) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	dls, err = stg.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dls)
+}
+
+func TestQueue_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "fast"}))
+	require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: "slow"}))
+
+	cfg := testConfig()
+	cfg.Workers = 2
+	cfg.Batch = 1
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = New(zap.NewNop(), stg, cfg).Run(ctx, models.JobCheckOrder, func(ctx context.Context, job models.Job) error {
+			started <- struct{}{}
+			if job.Key == "fast" {
+				<-release
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+	<-started
+
+	// Jobs in work aren't interrupted by stop
+	cancel()
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers aren't stopped after shutdown timeout")
+	}
+
+	// Finished job is acked, interrupted one is available at once
+	jobs, err := stg.ClaimJobs(context.Background(), models.JobCheckOrder, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "slow", jobs[0].Key)
+	assert.Equal(t, errShutdown.Error(), jobs[0].LastError)
+}
+
+func TestQueue_Resize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	for _, key := range []string{"1", "2", "3"} {
+		require.NoError(t, stg.Enqueue(ctx, models.Job{Kind: models.JobCheckOrder, Key: key}))
+	}
+
+	cfg := testConfig()
+	cfg.Workers = 1
+	cfg.Batch = 1
+	que := New(zap.NewNop(), stg, cfg)
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	finished := make(chan struct{}, 3)
+	go func() {
+		_ = que.Run(ctx, models.JobCheckOrder, func(ctx context.Context, job models.Job) error {
+			started <- struct{}{}
+			<-release
+			finished <- struct{}{}
+			return nil
+		})
+	}()
+	<-started
+	select {
+	case <-started:
+		t.Fatal("job is started by second worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// New workers take jobs at once
+	que.Resize(3)
+	<-started
+	<-started
+
+	// Stopped workers finish current jobs
+	que.Resize(1)
+	close(release)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Fatal("job isn't finished after resize")
+		}
+	}
+}
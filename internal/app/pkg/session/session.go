@@ -0,0 +1,357 @@
+// Package session implement signed expiring session tokens for users
+// @author Vrulin Sergey (aka Alex Versus)
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/encoder"
+	ht "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/http"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token types
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// Default lifetime of tokens
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// sessionIDLength length of random session identifier
+const sessionIDLength = 32
+
+// evictInterval pause between removes of expired revoked and checked sessions
+const evictInterval = time.Minute
+
+// ErrInvalidToken if token malformed or signature incorrect
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrExpiredToken if token lifetime is over
+var ErrExpiredToken = errors.New("token expired")
+
+// ErrRevokedToken if session of token was revoked
+var ErrRevokedToken = errors.New("token revoked")
+
+// Store describe storage methods for sessions
+type Store interface {
+	// AddSession put new session in storage
+	AddSession(ctx context.Context, ses models.Session) error
+	// SessionByID get session by identifier
+	SessionByID(ctx context.Context, id string) (models.Session, error)
+	// RevokeSession mark session as revoked
+	RevokeSession(ctx context.Context, id string) error
+}
+
+// Claims payload of token
+type Claims struct {
+	UserID    int    `json:"uid"`
+	SessionID string `json:"sid"`
+	Type      string `json:"typ"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Tokens pair of access and refresh tokens
+type Tokens struct {
+	Access           string
+	AccessExpiresAt  time.Time
+	Refresh          string
+	RefreshExpiresAt time.Time
+}
+
+// SetCookies save tokens in response cookies
+func (t Tokens) SetCookies(w http.ResponseWriter) {
+	ht.SetCookie(w, ht.CookieUserIDName, t.Access, t.AccessExpiresAt)
+	ht.SetCookie(w, ht.CookieRefreshName, t.Refresh, t.RefreshExpiresAt)
+}
+
+// SetHeader put access token in authorization header for clients without cookies
+func (t Tokens) SetHeader(w http.ResponseWriter) {
+	w.Header().Set("Authorization", "Bearer "+t.Access)
+}
+
+// ClearCookies remove tokens from response cookies
+func ClearCookies(w http.ResponseWriter) {
+	ht.ClearCookie(w, ht.CookieUserIDName)
+	ht.ClearCookie(w, ht.CookieRefreshName)
+}
+
+// Manager issue and verify session tokens
+type Manager struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	stg        Store
+	// checkTTL time active session is trusted without storage, zero disable check of session in storage
+	checkTTL time.Duration
+	// revoked sessions in this instance until access token expires
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// access tokens of users expiring before time are revoked in this instance
+	revokedUsers map[int]time.Time
+	// sessions found active in storage until time of next check
+	active map[string]time.Time
+}
+
+// New constructor
+// Access tokens are checked in storage once per check ttl of session, zero check ttl disable it
+func New(secret []byte, accessTTL, refreshTTL, checkTTL time.Duration, stg Store) *Manager {
+	return &Manager{
+		secret:       secret,
+		accessTTL:    accessTTL,
+		refreshTTL:   refreshTTL,
+		stg:          stg,
+		checkTTL:     checkTTL,
+		revoked:      make(map[string]time.Time),
+		revokedUsers: make(map[int]time.Time),
+		active:       make(map[string]time.Time),
+	}
+}
+
+// Issue create new session for user and return tokens
+func (m *Manager) Issue(ctx context.Context, userID int) (Tokens, error) {
+	now := time.Now()
+	ses := models.Session{
+		ID:        encoder.RandomString(sessionIDLength),
+		UserID:    userID,
+		ExpiresAt: now.Add(m.refreshTTL),
+	}
+	if err := m.stg.AddSession(ctx, ses); err != nil {
+		return Tokens{}, err
+	}
+
+	return m.tokens(ses, now)
+}
+
+// Authenticate check access token and its session in storage
+// Session is checked once per check ttl, so revoke in other instances and block of user are seen by all instances
+// Without check ttl token is verified without storage, revoke in other instance is seen when access token expires
+func (m *Manager) Authenticate(ctx context.Context, token string) (Claims, error) {
+	claims, err := m.Verify(token)
+	if err != nil || m.checkTTL <= 0 {
+		return claims, err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	until, ok := m.active[claims.SessionID]
+	m.mu.Unlock()
+	if ok && now.Before(until) {
+		return claims, nil
+	}
+
+	ses, err := m.stg.SessionByID(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return claims, ErrInvalidToken
+		}
+		return claims, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ses.Revoked {
+		m.revoked[claims.SessionID] = now.Add(m.accessTTL)
+		return claims, ErrRevokedToken
+	}
+	m.active[claims.SessionID] = now.Add(m.checkTTL)
+
+	return claims, nil
+}
+
+// Verify check access token without storage
+// Token of session revoked in other instance is valid, Authenticate must be used for requests of users
+func (m *Manager) Verify(token string) (Claims, error) {
+	claims, err := m.parse(token, TypeAccess)
+	if err != nil {
+		return claims, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.revoked[claims.SessionID]; ok {
+		return claims, ErrRevokedToken
+	}
+	if until, ok := m.revokedUsers[claims.UserID]; ok && claims.ExpiresAt <= until.Unix() {
+		return claims, ErrRevokedToken
+	}
+
+	return claims, nil
+}
+
+// Refresh check refresh token in storage and issue new access token
+func (m *Manager) Refresh(ctx context.Context, token string) (Tokens, error) {
+	claims, err := m.parse(token, TypeRefresh)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	ses, err := m.stg.SessionByID(ctx, claims.SessionID)
+	if err != nil {
+		return Tokens{}, ErrInvalidToken
+	}
+	if ses.Revoked {
+		return Tokens{}, ErrRevokedToken
+	}
+	now := time.Now()
+	if !ses.ExpiresAt.After(now) {
+		return Tokens{}, ErrExpiredToken
+	}
+
+	return m.tokens(ses, now)
+}
+
+// Revoke session of token in storage and in current instance
+func (m *Manager) Revoke(ctx context.Context, claims Claims) error {
+	if err := m.stg.RevokeSession(ctx, claims.SessionID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Access token of session can't live longer than access ttl
+	m.revoked[claims.SessionID] = now.Add(m.accessTTL)
+	delete(m.active, claims.SessionID)
+
+	return nil
+}
+
+// RevokeUser reject access tokens of user issued before now in current instance
+// Sessions of user in storage must be revoked by caller, other instances see it on next check of session
+func (m *Manager) RevokeUser(userID int) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Tokens issued before now expire until this time
+	m.revokedUsers[userID] = now.Add(m.accessTTL)
+}
+
+// Run remove expired revoked and checked sessions until context is done
+func (m *Manager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.evict(time.Now())
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// evict remove entries expired before now
+func (m *Manager) evict(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, until := range m.revoked {
+		if until.Before(now) {
+			delete(m.revoked, id)
+		}
+	}
+	for id, until := range m.revokedUsers {
+		if until.Before(now) {
+			delete(m.revokedUsers, id)
+		}
+	}
+	for id, until := range m.active {
+		if until.Before(now) {
+			delete(m.active, id)
+		}
+	}
+}
+
+// Sign encode claims to token
+func (m *Manager) Sign(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + m.signature(encoded), nil
+}
+
+// tokens create access and refresh tokens for session
+func (m *Manager) tokens(ses models.Session, now time.Time) (Tokens, error) {
+	tkn := Tokens{
+		AccessExpiresAt:  now.Add(m.accessTTL),
+		RefreshExpiresAt: ses.ExpiresAt,
+	}
+	// Access token can't outlive session
+	if tkn.AccessExpiresAt.After(ses.ExpiresAt) {
+		tkn.AccessExpiresAt = ses.ExpiresAt
+	}
+
+	var err error
+	tkn.Access, err = m.Sign(Claims{
+		UserID:    ses.UserID,
+		SessionID: ses.ID,
+		Type:      TypeAccess,
+		ExpiresAt: tkn.AccessExpiresAt.Unix(),
+	})
+	if err != nil {
+		return tkn, err
+	}
+
+	tkn.Refresh, err = m.Sign(Claims{
+		UserID:    ses.UserID,
+		SessionID: ses.ID,
+		Type:      TypeRefresh,
+		ExpiresAt: tkn.RefreshExpiresAt.Unix(),
+	})
+
+	return tkn, err
+}
+
+// parse check signature, type and lifetime of token
+func (m *Manager) parse(token string, tokenType string) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(m.signature(parts[0]))) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.Type != tokenType || claims.UserID == 0 || claims.SessionID == "" {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// signature calculate hmac of payload
+func (m *Manager) signature(payload string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
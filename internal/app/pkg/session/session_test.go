@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	ses := New([]byte("secret"), time.Minute, time.Hour, 0, memory.New(zap.NewNop(), password.New(password.MinCost)))
+
+	tkn, err := ses.Issue(ctx, 1)
+	require.NoError(t, err)
+
+	claims, err := ses.Verify(tkn.Access)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.UserID)
+	assert.Equal(t, TypeAccess, claims.Type)
+
+	// Refresh token can't be used as access token
+	_, err = ses.Verify(tkn.Refresh)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	refreshed, err := ses.Refresh(ctx, tkn.Refresh)
+	require.NoError(t, err)
+	refreshedClaims, err := ses.Verify(refreshed.Access)
+	require.NoError(t, err)
+	assert.Equal(t, claims.SessionID, refreshedClaims.SessionID)
+
+	// Other device has own session
+	other, err := ses.Issue(ctx, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, ses.Revoke(ctx, claims))
+	_, err = ses.Verify(tkn.Access)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+	_, err = ses.Refresh(ctx, tkn.Refresh)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+
+	_, err = ses.Verify(other.Access)
+	assert.NoError(t, err)
+	_, err = ses.Refresh(ctx, other.Refresh)
+	assert.NoError(t, err)
+}
+
+func TestManager_Verify(t *testing.T) {
+	ses := New([]byte("secret"), time.Minute, time.Hour, 0, nil)
+
+	valid, err := ses.Sign(Claims{UserID: 1, SessionID: "id", Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	expired, err := ses.Sign(Claims{UserID: 1, SessionID: "id", Type: TypeAccess, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	require.NoError(t, err)
+	foreign, err := New([]byte("other"), time.Minute, time.Hour, 0, nil).
+		Sign(Claims{UserID: 1, SessionID: "id", Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "valid", token: valid},
+		{name: "expired", token: expired, err: ErrExpiredToken},
+		{name: "foreign secret", token: foreign, err: ErrInvalidToken},
+		{name: "tampered payload", token: parts[0] + "x." + parts[1], err: ErrInvalidToken},
+		{name: "no signature", token: parts[0], err: ErrInvalidToken},
+		{name: "empty", token: "", err: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ses.Verify(tt.token)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestManager_RevokeUser(t *testing.T) {
+	ses := New([]byte("secret"), time.Minute, time.Hour, 0, nil)
+
+	sign := func(userID int, ttl time.Duration) string {
+		tkn, err := ses.Sign(Claims{UserID: userID, SessionID: "id", Type: TypeAccess, ExpiresAt: time.Now().Add(ttl).Unix()})
+		require.NoError(t, err)
+		return tkn
+	}
+	blocked := sign(1, time.Minute)
+	other := sign(2, time.Minute)
+
+	ses.RevokeUser(1)
+
+	_, err := ses.Verify(blocked)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+	_, err = ses.Verify(other)
+	assert.NoError(t, err)
+	// Token issued after unblock lives longer than revoked ones
+	_, err = ses.Verify(sign(1, 2*time.Minute))
+	assert.NoError(t, err)
+}
+
+func TestManager_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Register(ctx, models.User{Login: "test", Password: "secret"}))
+	// Instances share storage
+	first := New([]byte("secret"), time.Minute, time.Hour, time.Minute, stg)
+	second := New([]byte("secret"), time.Minute, time.Hour, time.Minute, stg)
+
+	tkn, err := first.Issue(ctx, 1)
+	require.NoError(t, err)
+	claims, err := second.Authenticate(ctx, tkn.Access)
+	require.NoError(t, err)
+
+	// Active session is trusted until check ttl is over
+	require.NoError(t, first.Revoke(ctx, claims))
+	_, err = second.Authenticate(ctx, tkn.Access)
+	assert.NoError(t, err)
+	second.active[claims.SessionID] = time.Now()
+	_, err = second.Authenticate(ctx, tkn.Access)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+
+	// Sessions of user blocked in other instance are revoked
+	other, err := first.Issue(ctx, 1)
+	require.NoError(t, err)
+	_, err = second.Authenticate(ctx, other.Access)
+	require.NoError(t, err)
+	require.NoError(t, stg.BlockUser(ctx, 1, true, models.AuditEntry{}))
+	// Expired checks are evicted and session is checked again
+	second.evict(time.Now().Add(time.Minute + time.Second))
+	assert.Empty(t, second.active)
+	_, err = second.Authenticate(ctx, other.Access)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+
+	// Without check ttl token is verified without storage
+	stateless := New([]byte("secret"), time.Minute, time.Hour, 0, stg)
+	_, err = stateless.Authenticate(ctx, other.Access)
+	assert.NoError(t, err)
+
+	// Token of unknown session is invalid
+	forged, err := first.Sign(Claims{UserID: 1, SessionID: "unknown", Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	_, err = first.Authenticate(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
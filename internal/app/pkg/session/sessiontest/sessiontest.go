@@ -0,0 +1,27 @@
+// Package sessiontest implement helpers for tests of handlers with authenticated user
+package sessiontest
+
+import (
+	"context"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// Token issue access token of user and return manager which accept it
+// Session of token is stored in own memory storage and checked on each request
+func Token(t *testing.T, userID int) (*session.Manager, string) {
+	t.Helper()
+
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	ses := session.New([]byte("secret"), time.Minute, time.Hour, time.Nanosecond, stg)
+	tkn, err := ses.Issue(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ses, tkn.Access
+}
@@ -7,6 +7,12 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 	models "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+
+	money "github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+
+	storage "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
+
+	time "time"
 )
 
 // Storage is an autogenerated mock type for the Storage type
@@ -14,13 +20,27 @@ type Storage struct {
 	mock.Mock
 }
 
-// ActiveWithdrawals provides a mock function with given fields: ctx
-func (_m *Storage) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, error) {
-	ret := _m.Called(ctx)
+// AckJob provides a mock function with given fields: ctx, job
+func (_m *Storage) AckJob(ctx context.Context, job models.Job) error {
+	ret := _m.Called(ctx, job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Job) error); ok {
+		r0 = rf(ctx, job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ActiveWithdrawals provides a mock function with given fields: ctx, stale, limit
+func (_m *Storage) ActiveWithdrawals(ctx context.Context, stale time.Duration, limit int) ([]models.Withdraw, error) {
+	ret := _m.Called(ctx, stale, limit)
 
 	var r0 []models.Withdraw
-	if rf, ok := ret.Get(0).(func(context.Context) []models.Withdraw); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, int) []models.Withdraw); ok {
+		r0 = rf(ctx, stale, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Withdraw)
@@ -28,8 +48,8 @@ func (_m *Storage) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, er
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration, int) error); ok {
+		r1 = rf(ctx, stale, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -37,12 +57,40 @@ func (_m *Storage) ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, er
 	return r0, r1
 }
 
+// AddAudit provides a mock function with given fields: ctx, audit
+func (_m *Storage) AddAudit(ctx context.Context, audit models.AuditEntry) error {
+	ret := _m.Called(ctx, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AuditEntry) error); ok {
+		r0 = rf(ctx, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddDeadLetter provides a mock function with given fields: ctx, dl
+func (_m *Storage) AddDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	ret := _m.Called(ctx, dl)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.DeadLetter) error); ok {
+		r0 = rf(ctx, dl)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddPoints provides a mock function with given fields: ctx, userID, points, orderCode
-func (_m *Storage) AddPoints(ctx context.Context, userID int, points float64, orderCode int) error {
+func (_m *Storage) AddPoints(ctx context.Context, userID int, points money.Amount, orderCode int) error {
 	ret := _m.Called(ctx, userID, points, orderCode)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, int, float64, int) error); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, int, money.Amount, int) error); ok {
 		r0 = rf(ctx, userID, points, orderCode)
 	} else {
 		r0 = ret.Error(0)
@@ -51,12 +99,26 @@ func (_m *Storage) AddPoints(ctx context.Context, userID int, points float64, or
 	return r0
 }
 
+// AddSession provides a mock function with given fields: ctx, ses
+func (_m *Storage) AddSession(ctx context.Context, ses models.Session) error {
+	ret := _m.Called(ctx, ses)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Session) error); ok {
+		r0 = rf(ctx, ses)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddWithdraw provides a mock function with given fields: ctx, ord, points
-func (_m *Storage) AddWithdraw(ctx context.Context, ord models.Order, points float64) error {
+func (_m *Storage) AddWithdraw(ctx context.Context, ord models.Order, points money.Amount) error {
 	ret := _m.Called(ctx, ord, points)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, models.Order, float64) error); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, models.Order, money.Amount) error); ok {
 		r0 = rf(ctx, ord, points)
 	} else {
 		r0 = ret.Error(0)
@@ -65,11 +127,201 @@ func (_m *Storage) AddWithdraw(ctx context.Context, ord models.Order, points flo
 	return r0
 }
 
+// AdjustBalance provides a mock function with given fields: ctx, userID, amount, audit
+func (_m *Storage) AdjustBalance(ctx context.Context, userID int, amount money.Amount, audit models.AuditEntry) error {
+	ret := _m.Called(ctx, userID, amount, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, money.Amount, models.AuditEntry) error); ok {
+		r0 = rf(ctx, userID, amount, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AuditLog provides a mock function with given fields: ctx, flt
+func (_m *Storage) AuditLog(ctx context.Context, flt models.AuditFilter) ([]models.AuditEntry, error) {
+	ret := _m.Called(ctx, flt)
+
+	var r0 []models.AuditEntry
+	if rf, ok := ret.Get(0).(func(context.Context, models.AuditFilter) []models.AuditEntry); ok {
+		r0 = rf(ctx, flt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.AuditEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.AuditFilter) error); ok {
+		r1 = rf(ctx, flt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BalanceHistory provides a mock function with given fields: ctx, userID
+func (_m *Storage) BalanceHistory(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []models.LedgerEntry
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.LedgerEntry); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.LedgerEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BlockUser provides a mock function with given fields: ctx, userID, blocked, audit
+func (_m *Storage) BlockUser(ctx context.Context, userID int, blocked bool, audit models.AuditEntry) error {
+	ret := _m.Called(ctx, userID, blocked, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, bool, models.AuditEntry) error); ok {
+		r0 = rf(ctx, userID, blocked, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BuryJob provides a mock function with given fields: ctx, job, reason
+func (_m *Storage) BuryJob(ctx context.Context, job models.Job, reason string) error {
+	ret := _m.Called(ctx, job, reason)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Job, string) error); ok {
+		r0 = rf(ctx, job, reason)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimJobs provides a mock function with given fields: ctx, kind, limit, visibility
+func (_m *Storage) ClaimJobs(ctx context.Context, kind string, limit int, visibility time.Duration) ([]models.Job, error) {
+	ret := _m.Called(ctx, kind, limit, visibility)
+
+	var r0 []models.Job
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, time.Duration) []models.Job); ok {
+		r0 = rf(ctx, kind, limit, visibility)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Job)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, time.Duration) error); ok {
+		r1 = rf(ctx, kind, limit, visibility)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *Storage) Close() {
 	_m.Called()
 }
 
+// CompleteIdempotencyKey provides a mock function with given fields: ctx, rec
+func (_m *Storage) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	ret := _m.Called(ctx, rec)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.IdempotencyRecord) error); ok {
+		r0 = rf(ctx, rec)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeadLetters provides a mock function with given fields: ctx
+func (_m *Storage) DeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []models.DeadLetter
+	if rf, ok := ret.Get(0).(func(context.Context) []models.DeadLetter); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.DeadLetter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteIdempotencyKey provides a mock function with given fields: ctx, userID, key
+func (_m *Storage) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	ret := _m.Called(ctx, userID, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, string) error); ok {
+		r0 = rf(ctx, userID, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteOutbox provides a mock function with given fields: ctx, id
+func (_m *Storage) DeleteOutbox(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Enqueue provides a mock function with given fields: ctx, job
+func (_m *Storage) Enqueue(ctx context.Context, job models.Job) error {
+	ret := _m.Called(ctx, job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Job) error); ok {
+		r0 = rf(ctx, job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // HasAuth provides a mock function with given fields: ctx, user
 func (_m *Storage) HasAuth(ctx context.Context, user models.User) (bool, error) {
 	ret := _m.Called(ctx, user)
@@ -112,13 +364,13 @@ func (_m *Storage) OrderByCode(ctx context.Context, code int) (models.Order, err
 	return r0, r1
 }
 
-// Orders provides a mock function with given fields: ctx, userID
-func (_m *Storage) Orders(ctx context.Context, userID int) ([]models.Order, error) {
-	ret := _m.Called(ctx, userID)
+// Orders provides a mock function with given fields: ctx, userID, flt
+func (_m *Storage) Orders(ctx context.Context, userID int, flt models.OrderFilter) ([]models.Order, error) {
+	ret := _m.Called(ctx, userID, flt)
 
 	var r0 []models.Order
-	if rf, ok := ret.Get(0).(func(context.Context, int) []models.Order); ok {
-		r0 = rf(ctx, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, int, models.OrderFilter) []models.Order); ok {
+		r0 = rf(ctx, userID, flt)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Order)
@@ -126,8 +378,8 @@ func (_m *Storage) Orders(ctx context.Context, userID int) ([]models.Order, erro
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
-		r1 = rf(ctx, userID)
+	if rf, ok := ret.Get(1).(func(context.Context, int, models.OrderFilter) error); ok {
+		r1 = rf(ctx, userID, flt)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -135,13 +387,13 @@ func (_m *Storage) Orders(ctx context.Context, userID int) ([]models.Order, erro
 	return r0, r1
 }
 
-// OrdersForCheck provides a mock function with given fields: ctx
-func (_m *Storage) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
-	ret := _m.Called(ctx)
+// OrdersForCheck provides a mock function with given fields: ctx, limit
+func (_m *Storage) OrdersForCheck(ctx context.Context, limit int) ([]models.Order, error) {
+	ret := _m.Called(ctx, limit)
 
 	var r0 []models.Order
-	if rf, ok := ret.Get(0).(func(context.Context) []models.Order); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.Order); ok {
+		r0 = rf(ctx, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Order)
@@ -149,8 +401,8 @@ func (_m *Storage) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -158,6 +410,57 @@ func (_m *Storage) OrdersForCheck(ctx context.Context) ([]models.Order, error) {
 	return r0, r1
 }
 
+// Outbox provides a mock function with given fields: ctx, limit
+func (_m *Storage) Outbox(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	ret := _m.Called(ctx, limit)
+
+	var r0 []models.OutboxMessage
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.OutboxMessage); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.OutboxMessage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *Storage) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PostponeCheck provides a mock function with given fields: ctx, orderCode, timeout
+func (_m *Storage) PostponeCheck(ctx context.Context, orderCode int, timeout int) error {
+	ret := _m.Called(ctx, orderCode, timeout)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) error); ok {
+		r0 = rf(ctx, orderCode, timeout)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // PutOrder provides a mock function with given fields: ctx, ord
 func (_m *Storage) PutOrder(ctx context.Context, ord models.Order) error {
 	ret := _m.Called(ctx, ord)
@@ -172,6 +475,20 @@ func (_m *Storage) PutOrder(ctx context.Context, ord models.Order) error {
 	return r0
 }
 
+// RefundWithdrawal provides a mock function with given fields: ctx, id
+func (_m *Storage) RefundWithdrawal(ctx context.Context, id int) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Register provides a mock function with given fields: ctx, user
 func (_m *Storage) Register(ctx context.Context, user models.User) error {
 	ret := _m.Called(ctx, user)
@@ -186,12 +503,124 @@ func (_m *Storage) Register(ctx context.Context, user models.User) error {
 	return r0
 }
 
+// ReplayDeadLetter provides a mock function with given fields: ctx, id
+func (_m *Storage) ReplayDeadLetter(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReserveIdempotencyKey provides a mock function with given fields: ctx, rec, lease
+func (_m *Storage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	ret := _m.Called(ctx, rec, lease)
+
+	var r0 models.IdempotencyRecord
+	if rf, ok := ret.Get(0).(func(context.Context, models.IdempotencyRecord, time.Duration) models.IdempotencyRecord); ok {
+		r0 = rf(ctx, rec, lease)
+	} else {
+		r0 = ret.Get(0).(models.IdempotencyRecord)
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(context.Context, models.IdempotencyRecord, time.Duration) bool); ok {
+		r1 = rf(ctx, rec, lease)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, models.IdempotencyRecord, time.Duration) error); ok {
+		r2 = rf(ctx, rec, lease)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ResetOrderCheck provides a mock function with given fields: ctx, code, audit
+func (_m *Storage) ResetOrderCheck(ctx context.Context, code int, audit models.AuditEntry) (models.Order, error) {
+	ret := _m.Called(ctx, code, audit)
+
+	var r0 models.Order
+	if rf, ok := ret.Get(0).(func(context.Context, int, models.AuditEntry) models.Order); ok {
+		r0 = rf(ctx, code, audit)
+	} else {
+		r0 = ret.Get(0).(models.Order)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, models.AuditEntry) error); ok {
+		r1 = rf(ctx, code, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RetryJob provides a mock function with given fields: ctx, job, delay, reason
+func (_m *Storage) RetryJob(ctx context.Context, job models.Job, delay time.Duration, reason string) error {
+	ret := _m.Called(ctx, job, delay, reason)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Job, time.Duration, string) error); ok {
+		r0 = rf(ctx, job, delay, reason)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeSession provides a mock function with given fields: ctx, id
+func (_m *Storage) RevokeSession(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SessionByID provides a mock function with given fields: ctx, id
+func (_m *Storage) SessionByID(ctx context.Context, id string) (models.Session, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Session
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Session); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Session)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetStatus provides a mock function with given fields: ctx, orderCode, status, timeout, points
-func (_m *Storage) SetStatus(ctx context.Context, orderCode int, status int, timeout int, points float64) error {
+func (_m *Storage) SetStatus(ctx context.Context, orderCode int, status int, timeout int, points money.Amount) error {
 	ret := _m.Called(ctx, orderCode, status, timeout, points)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, int, int, int, float64) error); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, int, int, int, money.Amount) error); ok {
 		r0 = rf(ctx, orderCode, status, timeout, points)
 	} else {
 		r0 = ret.Error(0)
@@ -200,13 +629,13 @@ func (_m *Storage) SetStatus(ctx context.Context, orderCode int, status int, tim
 	return r0
 }
 
-// SetToken provides a mock function with given fields: ctx, user, token
-func (_m *Storage) SetToken(ctx context.Context, user models.User, token string) error {
-	ret := _m.Called(ctx, user, token)
+// SetWithdrawStatus provides a mock function with given fields: ctx, id, from, to
+func (_m *Storage) SetWithdrawStatus(ctx context.Context, id int, from models.WithdrawStatus, to models.WithdrawStatus) error {
+	ret := _m.Called(ctx, id, from, to)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, models.User, string) error); ok {
-		r0 = rf(ctx, user, token)
+	if rf, ok := ret.Get(0).(func(context.Context, int, models.WithdrawStatus, models.WithdrawStatus) error); ok {
+		r0 = rf(ctx, id, from, to)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -214,20 +643,92 @@ func (_m *Storage) SetToken(ctx context.Context, user models.User, token string)
 	return r0
 }
 
-// UserByToken provides a mock function with given fields: ctx, token
-func (_m *Storage) UserByToken(ctx context.Context, token string) (models.User, error) {
-	ret := _m.Called(ctx, token)
+// Stats provides a mock function with given fields: ctx
+func (_m *Storage) Stats(ctx context.Context) (models.Stats, error) {
+	ret := _m.Called(ctx)
+
+	var r0 models.Stats
+	if rf, ok := ret.Get(0).(func(context.Context) models.Stats); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(models.Stats)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TryLock provides a mock function with given fields: ctx, name
+func (_m *Storage) TryLock(ctx context.Context, name string) (storage.Lock, bool, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 storage.Lock
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.Lock); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(storage.Lock)
+		}
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(context.Context, string) bool); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, name)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// UserByID provides a mock function with given fields: ctx, userID
+func (_m *Storage) UserByID(ctx context.Context, userID int) (models.User, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 models.User
+	if rf, ok := ret.Get(0).(func(context.Context, int) models.User); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UserByLogin provides a mock function with given fields: ctx, login
+func (_m *Storage) UserByLogin(ctx context.Context, login string) (models.User, error) {
+	ret := _m.Called(ctx, login)
 
 	var r0 models.User
 	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
-		r0 = rf(ctx, token)
+		r0 = rf(ctx, login)
 	} else {
 		r0 = ret.Get(0).(models.User)
 	}
 
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, token)
+		r1 = rf(ctx, login)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -235,27 +736,57 @@ func (_m *Storage) UserByToken(ctx context.Context, token string) (models.User,
 	return r0, r1
 }
 
-// Withdraw provides a mock function with given fields: ctx, ord, points
-func (_m *Storage) Withdraw(ctx context.Context, ord models.Order, points float64) error {
-	ret := _m.Called(ctx, ord, points)
+// Users provides a mock function with given fields: ctx, flt
+func (_m *Storage) Users(ctx context.Context, flt models.UserFilter) ([]models.User, error) {
+	ret := _m.Called(ctx, flt)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, models.Order, float64) error); ok {
-		r0 = rf(ctx, ord, points)
+	var r0 []models.User
+	if rf, ok := ret.Get(0).(func(context.Context, models.UserFilter) []models.User); ok {
+		r0 = rf(ctx, flt)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.User)
+		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.UserFilter) error); ok {
+		r1 = rf(ctx, flt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// WithdrawsByUserID provides a mock function with given fields: ctx, userID
-func (_m *Storage) WithdrawsByUserID(ctx context.Context, userID int) ([]models.Withdraw, error) {
-	ret := _m.Called(ctx, userID)
+// WithdrawalByID provides a mock function with given fields: ctx, id
+func (_m *Storage) WithdrawalByID(ctx context.Context, id int) (models.Withdraw, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Withdraw
+	if rf, ok := ret.Get(0).(func(context.Context, int) models.Withdraw); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Withdraw)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WithdrawsByUserID provides a mock function with given fields: ctx, userID, flt
+func (_m *Storage) WithdrawsByUserID(ctx context.Context, userID int, flt models.WithdrawFilter) ([]models.Withdraw, error) {
+	ret := _m.Called(ctx, userID, flt)
 
 	var r0 []models.Withdraw
-	if rf, ok := ret.Get(0).(func(context.Context, int) []models.Withdraw); ok {
-		r0 = rf(ctx, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, int, models.WithdrawFilter) []models.Withdraw); ok {
+		r0 = rf(ctx, userID, flt)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Withdraw)
@@ -263,8 +794,8 @@ func (_m *Storage) WithdrawsByUserID(ctx context.Context, userID int) ([]models.
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
-		r1 = rf(ctx, userID)
+	if rf, ok := ret.Get(1).(func(context.Context, int, models.WithdrawFilter) error); ok {
+		r1 = rf(ctx, userID, flt)
 	} else {
 		r1 = ret.Error(1)
 	}
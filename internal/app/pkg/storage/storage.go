@@ -4,38 +4,156 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"time"
 )
 
+// ErrLoginAlreadyExist if login already exist in storage
+var ErrLoginAlreadyExist = errors.New("already exist")
+
+// ErrUserNotFound if not found user by code
+var ErrUserNotFound = errors.New("user not exist")
+
+// ErrOrderAlreadyExist if found order code
+var ErrOrderAlreadyExist = errors.New("order exists")
+
+// ErrOrderProcessed if points of order are already added to user
+var ErrOrderProcessed = errors.New("order processed")
+
+// ErrWithdrawAlreadyExist if order is already paid by withdrawal
+var ErrWithdrawAlreadyExist = errors.New("withdrawal exists")
+
+// ErrInsufficientFunds if user has not enough points for withdraw
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrWithdrawStatus if withdrawal isn't in expected status
+var ErrWithdrawStatus = errors.New("unexpected withdrawal status")
+
+// ErrJobLockLost if job visibility timeout is expired and job was claimed by other worker
+var ErrJobLockLost = errors.New("job lock lost")
+
+// ErrLockLost if distributed lock isn't held anymore
+var ErrLockLost = errors.New("lock lost")
+
+// Lock distributed lock held by instance
+type Lock interface {
+	// Alive return error if lock isn't held anymore
+	Alive(ctx context.Context) error
+	// Release free lock for other instances
+	Release(ctx context.Context) error
+}
+
 type Storage interface {
 	// Register put new user in storage
 	Register(ctx context.Context, user models.User) error
 	// HasAuth check user auth in storage
 	HasAuth(ctx context.Context, user models.User) (bool, error)
-	// SetToken set token to user
-	SetToken(ctx context.Context, user models.User, token string) error
-	// UserByToken check token in storage and get user id
-	UserByToken(ctx context.Context, token string) (models.User, error)
+	// UserByLogin get user by login
+	UserByLogin(ctx context.Context, login string) (models.User, error)
+	// UserByID get user with balance by id
+	UserByID(ctx context.Context, userID int) (models.User, error)
+	// Users get page of users by filter, last registered users first
+	Users(ctx context.Context, flt models.UserFilter) ([]models.User, error)
+	// BlockUser block or unblock user and write audit entry in same transaction
+	// Sessions of blocked user are revoked
+	// Must return error of user not found if user not exist
+	BlockUser(ctx context.Context, userID int, blocked bool, audit models.AuditEntry) error
+	// AdjustBalance change user balance by signed amount and write audit entry in same transaction
+	// Must return error of insufficient funds if balance becomes negative
+	// Must return error of user not found if user not exist
+	AdjustBalance(ctx context.Context, userID int, amount money.Amount, audit models.AuditEntry) error
+	// AddSession put new user session in storage
+	AddSession(ctx context.Context, ses models.Session) error
+	// SessionByID get session by identifier
+	SessionByID(ctx context.Context, id string) (models.Session, error)
+	// RevokeSession mark session as revoked
+	RevokeSession(ctx context.Context, id string) error
 	// PutOrder put order in process for check status
+	// Event of new order is written to outbox in same transaction
 	PutOrder(ctx context.Context, ord models.Order) error
 	// SetStatus update status for order
-	SetStatus(ctx context.Context, orderCode int, status int, timeout int, points float64) error
+	SetStatus(ctx context.Context, orderCode int, status int, timeout int, points money.Amount) error
+	// PostponeCheck move next check of order by timeout in seconds, attempt isn't counted
+	// Used while accrual system asks pause, so outage don't spend attempts of order
+	PostponeCheck(ctx context.Context, orderCode int, timeout int) error
 	// AddPoints add points to user
-	AddPoints(ctx context.Context, userID int, points float64, orderCode int) error
-	// Orders get all orders by user
-	Orders(ctx context.Context, userID int) ([]models.Order, error)
+	AddPoints(ctx context.Context, userID int, points money.Amount, orderCode int) error
+	// Orders get page of user orders by filter, last orders first
+	Orders(ctx context.Context, userID int, flt models.OrderFilter) ([]models.Order, error)
 	// OrderByCode get order by code
 	OrderByCode(ctx context.Context, code int) (models.Order, error)
-	// OrdersForCheck get all orders for check in loyalty machine
-	OrdersForCheck(ctx context.Context) ([]models.Order, error)
-	// Withdraw points from user account
-	Withdraw(ctx context.Context, ord models.Order, points float64) error
-	// AddWithdraw to queue
-	AddWithdraw(ctx context.Context, ord models.Order, points float64) error
-	// ActiveWithdrawals get list of new withdrawals
-	ActiveWithdrawals(ctx context.Context) ([]models.Withdraw, error)
-	// WithdrawsByUserID get list of user withdrawals
-	WithdrawsByUserID(ctx context.Context, userID int) ([]models.Withdraw, error)
+	// OrdersForCheck get orders ready for check in loyalty machine, at most limit
+	OrdersForCheck(ctx context.Context, limit int) ([]models.Order, error)
+	// ResetOrderCheck return order to check in loyalty machine and write audit entry in same transaction
+	// Audit entry is bound to owner of order
+	// Must return sql.ErrNoRows if order not found
+	// Must return error of order processed if points of order are already added
+	ResetOrderCheck(ctx context.Context, code int, audit models.AuditEntry) (models.Order, error)
+	// AddWithdraw debit user points and add withdraw to queue
+	// Must return error of insufficient funds if user balance less than points
+	// Must return error of withdrawal exist if order is already paid and not refunded
+	// Event of new withdrawal is written to outbox in same transaction
+	AddWithdraw(ctx context.Context, ord models.Order, points money.Amount) error
+	// ActiveWithdrawals get withdrawals which aren't finished
+	// Processing withdrawals are returned only if they aren't changed longer than stale, at most limit
+	ActiveWithdrawals(ctx context.Context, stale time.Duration, limit int) ([]models.Withdraw, error)
+	// WithdrawalByID get withdrawal by identifier
+	// Must return sql.ErrNoRows if withdrawal not found
+	WithdrawalByID(ctx context.Context, id int) (models.Withdraw, error)
+	// SetWithdrawStatus move withdrawal from one status to other
+	// Must return error of withdraw status if withdrawal isn't in from status
+	SetWithdrawStatus(ctx context.Context, id int, from, to models.WithdrawStatus) error
+	// RefundWithdrawal return points of failed withdrawal to user
+	// Must return error of withdraw status if withdrawal isn't failed
+	RefundWithdrawal(ctx context.Context, id int) error
+	// WithdrawsByUserID get page of user withdrawals by filter, last withdrawals first
+	WithdrawsByUserID(ctx context.Context, userID int, flt models.WithdrawFilter) ([]models.Withdraw, error)
+	// BalanceHistory get ledger entries of user balance
+	BalanceHistory(ctx context.Context, userID int) ([]models.LedgerEntry, error)
+	// Enqueue put job in durable queue
+	// Job with same kind and key isn't duplicated, only its run time can be moved earlier
+	Enqueue(ctx context.Context, job models.Job) error
+	// ClaimJobs lock ready jobs of kind for visibility timeout
+	// Job which isn't acked or retried until timeout is claimed again
+	ClaimJobs(ctx context.Context, kind string, limit int, visibility time.Duration) ([]models.Job, error)
+	// AckJob remove done job from queue
+	AckJob(ctx context.Context, job models.Job) error
+	// RetryJob release job and schedule next attempt after delay
+	RetryJob(ctx context.Context, job models.Job, delay time.Duration, reason string) error
+	// BuryJob move claimed job to dead letters
+	BuryJob(ctx context.Context, job models.Job, reason string) error
+	// AddDeadLetter put failed task in dead letters
+	AddDeadLetter(ctx context.Context, dl models.DeadLetter) error
+	// DeadLetters get last dead letters
+	DeadLetters(ctx context.Context) ([]models.DeadLetter, error)
+	// ReplayDeadLetter move dead letter back to jobs queue
+	// Must return sql.ErrNoRows if dead letter not found
+	ReplayDeadLetter(ctx context.Context, id int64) error
+	// Outbox get oldest undelivered events
+	Outbox(ctx context.Context, limit int) ([]models.OutboxMessage, error)
+	// DeleteOutbox remove delivered event
+	DeleteOutbox(ctx context.Context, id int64) error
+	// ReserveIdempotencyKey save record of new request with idempotency key
+	// Return stored record and false if key of user is already used
+	// Unfinished record of same request older than lease is taken over, so abandoned key don't block retries
+	ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, lease time.Duration) (models.IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey save response of request with idempotency key
+	CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error
+	// DeleteIdempotencyKey release key of user for new request
+	DeleteIdempotencyKey(ctx context.Context, userID int, key string) error
+	// AddAudit put action of operator in audit log
+	AddAudit(ctx context.Context, audit models.AuditEntry) error
+	// AuditLog get page of audit log by filter, last actions first
+	AuditLog(ctx context.Context, flt models.AuditFilter) ([]models.AuditEntry, error)
+	// Stats get counters of orders and withdrawals for monitoring
+	Stats(ctx context.Context) (models.Stats, error)
+	// Ping check connect to storage
+	Ping(ctx context.Context) error
+	// TryLock take named lock shared by all instances without wait
+	// Return false if lock is held by other instance
+	TryLock(ctx context.Context, name string) (Lock, bool, error)
 	// Close storage connect
 	Close()
 }
@@ -0,0 +1,60 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"sync"
+)
+
+// ErrDeclined if payment is declined by gateway and can't be repeated
+var ErrDeclined = errors.New("payment declined")
+
+// PaymentGateway describe payment of withdrawal to external system
+// Payment can be repeated after crash, so gateway must be idempotent by withdrawal id
+type PaymentGateway interface {
+	// Pay withdrawal, ErrDeclined if payment is impossible
+	Pay(ctx context.Context, wd models.Withdraw) error
+}
+
+// FakeGateway local gateway without external system
+type FakeGateway struct {
+	mu       sync.Mutex
+	limit    money.Amount
+	payments map[int]money.Amount
+}
+
+// NewFakeGateway constructor, sums above limit are declined, zero limit is unlimited
+func NewFakeGateway(limit money.Amount) *FakeGateway {
+	return &FakeGateway{
+		limit:    limit,
+		payments: make(map[int]money.Amount),
+	}
+}
+
+// Pay withdrawal only once
+func (g *FakeGateway) Pay(ctx context.Context, wd models.Withdraw) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.payments[wd.ID]; ok {
+		return nil
+	}
+	if g.limit > 0 && wd.Sum > g.limit {
+		return ErrDeclined
+	}
+	g.payments[wd.ID] = wd.Sum
+
+	return nil
+}
+
+// Paid return sum paid for withdrawal
+func (g *FakeGateway) Paid(id int) (money.Amount, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sum, ok := g.payments[id]
+
+	return sum, ok
+}
@@ -2,48 +2,189 @@ package withdrawal
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	"go.uber.org/zap"
+	"strconv"
 	"time"
 )
 
+// Config of withdrawal handler
+type Config struct {
+	// PollInterval pause between searches of unfinished withdrawals
+	PollInterval time.Duration
+	// Batch max count of withdrawals processed at once
+	Batch int
+	// StaleTimeout time after which processing withdrawal is taken again
+	StaleTimeout time.Duration
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		Batch:        1000,
+		StaleTimeout: time.Minute,
+	}
+}
+
+// Processor move withdrawals through statuses
+// NEW -> PROCESSING -> COMPLETED or FAILED -> REFUNDED
+type Processor struct {
+	lgr *zap.Logger
+	stg storage.Storage
+	gw  PaymentGateway
+	mtr *metrics.Metrics
+	cfg Config
+}
+
+// New constructor for withdrawal processor
+func New(lgr *zap.Logger, stg storage.Storage, gw PaymentGateway, mtr *metrics.Metrics, cfg Config) *Processor {
+	return &Processor{
+		lgr: lgr,
+		stg: stg,
+		gw:  gw,
+		mtr: mtr,
+		cfg: cfg,
+	}
+}
+
 // Run withdrawal handler
-func Run(ctx context.Context, lgr *zap.Logger, stg storage.Storage) error {
-	lgr.Info("Run withdrawal handler")
-	defer lgr.Info("Out withdrawal handler")
+// Withdrawals lost by broker or interrupted by crash are processed again
+func (p *Processor) Run(ctx context.Context) error {
+	p.lgr.Info("Run withdrawal handler")
+	defer p.lgr.Info("Out withdrawal handler")
 
 	for {
 		select {
 		// How ofter check withdrawals
-		case <-time.After(time.Second):
-			wds, err := stg.ActiveWithdrawals(ctx)
-			if err != nil {
-				lgr.Error("Get withdrawals error", zap.Error(err))
-				continue
-			}
+		case <-time.After(p.cfg.PollInterval):
+			start := time.Now()
+			p.processActive(ctx)
+			p.mtr.ObserveLoop(metrics.LoopWithdrawal, time.Since(start))
 
-			if len(wds) == 0 {
-				continue
-			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// processActive process all unfinished withdrawals
+func (p *Processor) processActive(ctx context.Context) {
+	wds, err := p.stg.ActiveWithdrawals(ctx, p.cfg.StaleTimeout, p.cfg.Batch)
+	if err != nil {
+		p.lgr.Error("Get withdrawals error", zap.Error(err))
+		return
+	}
+
+	for _, wd := range wds {
+		if err := p.process(ctx, wd); err != nil {
+			p.lgr.Error("Withdraw process error", zap.Int("withdrawal", wd.ID), zap.Error(err))
+		}
+	}
+}
+
+// Process withdrawal by id from its current status
+func (p *Processor) Process(ctx context.Context, id int) error {
+	wd, err := p.stg.WithdrawalByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			p.lgr.Error("Withdrawal not found", zap.Int("withdrawal", id))
+			return nil
+		}
+		return err
+	}
+
+	return p.process(ctx, wd)
+}
+
+// HandleMessage process withdrawal from broker message
+// Withdrawal is processed by its actual status, so repeated message is safe
+func (p *Processor) HandleMessage(ctx context.Context, msg broker.Message) error {
+	id, err := strconv.Atoi(msg.Key)
+	if err != nil {
+		return broker.Permanent(err)
+	}
 
-			for _, wd := range wds {
-				// Some abstract implement for confirm withdraw
-				// It's a sample only
-
-				ord := models.Order{
-					UserID: wd.UserID,
-					ID:     wd.OrderID,
-				}
-				lgr.Info("Withdraw process", zap.Reflect("order", ord), zap.Reflect("sum", wd.Sum))
-				if err := stg.Withdraw(ctx, ord, wd.Sum); err != nil {
-					lgr.Error("Error withdraw", zap.Error(err))
-					return ctx.Err()
-				}
+	return p.Process(ctx, id)
+}
+
+// process withdrawal from status
+func (p *Processor) process(ctx context.Context, wd models.Withdraw) error {
+	p.lgr.Info("Withdraw process", zap.Int("withdrawal", wd.ID), zap.Stringer("status", wd.Status))
+
+	switch wd.Status {
+	case models.WithdrawNew:
+		err := p.stg.SetWithdrawStatus(ctx, wd.ID, models.WithdrawNew, models.WithdrawProcessing)
+		if err != nil {
+			// Withdrawal is taken by other worker
+			if errors.Is(err, storage.ErrWithdrawStatus) {
+				return nil
 			}
+			return err
+		}
+		return p.pay(ctx, wd)
 
-		case <-ctx.Done():
-			return ctx.Err()
+	case models.WithdrawProcessing:
+		// Payment is interrupted, gateway don't pay twice
+		return p.pay(ctx, wd)
+
+	case models.WithdrawFailed:
+		return p.refund(ctx, wd)
+	}
+
+	return nil
+}
+
+// pay withdrawal in gateway
+// Declined withdrawal is failed and refunded, other errors are repeated
+func (p *Processor) pay(ctx context.Context, wd models.Withdraw) error {
+	err := p.gw.Pay(ctx, wd)
+	if err != nil {
+		if !errors.Is(err, ErrDeclined) {
+			return err
 		}
+		p.lgr.Info("Withdraw declined", zap.Int("withdrawal", wd.ID), zap.Error(err))
+		if err := p.setStatus(ctx, wd.ID, models.WithdrawFailed); err != nil {
+			return err
+		}
+		return p.refund(ctx, wd)
 	}
+
+	return p.setStatus(ctx, wd.ID, models.WithdrawCompleted)
+}
+
+// setStatus finish processing withdrawal
+func (p *Processor) setStatus(ctx context.Context, id int, status models.WithdrawStatus) error {
+	err := p.stg.SetWithdrawStatus(ctx, id, models.WithdrawProcessing, status)
+	if errors.Is(err, storage.ErrWithdrawStatus) {
+		// Withdrawal is finished by other worker
+		return nil
+	}
+
+	return err
+}
+
+// refund points of failed withdrawal
+func (p *Processor) refund(ctx context.Context, wd models.Withdraw) error {
+	err := p.stg.RefundWithdrawal(ctx, wd.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWithdrawStatus) {
+			return nil
+		}
+		return err
+	}
+	p.lgr.Info("Withdraw refunded", zap.Int("withdrawal", wd.ID), zap.Reflect("sum", wd.Sum))
+
+	return nil
+}
+
+// HandleEvent publish withdrawal from outbox event
+// Durable queue don't duplicate message with same key, so repeated event is safe
+func HandleEvent(ctx context.Context, pub broker.Publisher, msg models.OutboxMessage) error {
+	return pub.Publish(ctx, broker.Message{Kind: models.JobWithdraw, Key: msg.Key, Payload: msg.Payload})
 }
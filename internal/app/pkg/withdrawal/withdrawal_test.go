@@ -0,0 +1,97 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// downGateway gateway which isn't available
+type downGateway struct{}
+
+func (downGateway) Pay(ctx context.Context, wd models.Withdraw) error {
+	return errors.New("gateway is down")
+}
+
+// newTestStorage storage with user balance 100 and withdrawals of 30 and 60
+func newTestStorage(t *testing.T) *memory.Memory {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.Register(ctx, models.User{Login: "test", Password: "secret"}))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.AddPoints(ctx, 1, 100, 12345674))
+	require.NoError(t, stg.AddWithdraw(ctx, models.Order{UserID: 1, ID: "2377225624"}, 30))
+	require.NoError(t, stg.AddWithdraw(ctx, models.Order{UserID: 1, ID: "79927398713"}, 60))
+
+	return stg
+}
+
+func TestProcessor_Process(t *testing.T) {
+	ctx := context.Background()
+	stg := newTestStorage(t)
+	gw := NewFakeGateway(50)
+	wpr := New(zap.NewNop(), stg, gw, metrics.New(prometheus.NewRegistry()), DefaultConfig())
+
+	require.NoError(t, wpr.Process(ctx, 1))
+	require.NoError(t, wpr.Process(ctx, 2))
+	// Repeated processing don't pay or refund twice
+	require.NoError(t, wpr.Process(ctx, 1))
+	require.NoError(t, wpr.HandleMessage(ctx, broker.Message{Kind: models.JobWithdraw, Key: "2"}))
+
+	wd, err := stg.WithdrawalByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawCompleted, wd.Status)
+	paid, ok := gw.Paid(1)
+	assert.True(t, ok)
+	assert.Equal(t, money.Amount(30), paid)
+
+	// Declined withdrawal is refunded
+	wd, err = stg.WithdrawalByID(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawRefunded, wd.Status)
+	_, ok = gw.Paid(2)
+	assert.False(t, ok)
+
+	usr, err := stg.UserByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(70), usr.Points)
+	assert.Equal(t, money.Amount(30), usr.Withdrawn)
+
+	entries, err := stg.BalanceHistory(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, models.LedgerReversal, entries[0].Type)
+	assert.Equal(t, money.Amount(60), entries[0].Amount)
+
+	// Unknown withdrawal and bad message can't be processed
+	assert.NoError(t, wpr.Process(ctx, 3))
+	var permanent *broker.PermanentError
+	assert.True(t, errors.As(wpr.HandleMessage(ctx, broker.Message{Kind: models.JobWithdraw, Key: "bad"}), &permanent))
+}
+
+func TestProcessor_GatewayDown(t *testing.T) {
+	ctx := context.Background()
+	stg := newTestStorage(t)
+
+	// Unavailable gateway keep withdrawal in processing for retry
+	assert.Error(t, New(zap.NewNop(), stg, downGateway{}, metrics.New(prometheus.NewRegistry()), DefaultConfig()).Process(ctx, 1))
+	wd, err := stg.WithdrawalByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawProcessing, wd.Status)
+
+	// Interrupted withdrawal is paid by other worker
+	require.NoError(t, New(zap.NewNop(), stg, NewFakeGateway(0), metrics.New(prometheus.NewRegistry()), DefaultConfig()).Process(ctx, 1))
+	wd, err = stg.WithdrawalByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawCompleted, wd.Status)
+}
@@ -2,14 +2,22 @@ package routes
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/admin"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/auth"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/balance"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/balancehistory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/logout"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/order"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/orderslist"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/refresh"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/registration"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/withdraw"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/handlers/withdrawallist"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/authenticator"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/middlewares/idempotency"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/health"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/session"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker"
 	"go.uber.org/zap"
@@ -17,22 +25,71 @@ import (
 )
 
 // Router define routes priority
-func Router(lgr *zap.Logger, stg storage.Storage, pub broker.Publisher, ckr checker.Controller) *mux.Router {
+func Router(
+	lgr *zap.Logger,
+	stg storage.Storage,
+	ses *session.Manager,
+	ckr checker.Controller,
+	adminToken string,
+	mtr *metrics.Metrics,
+	hlt *health.Health,
+) *mux.Router {
 	rtr := mux.NewRouter()
+	// Latency and status codes of all routes
+	rtr.Use(mtr.Middleware)
+	// Metrics for prometheus
+	rtr.Handle("/metrics", mtr.Handler()).Methods(http.MethodGet)
+	// Probes for orchestrator
+	rtr.HandleFunc("/healthz", hlt.Live).Methods(http.MethodGet)
+	rtr.HandleFunc("/readyz", hlt.Ready).Methods(http.MethodGet)
 	// Registration users
-	rtr.Handle("/api/user/register", registration.New(lgr, stg)).Methods(http.MethodPost)
+	rtr.Handle("/api/user/register", registration.New(lgr, stg, ses)).Methods(http.MethodPost)
 	// HasAuth user
-	rtr.Handle("/api/user/login", auth.New(lgr, stg)).Methods(http.MethodPost)
+	rtr.Handle("/api/user/login", auth.New(lgr, stg, ses)).Methods(http.MethodPost)
+	// Prolong session
+	rtr.Handle("/api/user/refresh", refresh.New(lgr, ses)).Methods(http.MethodPost)
+
+	// Routes only for authenticated users
+	protected := rtr.NewRoute().Subrouter()
+	protected.Use(authenticator.New(lgr, ses).Auth)
+	// Retries with Idempotency-Key header replay first response
+	idm := idempotency.New(lgr, stg)
+	// Revoke session
+	protected.Handle("/api/user/logout", logout.New(lgr, ses)).Methods(http.MethodPost)
 	// Order register
-	rtr.Handle("/api/user/orders", order.New(lgr, stg, pub, ckr)).Methods(http.MethodPost)
+	protected.Handle("/api/user/orders", idm.Idempotent(order.New(lgr, stg))).Methods(http.MethodPost)
 	// Order list
-	rtr.Handle("/api/user/orders", orderslist.New(lgr, stg)).Methods(http.MethodGet)
+	protected.Handle("/api/user/orders", orderslist.New(lgr, stg)).Methods(http.MethodGet)
 	// Get user balance
-	rtr.Handle("/api/user/balance", balance.New(lgr, stg)).Methods(http.MethodGet)
+	protected.Handle("/api/user/balance", balance.New(lgr, stg)).Methods(http.MethodGet)
 	// Withdraw request
-	rtr.Handle("/api/user/balance/withdraw", withdraw.New(lgr, stg)).Methods(http.MethodPost)
+	protected.Handle("/api/user/balance/withdraw", idm.Idempotent(withdraw.New(lgr, stg))).Methods(http.MethodPost)
 	// Get withdrawals statuses
-	rtr.Handle("/api/user/balance/withdrawals", withdrawallist.New(lgr, stg)).Methods(http.MethodGet)
+	protected.Handle("/api/user/balance/withdrawals", withdrawallist.New(lgr, stg)).Methods(http.MethodGet)
+	// Get balance changes history
+	protected.Handle("/api/user/balance/history", balancehistory.New(lgr, stg)).Methods(http.MethodGet)
+
+	// Routes for operators with admin token
+	adm := admin.New(lgr, stg, ses, ckr, adminToken)
+	operator := rtr.PathPrefix("/api/admin").Subrouter()
+	operator.Use(adm.Auth)
+	// Search users by login
+	operator.HandleFunc("/users", adm.Users).Methods(http.MethodGet)
+	// User with balance
+	operator.HandleFunc("/users/{id:[0-9]+}", adm.User).Methods(http.MethodGet)
+	// User orders, withdrawals and balance history
+	operator.HandleFunc("/users/{id:[0-9]+}/orders", adm.Orders).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}/withdrawals", adm.Withdrawals).Methods(http.MethodGet)
+	operator.HandleFunc("/users/{id:[0-9]+}/ledger", adm.Ledger).Methods(http.MethodGet)
+	// Block and unblock user
+	operator.HandleFunc("/users/{id:[0-9]+}/block", adm.Block).Methods(http.MethodPost)
+	operator.HandleFunc("/users/{id:[0-9]+}/unblock", adm.Unblock).Methods(http.MethodPost)
+	// Manual balance change
+	operator.HandleFunc("/users/{id:[0-9]+}/adjustments", adm.Adjust).Methods(http.MethodPost)
+	// Force check of order in loyalty machine
+	operator.HandleFunc("/orders/{number:[0-9]+}/recheck", adm.Recheck).Methods(http.MethodPost)
+	// Actions of operators
+	operator.HandleFunc("/audit", adm.AuditLog).Methods(http.MethodGet)
 
 	return rtr
 }
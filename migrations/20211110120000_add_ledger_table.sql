@@ -0,0 +1,57 @@
+-- +goose Up
+create table ledger
+(
+    id serial not null
+        constraint ledger_pk
+            primary key,
+    user_id int not null,
+    type varchar(20) not null,
+    amount double precision not null,
+    order_id int,
+    withdrawal_id int,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table ledger is 'Append-only log of user balance changes';
+
+comment on column ledger.id is 'Identifier of entry';
+
+comment on column ledger.user_id is 'Identifier of user';
+
+comment on column ledger.type is 'Entry type: ACCRUAL, WITHDRAWAL, REVERSAL or ADJUSTMENT';
+
+comment on column ledger.amount is 'Signed sum of balance change';
+
+comment on column ledger.order_id is 'Identifier of accrual order';
+
+comment on column ledger.withdrawal_id is 'Identifier of withdrawal';
+
+comment on column ledger.created_at is 'Create date';
+
+create index ledger_user_id_index
+    on ledger (user_id);
+
+create unique index ledger_order_id_type_uindex
+    on ledger (order_id, type);
+
+insert into ledger (user_id, type, amount, order_id, created_at)
+select user_id, 'ACCRUAL', accrual, id, created_at
+from orders
+where check_status = 3 and accrual > 0;
+
+insert into ledger (user_id, type, amount, withdrawal_id, created_at)
+select user_id, 'WITHDRAWAL', -points, id, coalesce(processed_at, CURRENT_TIMESTAMP)
+from withdrawals;
+
+insert into ledger (user_id, type, amount)
+select u.id, 'ADJUSTMENT', u.points - coalesce(l.total, 0)
+from users as u
+left join (select user_id, sum(amount) as total from ledger group by user_id) as l on l.user_id = u.id
+where u.points <> coalesce(l.total, 0);
+
+comment on column users.points is 'Current balance, cached sum of ledger entries';
+
+
+
+-- +goose Down
+drop table ledger;
@@ -0,0 +1,35 @@
+-- +goose Up
+alter table users alter column points type bigint using round(points * 100)::bigint;
+
+alter table users alter column withdrawn type bigint using round(withdrawn * 100)::bigint;
+
+comment on column users.withdrawn is 'How much user withdraw, in hundredths of point';
+
+alter table orders alter column accrual type bigint using round(accrual * 100)::bigint;
+
+comment on column orders.accrual is 'Accrual points, in hundredths of point';
+
+alter table orders alter column avail_for_withdraw type bigint using round(avail_for_withdraw * 100)::bigint;
+
+alter table withdrawals alter column points type bigint using round(points * 100)::bigint;
+
+comment on column withdrawals.points is 'Sum of withdrawal, in hundredths of point';
+
+alter table ledger alter column amount type bigint using round(amount * 100)::bigint;
+
+comment on column ledger.amount is 'Signed sum of balance change, in hundredths of point';
+
+
+
+-- +goose Down
+alter table users alter column points type double precision using points / 100.0;
+
+alter table users alter column withdrawn type double precision using withdrawn / 100.0;
+
+alter table orders alter column accrual type double precision using accrual / 100.0;
+
+alter table orders alter column avail_for_withdraw type double precision using avail_for_withdraw / 100.0;
+
+alter table withdrawals alter column points type double precision using points / 100.0;
+
+alter table ledger alter column amount type double precision using amount / 100.0;
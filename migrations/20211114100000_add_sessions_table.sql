@@ -0,0 +1,39 @@
+-- +goose Up
+create table sessions
+(
+    id varchar(64) not null
+        constraint sessions_pk
+            primary key,
+    user_id int not null,
+    expires_at timestamptz not null,
+    revoked_at timestamptz,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table sessions is 'Users sessions, one per device';
+
+comment on column sessions.id is 'Session identifier from token';
+
+comment on column sessions.user_id is 'Identifier of user';
+
+comment on column sessions.expires_at is 'Expire time of refresh token';
+
+comment on column sessions.revoked_at is 'Logout time';
+
+create index sessions_user_id_index
+    on sessions (user_id);
+
+drop index users_auth_token_uindex;
+
+alter table users drop column auth_token;
+
+
+
+-- +goose Down
+drop table sessions;
+
+alter table users
+    add auth_token varchar(100);
+
+create unique index users_auth_token_uindex
+    on users (auth_token);
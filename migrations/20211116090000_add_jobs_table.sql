@@ -0,0 +1,43 @@
+-- +goose Up
+create table jobs
+(
+    id bigserial
+        constraint jobs_pk
+            primary key,
+    kind varchar(64) not null,
+    key varchar(255) not null,
+    payload bytea,
+    attempts int default 0 not null,
+    run_at timestamptz default CURRENT_TIMESTAMP not null,
+    locked_until timestamptz,
+    lock_token varchar(64),
+    last_error text,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table jobs is 'Durable queue of background tasks';
+
+comment on column jobs.kind is 'Type of task, define handler';
+
+comment on column jobs.key is 'Task key, unique for type';
+
+comment on column jobs.attempts is 'Count of claims by workers';
+
+comment on column jobs.run_at is 'Time when task can be claimed';
+
+comment on column jobs.locked_until is 'End of visibility timeout of claimed task';
+
+comment on column jobs.lock_token is 'Token of worker claim';
+
+comment on column jobs.last_error is 'Error of last failed attempt';
+
+create unique index jobs_kind_key_uindex
+    on jobs (kind, key);
+
+create index jobs_kind_run_at_index
+    on jobs (kind, run_at);
+
+
+
+-- +goose Down
+drop table jobs;
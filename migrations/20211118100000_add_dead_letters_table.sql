@@ -0,0 +1,31 @@
+-- +goose Up
+create table dead_letters
+(
+    id bigserial
+        constraint dead_letters_pk
+            primary key,
+    kind varchar(64) not null,
+    key varchar(255) not null,
+    payload bytea,
+    attempts int default 0 not null,
+    last_error text,
+    failed_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table dead_letters is 'Tasks failed too many times, can be replayed to jobs queue';
+
+comment on column dead_letters.kind is 'Type of task, define handler';
+
+comment on column dead_letters.key is 'Task key, unique for type in jobs queue';
+
+comment on column dead_letters.attempts is 'Count of failed attempts';
+
+comment on column dead_letters.last_error is 'Error of last failed attempt';
+
+create index dead_letters_kind_index
+    on dead_letters (kind);
+
+
+
+-- +goose Down
+drop table dead_letters;
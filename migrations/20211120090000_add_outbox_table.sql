@@ -0,0 +1,24 @@
+-- +goose Up
+create table outbox
+(
+    id bigserial
+        constraint outbox_pk
+            primary key,
+    topic varchar(64) not null,
+    key varchar(255) not null,
+    payload bytea,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table outbox is 'Events written with business data, relay deliver them to broker';
+
+comment on column outbox.topic is 'Type of event, define handler of relay';
+
+comment on column outbox.key is 'Key of event entity';
+
+comment on column outbox.payload is 'Event data';
+
+
+
+-- +goose Down
+drop table outbox;
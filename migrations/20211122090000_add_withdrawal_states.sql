@@ -0,0 +1,18 @@
+-- +goose Up
+alter table withdrawals
+    add updated_at timestamptz default CURRENT_TIMESTAMP not null;
+
+comment on column withdrawals.updated_at is 'Time of last status change';
+
+comment on column withdrawals.status is 'Status of withdraw: 0 new, 1 completed, 2 processing, 3 failed, 4 refunded';
+
+create index withdrawals_status_index
+    on withdrawals (status);
+
+
+
+-- +goose Down
+drop index withdrawals_status_index;
+
+alter table withdrawals
+    drop column updated_at;
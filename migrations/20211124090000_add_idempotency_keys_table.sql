@@ -0,0 +1,28 @@
+-- +goose Up
+create table idempotency_keys
+(
+    user_id int not null,
+    key varchar(255) not null,
+    request_hash varchar(64) not null,
+    status int default 0 not null,
+    content_type varchar(255) default '' not null,
+    body bytea,
+    created_at timestamptz default CURRENT_TIMESTAMP not null,
+    constraint idempotency_keys_pk
+        primary key (user_id, key)
+);
+
+comment on table idempotency_keys is 'Responses of requests with Idempotency-Key header, replayed on retry';
+
+comment on column idempotency_keys.key is 'Value of Idempotency-Key header, unique per user';
+
+comment on column idempotency_keys.request_hash is 'Hash of method, path and body of first request';
+
+comment on column idempotency_keys.status is 'HTTP status of response, 0 while request is in progress';
+
+comment on column idempotency_keys.body is 'Body of response';
+
+
+
+-- +goose Down
+drop table idempotency_keys;
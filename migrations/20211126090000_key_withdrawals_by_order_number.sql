@@ -0,0 +1,43 @@
+-- +goose Up
+alter table withdrawals rename column order_id to order_number;
+
+comment on column withdrawals.order_number is 'Number of order paid by points';
+
+-- Order could be paid twice before, extra withdrawals are refunded to keep one per order
+-- Completed withdrawal is kept first, then the oldest one
+with duplicates as (
+    select id
+    from (
+        select id, row_number() over (partition by order_number order by status = 1 desc, id) as n
+        from withdrawals
+        where status <> 4
+    ) as w
+    where n > 1
+), refunded as (
+    update withdrawals as w
+    set status = 4, updated_at = CURRENT_TIMESTAMP
+    from duplicates as d
+    where w.id = d.id
+    returning w.id, w.user_id, w.points
+), refunded_users as (
+    update users as u
+    set points = u.points + r.total, withdrawn = u.withdrawn - r.total
+    from (select user_id, sum(points) as total from refunded group by user_id) as r
+    where u.id = r.user_id
+)
+insert into ledger (user_id, type, amount, withdrawal_id)
+select user_id, 'REVERSAL', points, id
+from refunded;
+
+create unique index withdrawals_order_number_uindex
+    on withdrawals (order_number)
+    where status <> 4;
+
+comment on index withdrawals_order_number_uindex is 'Order is paid once, refunded withdrawal can be repeated';
+
+
+
+-- +goose Down
+drop index withdrawals_order_number_uindex;
+
+alter table withdrawals rename column order_number to order_id;
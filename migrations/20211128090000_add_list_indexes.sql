@@ -0,0 +1,18 @@
+-- +goose Up
+create index orders_user_id_id_index
+    on orders (user_id, id);
+
+create index orders_user_id_created_at_index
+    on orders (user_id, created_at);
+
+create index withdrawals_user_id_id_index
+    on withdrawals (user_id, id);
+
+
+
+-- +goose Down
+drop index withdrawals_user_id_id_index;
+
+drop index orders_user_id_created_at_index;
+
+drop index orders_user_id_id_index;
@@ -0,0 +1,41 @@
+-- +goose Up
+alter table users
+    add blocked_at timestamptz;
+
+comment on column users.blocked_at is 'Time of blocking by operator, blocked user can not login';
+
+create table audit_log
+(
+    id bigserial
+        constraint audit_log_pk
+            primary key,
+    actor varchar(255) not null,
+    action varchar(64) not null,
+    user_id int,
+    target varchar(255) default '' not null,
+    reason text default '' not null,
+    details text default '' not null,
+    created_at timestamptz default CURRENT_TIMESTAMP not null
+);
+
+comment on table audit_log is 'Actions of operators in admin API';
+
+comment on column audit_log.actor is 'Name of operator';
+
+comment on column audit_log.action is 'Type of action';
+
+comment on column audit_log.user_id is 'User affected by action';
+
+comment on column audit_log.target is 'Other entity of action, like order number';
+
+comment on column audit_log.reason is 'Reason given by operator';
+
+create index audit_log_user_id_index
+    on audit_log (user_id);
+
+
+
+-- +goose Down
+drop table audit_log;
+
+alter table users drop column blocked_at;
@@ -0,0 +1,274 @@
+// Package accrual implement http client of accrual system
+// @author Vrulin Sergey (aka Alex Versus)
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotRegistered if order is not registered in accrual system
+var ErrNotRegistered = errors.New("order not registered")
+
+// ErrUnavailable if accrual system not available and calls are stopped by breaker
+var ErrUnavailable = errors.New("accrual system unavailable")
+
+// ErrTooManyRequests if accrual system limit requests
+var ErrTooManyRequests = errors.New("too many requests")
+
+// ErrUnexpectedStatus if accrual system return unknown response code
+var ErrUnexpectedStatus = errors.New("unexpected response status")
+
+// RetryAfterError if request can be repeated only after pause
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// Error implement error interface
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.RetryAfter)
+}
+
+// Unwrap for errors.Is
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// maxLimitBody max size of read response about requests limit
+const maxLimitBody = 1024
+
+// Config of client
+type Config struct {
+	// Timeout of one request
+	Timeout time.Duration
+	// Retries count of repeats for failed request
+	Retries int
+	// RetryWait base pause between repeats, grows exponentially with jitter
+	RetryWait time.Duration
+	// BreakerThreshold count of failed calls in a row for stop calls
+	BreakerThreshold int
+	// BreakerCooldown pause of calls after breaker opened
+	BreakerCooldown time.Duration
+	// MaxConns max idle connections to accrual system
+	MaxConns int
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          5 * time.Second,
+		Retries:          3,
+		RetryWait:        100 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		MaxConns:         100,
+	}
+}
+
+// Client implement requests to accrual system
+type Client struct {
+	lgr  *zap.Logger
+	base *url.URL
+	cfg  Config
+	http *http.Client
+	brk  *Breaker
+	lim  *Limiter
+	// rand isn't safe for concurrent use
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New constructor, limiter is shared by all clients of accrual system
+func New(lgr *zap.Logger, address string, cfg Config, lim *Limiter) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxConns
+	transport.MaxIdleConnsPerHost = cfg.MaxConns
+
+	return &Client{
+		lgr:  lgr,
+		base: base,
+		cfg:  cfg,
+		http: &http.Client{Transport: transport},
+		brk:  NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		lim:  lim,
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Ready return error if calls to accrual system are stopped by breaker
+func (c *Client) Ready(ctx context.Context) error {
+	if !c.brk.Closed() {
+		return &RetryAfterError{Err: ErrUnavailable, RetryAfter: c.brk.RetryAfter()}
+	}
+
+	return nil
+}
+
+// Order get order status from accrual system
+func (c *Client) Order(ctx context.Context, code string) (models.LoyalOrder, error) {
+	var ord models.LoyalOrder
+	if !c.brk.Allow() {
+		return ord, &RetryAfterError{Err: ErrUnavailable, RetryAfter: c.brk.RetryAfter()}
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		ord, retry, err = c.order(ctx, code)
+		if !retry || attempt >= c.cfg.Retries || ctx.Err() != nil {
+			break
+		}
+		c.lgr.Info("Accrual request failed, retry", zap.Int("attempt", attempt+1), zap.Error(err))
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			return ord, ctx.Err()
+		}
+	}
+
+	switch {
+	case err == nil:
+		c.brk.Success()
+	case ctx.Err() != nil:
+		// Canceled call don't say anything about accrual system
+	case isFailure(err):
+		c.brk.Failure()
+	default:
+		// System answered, so it works
+		c.brk.Success()
+	}
+
+	return ord, err
+}
+
+// order make one request and return true if request can be repeated
+func (c *Client) order(ctx context.Context, code string) (models.LoyalOrder, bool, error) {
+	var ord models.LoyalOrder
+
+	if err := c.lim.Wait(ctx); err != nil {
+		return ord, false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	endpoint := c.base.String() + "/api/orders/" + url.PathEscape(code)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return ord, false, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return ord, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return ord, true, err
+		}
+		if err := json.Unmarshal(body, &ord); err != nil {
+			return ord, false, err
+		}
+		return ord, false, nil
+
+	case resp.StatusCode == http.StatusNoContent:
+		return ord, false, ErrNotRegistered
+
+	case resp.StatusCode == http.StatusTooManyRequests:
+		pause := retryAfter(resp.Header.Get("Retry-After"))
+		// All calls wait until end of pause
+		c.lim.Pause(pause)
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxLimitBody))
+		if rate, ok := ParseLimit(string(body)); ok && rate != c.lim.Rate() {
+			c.lgr.Info("Accrual rate limit changed", zap.Float64("rps", rate))
+			c.lim.SetRate(rate)
+		}
+		return ord, false, &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: pause}
+
+	case resp.StatusCode >= http.StatusInternalServerError:
+		// Read body for reuse connection
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return ord, true, &statusError{resp.StatusCode}
+	}
+
+	return ord, false, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+}
+
+// backoff return exponential pause with jitter for attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.cfg.RetryWait << uint(attempt)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Jitter in range [wait/2, wait*3/2)
+	return wait/2 + time.Duration(c.rnd.Int63n(int64(wait)+1))
+}
+
+// statusError server error of accrual system
+type statusError struct {
+	code int
+}
+
+// Error implement error interface
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrUnexpectedStatus, e.code)
+}
+
+// Unwrap for errors.Is
+func (e *statusError) Unwrap() error {
+	return ErrUnexpectedStatus
+}
+
+// isFailure return true if error means that accrual system is down
+func isFailure(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryAfter parse Retry-After header in seconds or http date
+func retryAfter(header string) time.Duration {
+	if sec, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+
+	return time.Second
+}
@@ -0,0 +1,190 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig config with short pauses
+func testConfig() Config {
+	return Config{
+		Timeout:          time.Second,
+		Retries:          2,
+		RetryWait:        time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+		MaxConns:         10,
+	}
+}
+
+func TestClient_Order(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(calls int32, w http.ResponseWriter)
+		status   string
+		accrual  money.Amount
+		err      error
+		retry    time.Duration
+		requests int32
+	}{
+		{
+			name: "processed",
+			handler: func(calls int32, w http.ResponseWriter) {
+				_, _ = w.Write([]byte(`{"order":"12345674","status":"PROCESSED","accrual":729.98}`))
+			},
+			status:   "PROCESSED",
+			accrual:  72998,
+			requests: 1,
+		},
+		{
+			name: "retry server error",
+			handler: func(calls int32, w http.ResponseWriter) {
+				if calls < 3 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write([]byte(`{"order":"12345674","status":"PROCESSING"}`))
+			},
+			status:   "PROCESSING",
+			requests: 3,
+		},
+		{
+			name: "server error after retries",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			err:      ErrUnexpectedStatus,
+			requests: 3,
+		},
+		{
+			name: "not registered",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			err:      ErrNotRegistered,
+			requests: 1,
+		},
+		{
+			name: "too many requests",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			err:      ErrTooManyRequests,
+			retry:    time.Minute,
+			requests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/orders/12345674", r.URL.Path)
+				tt.handler(atomic.AddInt32(&calls, 1), w)
+			}))
+			defer srv.Close()
+
+			acl, err := New(zap.NewNop(), srv.URL+"/", testConfig(), NewLimiter(0))
+			require.NoError(t, err)
+
+			ord, err := acl.Order(context.Background(), "12345674")
+			assert.Equal(t, tt.requests, atomic.LoadInt32(&calls))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				var retryErr *RetryAfterError
+				if tt.retry > 0 && assert.True(t, errors.As(err, &retryErr)) {
+					assert.Equal(t, tt.retry, retryErr.RetryAfter)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, ord.Status)
+			assert.Equal(t, tt.accrual, ord.Accrual)
+		})
+	}
+}
+
+func TestClient_OrderBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	acl, err := New(zap.NewNop(), srv.URL, testConfig(), NewLimiter(0))
+	require.NoError(t, err)
+	assert.NoError(t, acl.Ready(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		_, err = acl.Order(context.Background(), "12345674")
+		assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	}
+	requests := atomic.LoadInt32(&calls)
+
+	// Accrual system isn't called while breaker is open
+	_, err = acl.Order(context.Background(), "12345674")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	var retryErr *RetryAfterError
+	require.True(t, errors.As(err, &retryErr))
+	assert.True(t, retryErr.RetryAfter > 0)
+	assert.Equal(t, requests, atomic.LoadInt32(&calls))
+	assert.ErrorIs(t, acl.Ready(context.Background()), ErrUnavailable)
+}
+
+func TestClient_OrderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Timeout = 10 * time.Millisecond
+	cfg.Retries = 0
+	acl, err := New(zap.NewNop(), srv.URL, cfg, NewLimiter(0))
+	require.NoError(t, err)
+
+	_, err = acl.Order(context.Background(), "12345674")
+	assert.Error(t, err)
+	assert.True(t, isFailure(err))
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	brk := NewBreaker(2, time.Minute)
+	brk.now = func() time.Time { return now }
+
+	assert.True(t, brk.Allow())
+	brk.Failure()
+	assert.True(t, brk.Allow())
+	assert.True(t, brk.Closed())
+	brk.Failure()
+	assert.False(t, brk.Allow())
+	assert.False(t, brk.Closed())
+	assert.Equal(t, time.Minute, brk.RetryAfter())
+
+	// Only one probe after cooldown
+	now = now.Add(time.Minute)
+	assert.True(t, brk.Allow())
+	assert.False(t, brk.Allow())
+
+	// Failed probe open breaker again
+	brk.Failure()
+	assert.False(t, brk.Allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, brk.Allow())
+	brk.Success()
+	assert.True(t, brk.Allow())
+	assert.True(t, brk.Closed())
+	assert.Equal(t, time.Duration(0), brk.RetryAfter())
+}
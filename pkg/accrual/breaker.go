@@ -0,0 +1,108 @@
+package accrual
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// Breaker stop calls to system after series of failures until cooldown is over
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     int
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+// NewBreaker constructor
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow return true if call can be done.
+// After cooldown only one probe call allowed until it's result is known
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.openedAt = b.now()
+		return true
+	case stateHalfOpen:
+		// Probe without result can't block calls forever
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.openedAt = b.now()
+		return true
+	default:
+		return true
+	}
+}
+
+// Success close breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = stateClosed
+	b.failures = 0
+}
+
+// Failure count failure and open breaker if threshold is reached
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Closed return true if calls aren't stopped by breaker
+func (b *Breaker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == stateClosed
+}
+
+// RetryAfter return time until next probe call
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateClosed {
+		return 0
+	}
+	left := b.cooldown - b.now().Sub(b.openedAt)
+	if left < 0 {
+		return 0
+	}
+
+	return left
+}
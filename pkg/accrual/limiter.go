@@ -0,0 +1,151 @@
+package accrual
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limitPattern text of accrual system response about requests limit
+var limitPattern = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// Limiter token bucket shared by all callers of accrual system
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	now         func() time.Time
+}
+
+// NewLimiter constructor, rate in requests per second, zero rate is unlimited
+func NewLimiter(rate float64) *Limiter {
+	l := &Limiter{now: time.Now}
+	l.SetRate(rate)
+	l.tokens = l.burst
+
+	return l
+}
+
+// Wait block until call is allowed or context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// SetRate change limit of requests per second
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate = rate
+	// Burst not less than one request
+	l.burst = math.Max(1, math.Ceil(rate))
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Rate return current limit of requests per second
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// Pause stop all calls for duration
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	// Tokens accumulate again after pause
+	l.tokens = 0
+	l.last = l.pausedUntil
+}
+
+// PausedFor return time until end of pause
+func (l *Limiter) PausedFor() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if left := l.pausedUntil.Sub(l.now()); left > 0 {
+		return left
+	}
+
+	return 0
+}
+
+// reserve take token and return zero or return time for wait token
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate == 0 {
+		return 0
+	}
+
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// refill add tokens for time from last refill
+func (l *Limiter) refill() {
+	now := l.now()
+	// Tokens don't accumulate during pause
+	if now.Before(l.pausedUntil) {
+		return
+	}
+	if elapsed := now.Sub(l.last); !l.last.IsZero() && elapsed > 0 && l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// ParseLimit get limit of requests per second from accrual system response
+func ParseLimit(body string) (float64, bool) {
+	match := limitPattern.FindStringSubmatch(body)
+	if match == nil {
+		return 0, false
+	}
+	perMinute, err := strconv.Atoi(match[1])
+	if err != nil || perMinute <= 0 {
+		return 0, false
+	}
+
+	return float64(perMinute) / 60, true
+}
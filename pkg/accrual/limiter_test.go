@@ -0,0 +1,95 @@
+package accrual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Reserve(t *testing.T) {
+	lim := NewLimiter(2)
+	now := time.Now()
+	lim.now = func() time.Time { return now }
+
+	// Burst is available at start
+	assert.Equal(t, time.Duration(0), lim.reserve())
+	assert.Equal(t, time.Duration(0), lim.reserve())
+	assert.Equal(t, 500*time.Millisecond, lim.reserve())
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), lim.reserve())
+
+	// Pause stop all calls until deadline
+	lim.Pause(time.Minute)
+	assert.Equal(t, time.Minute, lim.reserve())
+	assert.Equal(t, time.Minute, lim.PausedFor())
+	// Shorter pause don't reduce current
+	lim.Pause(time.Second)
+	assert.Equal(t, time.Minute, lim.PausedFor())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), lim.PausedFor())
+	assert.Equal(t, 500*time.Millisecond, lim.reserve())
+
+	// Zero rate is unlimited
+	lim.SetRate(0)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, time.Duration(0), lim.reserve())
+	}
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	lim := NewLimiter(0)
+	lim.Pause(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, lim.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestParseLimit(t *testing.T) {
+	rate, ok := ParseLimit("No more than 120 requests per minute allowed")
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), rate)
+
+	_, ok = ParseLimit("Too many requests")
+	assert.False(t, ok)
+
+	_, ok = ParseLimit("No more than 0 requests per minute allowed")
+	assert.False(t, ok)
+}
+
+func TestClient_OrderRateLimit(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("No more than 30 requests per minute allowed"))
+	}))
+	defer srv.Close()
+
+	lim := NewLimiter(0)
+	acl, err := New(zap.NewNop(), srv.URL, testConfig(), lim)
+	require.NoError(t, err)
+	other, err := New(zap.NewNop(), srv.URL, testConfig(), lim)
+	require.NoError(t, err)
+
+	_, err = acl.Order(context.Background(), "12345674")
+	assert.ErrorIs(t, err, ErrTooManyRequests)
+	assert.Equal(t, 0.5, lim.Rate())
+	assert.True(t, lim.PausedFor() > 59*time.Second)
+
+	// Other workers wait end of pause without requests
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = other.Order(ctx, "12345674")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
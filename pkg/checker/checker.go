@@ -7,17 +7,16 @@ package checker
 
 import (
 	"context"
-	"encoding/json"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
+	"database/sql"
+	"errors"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
 	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/mq"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/accrual"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
-	"io/ioutil"
-	"net/http"
-	"runtime"
+	"math"
 	"strconv"
 	"time"
 )
@@ -25,145 +24,148 @@ import (
 // Controller implement logic for check order statuses
 type Controller interface {
 	// Repeater describe logic for repeat check orders status
-	Repeater(ctx context.Context, pub broker.Publisher) error
+	Repeater(ctx context.Context) error
 	// Check describe logic for check order status
 	Check(ctx context.Context, usrOrd models.Order) error
-	// PrepareTask describe mapping task for publisher
-	PrepareTask(ord models.Order) broker.Task
-	// RunListeners run listeners for producer
-	RunListeners(ctx context.Context, pub broker.Publisher) error
+	// Enqueue put order in queue for check
+	Enqueue(ctx context.Context, ord models.Order) error
+	// HandleEvent put order from outbox event in queue for check
+	HandleEvent(ctx context.Context, msg models.OutboxMessage) error
+	// HandleMessage check order from broker message
+	HandleMessage(ctx context.Context, msg broker.Message) error
+}
+
+// AccrualClient describe requests to accrual system
+type AccrualClient interface {
+	// Order get order status from accrual system
+	Order(ctx context.Context, code string) (models.LoyalOrder, error)
+}
+
+// Limiter describe shared limit of requests to accrual system
+type Limiter interface {
+	// PausedFor return time until accrual system accept requests again
+	PausedFor() time.Duration
+}
+
+// Config of checker
+type Config struct {
+	// Interval pause between searches of orders for repeated check
+	Interval time.Duration
+	// Batch max count of orders pushed by repeater at once
+	Batch int
+	// Retry policy of orders failed by accrual system, order is invalid after max attempts
+	Retry retry.Exponential
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		Interval: 5 * time.Second,
+		Batch:    1000,
+		Retry: retry.Exponential{
+			Base:        time.Minute,
+			Max:         30 * time.Minute,
+			MaxAttempts: 6,
+			Jitter:      0.2,
+		},
+	}
 }
 
 // Checker implement controller interface
 type Checker struct {
 	lgr *zap.Logger
-	ent *env.Env
 	stg storage.Storage
-	mq  mq.Handler
+	acl AccrualClient
+	lim Limiter
+	pub broker.Publisher
+	mtr *metrics.Metrics
+	cfg Config
 }
 
 // New constructor for checker struct
-func New(lgr *zap.Logger, ent *env.Env, stg storage.Storage) *Checker {
-	chr := &Checker{
+// Orders are checked by messages of publisher, so checker don't depend on transport
+func New(
+	lgr *zap.Logger,
+	stg storage.Storage,
+	acl AccrualClient,
+	lim Limiter,
+	pub broker.Publisher,
+	mtr *metrics.Metrics,
+	cfg Config,
+) *Checker {
+	return &Checker{
 		lgr: lgr,
-		ent: ent,
 		stg: stg,
+		acl: acl,
+		lim: lim,
+		pub: pub,
+		mtr: mtr,
+		cfg: cfg,
 	}
+}
 
-	if ent.BrokerType == env.BrokerTypeRabbitMQ {
-		rab, err := mq.New(lgr, ent)
-		if err != nil {
-			lgr.Fatal("Can't init rabbit handler")
-		}
-		chr.mq = *rab
-	}
+// Enqueue put order in queue for check
+func (c *Checker) Enqueue(ctx context.Context, ord models.Order) error {
+	c.lgr.Info("Publish order", zap.String("order", ord.Code))
 
-	return chr
+	return c.pub.Publish(ctx, broker.Message{Kind: models.JobCheckOrder, Key: ord.Code})
 }
 
-// RunListeners run listeners for publisher
-func (c *Checker) RunListeners(ctx context.Context, pub broker.Publisher) error {
-	defer func() {
-		if c.ent.BrokerType == env.BrokerTypeRabbitMQ {
-			// Close rabbit connections
-			c.mq.Close()
-		}
-	}()
-
-	// only for rabbit run listeners
-	if c.ent.BrokerType == env.BrokerTypeRabbitMQ {
-		group, currentCtx := errgroup.WithContext(ctx)
-
-		for i := 0; i < runtime.NumCPU(); i++ {
-			workID := i
-			f := func() error {
-				c.lgr.Info("MQ listener run", zap.Int("work id", workID))
-				defer c.lgr.Info("MQ listener stop", zap.Int("work id", workID))
-
-				for {
-					select {
-					case msg := <-c.mq.Get():
-						// Wrapper for task subscribers
-						task := func(ctx context.Context) error {
-							var ord models.Order
-							if err := json.Unmarshal(msg.Body, &ord); err != nil {
-								return err
-							}
-							if err := c.Check(currentCtx, ord); err != nil {
-								return err
-							}
-							return nil
-						}
-						// Publish task
-						c.lgr.Info("MQ listener push task", zap.Int("work id", workID))
-						if err := pub.Publish(task); err != nil {
-							return err
-						}
-					case <-currentCtx.Done():
-						return ctx.Err()
-					}
-				}
-			}
-			group.Go(f)
-		}
-
-		return group.Wait()
-	}
+// HandleEvent put order from outbox event in queue for check
+func (c *Checker) HandleEvent(ctx context.Context, msg models.OutboxMessage) error {
+	return c.Enqueue(ctx, models.Order{Code: msg.Key})
+}
 
-	return nil
+// HandleMessage check order from broker message
+// Message can be delivered again, so order is checked by its actual state
+func (c *Checker) HandleMessage(ctx context.Context, msg broker.Message) error {
+	return c.checkByCode(ctx, msg.Key)
 }
 
-// PrepareTask prepare task for current publisher
-func (c *Checker) PrepareTask(ord models.Order) broker.Task {
-	return func(ctx context.Context) error {
-		// if implement default broker
-		if c.ent.BrokerType == env.BrokerTypeGO {
-			return c.Check(ctx, ord)
-		}
+// checkByCode check order found by code
+// Unknown or already checked order is skipped
+func (c *Checker) checkByCode(ctx context.Context, key string) error {
+	code, err := strconv.Atoi(key)
+	if err != nil {
+		// Order can't be checked, so task is done
+		c.lgr.Error("Bad order code", zap.String("key", key), zap.Error(err))
+		return nil
+	}
 
-		// if it's rabbit mq
-		if c.ent.BrokerType == env.BrokerTypeRabbitMQ {
-			c.lgr.Info("Publish order in rabbit", zap.Reflect("order", ord))
-			body, err := json.Marshal(ord)
-			if err != nil {
-				return err
-			}
-			// only put in rabbit
-			if err = c.mq.Put(body); err != nil {
-				return err
-			}
+	ord, err := c.stg.OrderByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.lgr.Error("Order not found", zap.String("key", key))
+			return nil
 		}
-
+		return err
+	}
+	// Order can be checked by other task before
+	if ord.IsCheckDone {
 		return nil
 	}
+
+	return c.Check(ctx, ord)
 }
 
 // Repeater run get orders for check iteratively
 // Repeated checks
-func (c *Checker) Repeater(ctx context.Context, pub broker.Publisher) error {
+func (c *Checker) Repeater(ctx context.Context) error {
 	c.lgr.Info("Repeater started")
 	defer c.lgr.Info("Repeater stopped")
 
 	for {
 		select {
 		// How ofter chek in storage
-		case <-time.After(5 * time.Second):
-			orders, err := c.stg.OrdersForCheck(ctx)
-			if err != nil {
-				c.lgr.Error("Get order error", zap.Error(err))
+		case <-time.After(c.cfg.Interval):
+			// Don't push tasks while accrual system asks pause
+			if pause := c.lim.PausedFor(); pause > 0 {
+				c.lgr.Info("Repeater paused by accrual limit", zap.Duration("pause", pause))
 				continue
 			}
-
-			if len(orders) == 0 {
-				continue
-			}
-
-			for _, ord := range orders {
-				c.lgr.Info("Push order rto task", zap.Reflect("order", ord))
-				if err = pub.Publish(c.PrepareTask(ord)); err != nil {
-					return err
-				}
-			}
+			start := time.Now()
+			c.repeat(ctx)
+			c.mtr.ObserveLoop(metrics.LoopRepeater, time.Since(start))
 
 		case <-ctx.Done():
 			return ctx.Err()
@@ -171,95 +173,98 @@ func (c *Checker) Repeater(ctx context.Context, pub broker.Publisher) error {
 	}
 }
 
+// repeat push orders ready for check to queue
+func (c *Checker) repeat(ctx context.Context) {
+	orders, err := c.stg.OrdersForCheck(ctx, c.cfg.Batch)
+	if err != nil {
+		c.lgr.Error("Get order error", zap.Error(err))
+		return
+	}
+
+	for _, ord := range orders {
+		c.lgr.Info("Push order to queue", zap.Reflect("order", ord))
+		if err = c.Enqueue(ctx, ord); err != nil {
+			c.lgr.Error("Enqueue order error", zap.Error(err))
+		}
+	}
+}
+
 // Check order status from loyal machine
 // Implement business logic for order status check
 func (c *Checker) Check(ctx context.Context, usrOrd models.Order) error {
 	c.lgr.Info("Check order status", zap.Reflect("order", usrOrd))
 
-	url := c.ent.AccrualSystemAddress + "/api/orders/" + usrOrd.Code
-	resp, err := http.Get(url)
+	orderID, err := strconv.Atoi(usrOrd.Code)
 	if err != nil {
-		return err
+		return broker.Permanent(err)
 	}
-	defer resp.Body.Close()
 
-	c.lgr.Info("Accrual code", zap.Int("code", resp.StatusCode))
-
-	switch resp.StatusCode {
-	// to many connects strategy
-	case http.StatusTooManyRequests:
-		secTimeout := resp.Header.Get("Retry-After")
-		c.lgr.Info("To many connections. Set pause", zap.String("sec", secTimeout))
-
-		timeout, err := strconv.Atoi(secTimeout)
-		if err != nil {
-			return err
+	start := time.Now()
+	ord, err := c.acl.Order(ctx, usrOrd.Code)
+	if err != nil {
+		var retryErr *accrual.RetryAfterError
+		// to many connects strategy or accrual system is down
+		if errors.As(err, &retryErr) {
+			c.mtr.ObserveCheck(metrics.CheckRateLimited, time.Since(start))
+			c.lgr.Info("Accrual system asks pause", zap.Error(err))
+			// Pause isn't fault of order, so attempt isn't counted
+			timeout := int(math.Ceil(retryErr.RetryAfter.Seconds()))
+			return c.stg.PostponeCheck(ctx, orderID, timeout)
 		}
-		orderID, err := strconv.Atoi(usrOrd.Code)
-		if err != nil {
+		if errors.Is(err, context.Canceled) {
 			return err
 		}
-		return c.stg.SetStatus(ctx, orderID, models.PROCESSING, timeout, 0)
+		c.mtr.ObserveCheck(metrics.CheckError, time.Since(start))
+		c.lgr.Info("Accrual system error", zap.Error(err))
+
+		return c.badResponseCheck(ctx, usrOrd)
+	}
+
+	c.mtr.ObserveCheck(checkResult(ord.Status), time.Since(start))
+	c.lgr.Info("Response from loyal machine", zap.Reflect("order", ord))
 
-	case http.StatusOK:
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
+	// Check current status for order
+	switch ord.Status {
+	case models.LoyalRegistered:
+		if err := c.stg.SetStatus(ctx, orderID, models.NEW, 1, 0); err != nil {
 			return err
 		}
+		c.lgr.Info("Order registered", zap.Int("order code", orderID))
 
-		ord := models.LoyalOrder{}
-		if err := json.Unmarshal(body, &ord); err != nil {
+	case models.LoyalInvalid:
+		if err := c.stg.SetStatus(ctx, orderID, models.INVALID, 0, 0); err != nil {
 			return err
 		}
+		c.lgr.Info("Order invalid status", zap.Int("order code", orderID))
 
-		c.lgr.Info("Response from loyal machine", zap.Reflect("order", ord))
-
-		orderID, err := strconv.Atoi(usrOrd.Code)
-		if err != nil {
+	case models.LoyalProcessing:
+		if err := c.stg.SetStatus(ctx, orderID, models.PROCESSING, 1, 0); err != nil {
 			return err
 		}
-		// Check current status for order
-		switch ord.Status {
-		case models.LoyalRegistered:
-			if err := c.stg.SetStatus(ctx, orderID, models.NEW, 1, 0); err != nil {
-				return err
-			}
-			c.lgr.Info("Order registered", zap.Int("order code", orderID))
+		c.lgr.Info("Order is processing", zap.Int("order code", orderID))
 
-		case models.LoyalInvalid:
-			if err := c.stg.SetStatus(ctx, orderID, models.INVALID, 0, 0); err != nil {
-				return err
-			}
-			c.lgr.Info("Order invalid status", zap.Int("order code", orderID))
-
-		case models.LoyalProcessing:
-			if err := c.stg.SetStatus(ctx, orderID, models.PROCESSING, 1, 0); err != nil {
-				return err
-			}
-			c.lgr.Info("Order is processing", zap.Int("order code", orderID))
-
-		case models.LoyalProcessed:
-			if err := c.stg.AddPoints(ctx, usrOrd.UserID, ord.Accrual, orderID); err != nil {
-				return err
-			}
-			c.lgr.Info("Order is processed", zap.Reflect("order", ord))
-
-		default:
-			return c.badResponseCheck(ctx, usrOrd)
+	case models.LoyalProcessed:
+		if err := c.stg.AddPoints(ctx, usrOrd.UserID, ord.Accrual, orderID); err != nil {
+			return err
 		}
+		c.lgr.Info("Order is processed", zap.Reflect("order", ord))
+
 	default:
 		return c.badResponseCheck(ctx, usrOrd)
 	}
+
 	return nil
 }
 
 // badResponseCheck work with bad response from loyal machine
+// Order is checked again by retry policy, current check is attempt after checks done before
 func (c *Checker) badResponseCheck(ctx context.Context, userOrder models.Order) error {
 	orderID, err := strconv.Atoi(userOrder.Code)
 	if err != nil {
 		return err
 	}
-	if userOrder.Attempts > 5 {
+	attempt := userOrder.Attempts + 1
+	if c.cfg.Retry.Exhausted(attempt) {
 		if err := c.stg.SetStatus(ctx, orderID, models.INVALID, 0, 0); err != nil {
 			return err
 		}
@@ -267,9 +272,20 @@ func (c *Checker) badResponseCheck(ctx context.Context, userOrder models.Order)
 		return nil
 
 	}
-	currentTimeout := userOrder.Attempts * 60
+	currentTimeout := int(math.Ceil(c.cfg.Retry.Delay(attempt).Seconds()))
 	if err := c.stg.SetStatus(ctx, orderID, models.PROCESSING, currentTimeout, 0); err != nil {
 		return err
 	}
 	return nil
 }
+
+// checkResult return metric label of accrual status
+// Unexpected statuses share one label
+func checkResult(status string) string {
+	switch status {
+	case models.LoyalRegistered, models.LoyalInvalid, models.LoyalProcessing, models.LoyalProcessed:
+		return status
+	}
+
+	return metrics.CheckUnknown
+}
@@ -0,0 +1,179 @@
+package checker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/models"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker"
+	mocks3 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/broker/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/memory"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/metrics"
+	mocks2 "github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/pkg/storage/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/accrual"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/checker/mocks"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/money"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/password"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/retry"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// testConfig config without jitter
+func testConfig() Config {
+	return Config{
+		Interval: time.Millisecond,
+		Batch:    10,
+		Retry:    retry.Exponential{Base: 30 * time.Second, Max: 10 * time.Minute, MaxAttempts: 6},
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    models.Order
+		loyal    models.LoyalOrder
+		err      error
+		prepare  func(stg *mocks2.Storage)
+		checkErr error
+		// result counted in metrics
+		result string
+	}{
+		{
+			name:  "Processed",
+			order: models.Order{Code: "12345674", UserID: 1},
+			loyal: models.LoyalOrder{Order: "12345674", Status: models.LoyalProcessed, Accrual: 72998},
+			prepare: func(stg *mocks2.Storage) {
+				stg.On("AddPoints", mock.Anything, 1, money.Amount(72998), 12345674).Return(nil)
+			},
+			result: models.LoyalProcessed,
+		},
+		{
+			name:  "Processing",
+			order: models.Order{Code: "12345674", UserID: 1},
+			loyal: models.LoyalOrder{Order: "12345674", Status: models.LoyalProcessing},
+			prepare: func(stg *mocks2.Storage) {
+				stg.On("SetStatus", mock.Anything, 12345674, models.PROCESSING, 1, money.Amount(0)).Return(nil)
+			},
+			result: models.LoyalProcessing,
+		},
+		{
+			name:  "Too many requests",
+			order: models.Order{Code: "12345674", UserID: 1},
+			err:   &accrual.RetryAfterError{Err: accrual.ErrTooManyRequests, RetryAfter: 1500 * time.Millisecond},
+			prepare: func(stg *mocks2.Storage) {
+				stg.On("PostponeCheck", mock.Anything, 12345674, 2).Return(nil)
+			},
+			result: metrics.CheckRateLimited,
+		},
+		{
+			name:  "Accrual system unavailable",
+			order: models.Order{Code: "12345674", UserID: 1, Attempts: 2},
+			err:   errors.New("connection refused"),
+			prepare: func(stg *mocks2.Storage) {
+				stg.On("SetStatus", mock.Anything, 12345674, models.PROCESSING, 120, money.Amount(0)).Return(nil)
+			},
+			result: metrics.CheckError,
+		},
+		{
+			name:  "Not registered too long",
+			order: models.Order{Code: "12345674", UserID: 1, Attempts: 5},
+			err:   accrual.ErrNotRegistered,
+			prepare: func(stg *mocks2.Storage) {
+				stg.On("SetStatus", mock.Anything, 12345674, models.INVALID, 0, money.Amount(0)).Return(nil)
+			},
+			result: metrics.CheckError,
+		},
+		{
+			name:     "Canceled",
+			order:    models.Order{Code: "12345674", UserID: 1},
+			err:      context.Canceled,
+			prepare:  func(stg *mocks2.Storage) {},
+			checkErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stg := &mocks2.Storage{}
+			tt.prepare(stg)
+			acl := &mocks.AccrualClient{}
+			acl.On("Order", mock.Anything, tt.order.Code).Return(tt.loyal, tt.err)
+
+			mtr := metrics.New(prometheus.NewRegistry())
+			ckr := New(zap.NewNop(), stg, acl, accrual.NewLimiter(0), &mocks3.Publisher{}, mtr, testConfig())
+			err := ckr.Check(context.Background(), tt.order)
+			if tt.checkErr != nil {
+				assert.ErrorIs(t, err, tt.checkErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tt.result != "" {
+				assert.Equal(t, float64(1), testutil.ToFloat64(mtr.Check(tt.result)))
+			}
+
+			stg.AssertExpectations(t)
+			acl.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChecker_HandleMessage(t *testing.T) {
+	stg := &mocks2.Storage{}
+	acl := &mocks.AccrualClient{}
+	pub := &mocks3.Publisher{}
+	ckr := New(zap.NewNop(), stg, acl, accrual.NewLimiter(0), pub, metrics.New(prometheus.NewRegistry()), testConfig())
+
+	// Checker publish only serializable message
+	pub.On("Publish", mock.Anything, broker.Message{Kind: models.JobCheckOrder, Key: "12345674"}).Return(nil).Twice()
+	assert.NoError(t, ckr.Enqueue(context.Background(), models.Order{Code: "12345674", UserID: 1}))
+	assert.NoError(t, ckr.HandleEvent(context.Background(), models.NewOrderCreated("12345674")))
+
+	// Order checked by other job is skipped
+	stg.On("OrderByCode", mock.Anything, 79927398713).Return(models.Order{Code: "79927398713", IsCheckDone: true}, nil)
+	assert.NoError(t, ckr.HandleMessage(context.Background(), broker.Message{Kind: models.JobCheckOrder, Key: "79927398713"}))
+
+	// Unknown order can't be checked, so job is done
+	stg.On("OrderByCode", mock.Anything, 4561261212345467).Return(models.Order{}, sql.ErrNoRows)
+	assert.NoError(t, ckr.HandleMessage(context.Background(), broker.Message{Kind: models.JobCheckOrder, Key: "4561261212345467"}))
+
+	stg.On("OrderByCode", mock.Anything, 12345674).Return(models.Order{Code: "12345674", UserID: 1}, nil)
+	acl.On("Order", mock.Anything, "12345674").Return(models.LoyalOrder{}, context.Canceled)
+	assert.ErrorIs(t, ckr.HandleMessage(context.Background(), broker.Message{Kind: models.JobCheckOrder, Key: "12345674"}), context.Canceled)
+
+	stg.AssertExpectations(t)
+	acl.AssertExpectations(t)
+	pub.AssertExpectations(t)
+}
+
+func TestChecker_Pause(t *testing.T) {
+	ctx := context.Background()
+	stg := memory.New(zap.NewNop(), password.New(password.MinCost))
+	require.NoError(t, stg.PutOrder(ctx, models.Order{UserID: 1, Code: "12345674"}))
+	require.NoError(t, stg.SetStatus(ctx, 12345674, models.PROCESSING, 1, 0))
+
+	acl := &mocks.AccrualClient{}
+	acl.On("Order", mock.Anything, "12345674").Return(models.LoyalOrder{}, &accrual.RetryAfterError{Err: accrual.ErrUnavailable, RetryAfter: time.Minute}).Times(3)
+	acl.On("Order", mock.Anything, "12345674").Return(models.LoyalOrder{}, &accrual.RetryAfterError{Err: accrual.ErrTooManyRequests, RetryAfter: time.Second}).Times(3)
+	ckr := New(zap.NewNop(), stg, acl, accrual.NewLimiter(0), &mocks3.Publisher{}, metrics.New(prometheus.NewRegistry()), testConfig())
+
+	// Open breaker and rate limit don't spend attempts of order, so it isn't invalid after outage
+	for i := 0; i < 6; i++ {
+		ord, err := stg.OrderByCode(ctx, 12345674)
+		require.NoError(t, err)
+		require.NoError(t, ckr.Check(ctx, ord))
+	}
+
+	ord, err := stg.OrderByCode(ctx, 12345674)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ord.Attempts)
+	assert.Equal(t, "PROCESSING", ord.CheckStatus)
+	assert.False(t, ord.IsCheckDone)
+	acl.AssertExpectations(t)
+}
@@ -31,29 +31,41 @@ func (_m *Controller) Check(ctx context.Context, usrOrd models.Order) error {
 	return r0
 }
 
-// PrepareTask provides a mock function with given fields: ord
-func (_m *Controller) PrepareTask(ord models.Order) func(context.Context) error {
-	ret := _m.Called(ord)
+// Enqueue provides a mock function with given fields: ctx, ord
+func (_m *Controller) Enqueue(ctx context.Context, ord models.Order) error {
+	ret := _m.Called(ctx, ord)
 
-	var r0 func(context.Context) error
-	if rf, ok := ret.Get(0).(func(models.Order) func(context.Context) error); ok {
-		r0 = rf(ord)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Order) error); ok {
+		r0 = rf(ctx, ord)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// HandleEvent provides a mock function with given fields: ctx, msg
+func (_m *Controller) HandleEvent(ctx context.Context, msg models.OutboxMessage) error {
+	ret := _m.Called(ctx, msg)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.OutboxMessage) error); ok {
+		r0 = rf(ctx, msg)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(func(context.Context) error)
-		}
+		r0 = ret.Error(0)
 	}
 
 	return r0
 }
 
-// Repeater provides a mock function with given fields: ctx, pub
-func (_m *Controller) Repeater(ctx context.Context, pub broker.Publisher) error {
-	ret := _m.Called(ctx, pub)
+// HandleMessage provides a mock function with given fields: ctx, msg
+func (_m *Controller) HandleMessage(ctx context.Context, msg broker.Message) error {
+	ret := _m.Called(ctx, msg)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, broker.Publisher) error); ok {
-		r0 = rf(ctx, pub)
+	if rf, ok := ret.Get(0).(func(context.Context, broker.Message) error); ok {
+		r0 = rf(ctx, msg)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -61,13 +73,13 @@ func (_m *Controller) Repeater(ctx context.Context, pub broker.Publisher) error
 	return r0
 }
 
-// RunListeners provides a mock function with given fields: ctx, pub
-func (_m *Controller) RunListeners(ctx context.Context, pub broker.Publisher) error {
-	ret := _m.Called(ctx, pub)
+// Repeater provides a mock function with given fields: ctx
+func (_m *Controller) Repeater(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, broker.Publisher) error); ok {
-		r0 = rf(ctx, pub)
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
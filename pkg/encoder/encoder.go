@@ -1,19 +1,23 @@
 package encoder
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
 const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdefghijklmnopqrstuvwxyz"
 
-var seededRand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
-
+// stringWithCharset generate string from charset by cryptographic random
 func stringWithCharset(length int, charset string) string {
 	b := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// System random source must be available
+			panic(err)
+		}
+		b[i] = charset[n.Int64()]
 	}
 	return string(b)
 }
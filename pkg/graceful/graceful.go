@@ -0,0 +1,33 @@
+// Package graceful implement contexts for tasks which must be finished on shutdown
+// @author Vrulin Sergey (aka Alex Versus)
+package graceful
+
+import (
+	"context"
+	"time"
+)
+
+// Context return context of task which outlive parent for timeout
+// Workers stop take new tasks when parent is done, current task is canceled only after timeout
+func Context(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,29 @@
+package graceful
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	parent, stop := context.WithCancel(context.Background())
+	ctx, cancel := Context(parent, 50*time.Millisecond)
+	defer cancel()
+
+	stop()
+	// Task has time to finish after parent is done
+	assert.NoError(t, ctx.Err())
+	assert.Eventually(t, func() bool {
+		return ctx.Err() == context.Canceled
+	}, time.Second, time.Millisecond)
+}
+
+func TestContext_Cancel(t *testing.T) {
+	ctx, cancel := Context(context.Background(), time.Hour)
+	assert.NoError(t, ctx.Err())
+
+	cancel()
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
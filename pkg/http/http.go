@@ -4,12 +4,11 @@ package http
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/theplant/luhn"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/encoder"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // ErrBadRequest bad request error
@@ -24,9 +23,12 @@ var ErrInvalidOrder = errors.New("invalid order")
 // ErrNotAuth user not auth
 var ErrNotAuth = errors.New("not auth")
 
-// CookieUserIDName cookie name
+// CookieUserIDName cookie name of access token
 const CookieUserIDName = "user_id"
 
+// CookieRefreshName cookie name of refresh token
+const CookieRefreshName = "refresh_token"
+
 // ParseJSONReq parse JSON request and convert to struct by point
 func ParseJSONReq(r *http.Request, s interface{}) error {
 	if r.Body == http.NoBody {
@@ -44,18 +46,28 @@ func ParseJSONReq(r *http.Request, s interface{}) error {
 	return nil
 }
 
-// AuthUser auth current user and save cookie token
-func AuthUser(w http.ResponseWriter) string {
-	encoded := encoder.RandomString(50)
-
+// SetCookie save cookie token until expire time
+func SetCookie(w http.ResponseWriter, name, value string, expires time.Time) {
 	cookie := &http.Cookie{
-		Name:  CookieUserIDName,
-		Value: encoded,
-		Path:  "/",
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
 	}
 	http.SetCookie(w, cookie)
+}
 
-	return encoded
+// ClearCookie remove cookie token
+func ClearCookie(w http.ResponseWriter, name string) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	}
+	http.SetCookie(w, cookie)
 }
 
 // IsValidOrder validate orders for check
@@ -72,7 +84,6 @@ func IsValidOrder(r *http.Request) (int, error) {
 		return id, ErrBadRequest
 	}
 
-	fmt.Println(id)
 	// Check for Luhn
 	if !luhn.Valid(id) {
 		return id, ErrInvalidOrder
@@ -80,3 +91,13 @@ func IsValidOrder(r *http.Request) (int, error) {
 
 	return id, nil
 }
+
+// IsValidOrderNumber validate order number by Luhn
+func IsValidOrderNumber(number string) bool {
+	id, err := strconv.Atoi(number)
+	if err != nil || id <= 0 {
+		return false
+	}
+
+	return luhn.Valid(id)
+}
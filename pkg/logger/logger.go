@@ -6,16 +6,17 @@ import (
 	"time"
 )
 
-// New Config instance
+// New Config instance with info level
 func New() (*zap.Logger, error) {
+	return NewWithLevel(zap.InfoLevel.String())
+}
+
+// NewWithLevel Config instance with level by name, e.g. debug, info, warn, error
+func NewWithLevel(level string) (*zap.Logger, error) {
 	// Init config
 	cfg := zap.NewProductionConfig()
-	// Set level
-	cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 	// Log level
 	atom := zap.NewAtomicLevel()
-	// level
-	level := zap.InfoLevel.String()
 	if err := atom.UnmarshalText([]byte(level)); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,194 @@
+// Package money implement exact fixed-point amount of points
+// @author Vrulin Sergey (aka Alex Versus)
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount of points in hundredths (kopecks)
+type Amount int64
+
+// Scale count of hundredths in one point
+const Scale = 100
+
+// Max and Min available amounts
+const (
+	Max = Amount(math.MaxInt64)
+	Min = Amount(math.MinInt64)
+)
+
+// ErrOverflow if amount out of range
+var ErrOverflow = errors.New("amount overflow")
+
+// ErrInvalidAmount if amount can't be parsed
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// FromFloat convert float points to amount with rounding half away from zero
+func FromFloat(f float64) (Amount, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrInvalidAmount
+	}
+	v := math.Round(f * Scale)
+	// float64(math.MaxInt64) is 2^63 and out of range
+	if v >= math.MaxInt64 || v < math.MinInt64 {
+		return 0, ErrOverflow
+	}
+
+	return Amount(v), nil
+}
+
+// Parse convert decimal string to amount with rounding half away from zero
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, ErrInvalidAmount
+		}
+		return FromFloat(f)
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, ErrInvalidAmount
+	}
+
+	// Round by third fraction digit
+	roundUp := len(fracPart) > 2 && fracPart[2] >= '5'
+	if len(fracPart) > 2 {
+		fracPart = fracPart[:2]
+	}
+	for len(fracPart) < 2 {
+		fracPart += "0"
+	}
+
+	whole, err := strconv.ParseUint(intPart, 10, 64)
+	if err != nil || whole > math.MaxInt64/Scale {
+		return 0, ErrOverflow
+	}
+	frac, _ := strconv.ParseUint(fracPart, 10, 64)
+
+	v := whole*Scale + frac
+	if roundUp {
+		v++
+	}
+	// Min amount is one hundredth greater by module than max amount
+	if v > math.MaxInt64 {
+		if negative && v == math.MaxInt64+1 {
+			return Min, nil
+		}
+		return 0, ErrOverflow
+	}
+	if negative {
+		return -Amount(v), nil
+	}
+
+	return Amount(v), nil
+}
+
+// Add sum amounts with overflow check
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > Max-b) || (b < 0 && a < Min-b) {
+		return 0, ErrOverflow
+	}
+
+	return a + b, nil
+}
+
+// Sub subtract amounts with overflow check
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if (b < 0 && a > Max+b) || (b > 0 && a < Min+b) {
+		return 0, ErrOverflow
+	}
+
+	return a - b, nil
+}
+
+// Float64 return amount in points, use only for output
+func (a Amount) Float64() float64 {
+	return float64(a) / Scale
+}
+
+// String return amount as decimal with two digits after point
+func (a Amount) String() string {
+	sign := ""
+	v := uint64(a)
+	if a < 0 {
+		sign = "-"
+		v = uint64(-a)
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, v/Scale, v%Scale)
+}
+
+// MarshalJSON marshal amount as number up to two decimals without trailing zeros
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := a.String()
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+
+	return []byte(s), nil
+}
+
+// UnmarshalJSON unmarshal amount from number or string
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		return nil
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+
+	return nil
+}
+
+// Value implement driver.Valuer for store in bigint column
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
+
+// Scan implement sql.Scanner for read from bigint column
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v)
+	case []byte:
+		i, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return ErrInvalidAmount
+		}
+		*a = Amount(i)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidAmount, src)
+	}
+
+	return nil
+}
+
+// isDigits check that string consist only digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
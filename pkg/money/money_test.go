@@ -0,0 +1,121 @@
+package money
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Amount
+		err  error
+	}{
+		{name: "integer", in: "500", want: 50000},
+		{name: "two decimals", in: "729.98", want: 72998},
+		{name: "one decimal", in: "729.9", want: 72990},
+		{name: "round down", in: "0.014", want: 1},
+		{name: "round up", in: "0.015", want: 2},
+		{name: "round negative", in: "-0.015", want: -2},
+		{name: "exponent", in: "1.5e2", want: 15000},
+		{name: "max", in: "92233720368547758.07", want: Max},
+		{name: "min", in: "-92233720368547758.08", want: Min},
+		{name: "overflow", in: "92233720368547758.08", err: ErrOverflow},
+		{name: "overflow by round", in: "92233720368547758.075", err: ErrOverflow},
+		{name: "big integer", in: "100000000000000000000", err: ErrOverflow},
+		{name: "empty", in: "", err: ErrInvalidAmount},
+		{name: "letters", in: "12a.5", err: ErrInvalidAmount},
+		{name: "no integer part", in: ".5", err: ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	a, err := FromFloat(729.98)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(72998), a)
+
+	a, err = FromFloat(0.1 + 0.2)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(30), a)
+
+	_, err = FromFloat(math.MaxFloat64)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = FromFloat(math.NaN())
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestAmount_AddSub(t *testing.T) {
+	a, err := Amount(72998).Add(2)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(73000), a)
+
+	a, err = Amount(100).Sub(250)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(-150), a)
+
+	_, err = Max.Add(1)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = Min.Sub(1)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestAmount_JSON(t *testing.T) {
+	var v struct {
+		Sum Amount `json:"sum"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": 729.98}`), &v))
+	assert.Equal(t, Amount(72998), v.Sum)
+
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.Equal(t, `{"sum":729.98}`, string(body))
+
+	v.Sum = -5
+	body, err = json.Marshal(v)
+	require.NoError(t, err)
+	assert.Equal(t, `{"sum":-0.05}`, string(body))
+
+	v.Sum = 50000
+	body, err = json.Marshal(v)
+	require.NoError(t, err)
+	assert.Equal(t, `{"sum":500}`, string(body))
+
+	v.Sum = 72990
+	body, err = json.Marshal(v)
+	require.NoError(t, err)
+	assert.Equal(t, `{"sum":729.9}`, string(body))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"sum": "abc"}`), &v))
+}
+
+func TestAmount_Scan(t *testing.T) {
+	var a Amount
+	require.NoError(t, a.Scan(int64(72998)))
+	assert.Equal(t, Amount(72998), a)
+
+	require.NoError(t, a.Scan([]byte("500")))
+	assert.Equal(t, Amount(500), a)
+
+	assert.Error(t, a.Scan("500"))
+
+	v, err := a.Value()
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), v)
+}
@@ -9,99 +9,542 @@ import (
 	"context"
 	"errors"
 	"github.com/streadway/amqp"
-	"github.com/triumphpc/go-musthave-diploma-gophermart/internal/app/env"
+	"github.com/triumphpc/go-musthave-diploma-gophermart/pkg/graceful"
 	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// ErrNotConfirmed if broker doesn't confirm published message
+var ErrNotConfirmed = errors.New("message not confirmed")
+
+// ErrClosed if handler is closed
+var ErrClosed = errors.New("handler closed")
+
+// ErrNotConnected if connection to broker is lost and not restored yet
+var ErrNotConnected = errors.New("broker not connected")
+
+// ErrReject wrapped by handler error move message to dead exchange without retry
+var ErrReject = errors.New("message rejected")
+
+// errConsumerStopped if deliveries chan is closed by broker
+var errConsumerStopped = errors.New("consumer stopped")
+
+// Topology of order checks
+const (
+	// queueName main queue of order checks
+	queueName = "orders.check"
+	// retryQueue prefix of queues which hold failed messages until ttl of queue, then return them to main queue
+	retryQueue = "orders.check.retry"
+	// deadExchange receive messages failed too many times
+	deadExchange = "orders.dlx"
+	// deadQueue store dead messages for inspect and replay
+	deadQueue = "orders.check.dead"
+	// retryHeader count of failed attempts of message
+	retryHeader = "x-retry-count"
+)
+
+// Config of handler
+type Config struct {
+	// MaxRetries count of repeats of failed message before it is moved to dead exchange
+	MaxRetries int
+	// RetryWait pause before repeat of failed message, grows exponentially
+	RetryWait time.Duration
+	// MaxRetryWait max pause before repeat of failed message
+	MaxRetryWait time.Duration
+	// ReconnectWait pause before reconnect, grows exponentially
+	ReconnectWait time.Duration
+	// MaxReconnectWait max pause before reconnect
+	MaxReconnectWait time.Duration
+	// ConfirmTimeout max wait of publish confirm
+	ConfirmTimeout time.Duration
+	// Prefetch count of unacked messages for consumer
+	Prefetch int
+	// ShutdownTimeout time for current message to be handled after consumer is stopped
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig return config for production
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:       5,
+		RetryWait:        time.Second,
+		MaxRetryWait:     time.Minute,
+		ReconnectWait:    100 * time.Millisecond,
+		MaxReconnectWait: 30 * time.Second,
+		ConfirmTimeout:   5 * time.Second,
+		Prefetch:         10,
+		ShutdownTimeout:  30 * time.Second,
+	}
+}
+
+// Connection describe amqp connection
+type Connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// Channel describe amqp channel
+type Channel interface {
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// Dialer open connection to broker
+type Dialer func(url string) (Connection, error)
+
+// connection adapter of amqp connection
+type connection struct {
+	*amqp.Connection
+}
+
+// Dial open amqp connection
+func Dial(url string) (Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection{conn}, nil
+}
+
+// Channel open new channel
+func (c *connection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// MessageHandler process message body, failed message is retried
+type MessageHandler func(ctx context.Context, body []byte) error
+
+// session connection with channel for publish in confirm mode
+type session struct {
+	conn Connection
+	// publishes are serialized for match confirms
+	mu       sync.Mutex
+	pub      Channel
+	confirms chan amqp.Confirmation
+	seq      uint64
+}
+
 // Handler describe struct for broker
 type Handler struct {
-	// main chan
-	channel *amqp.Channel
-	// queue for publisher
-	queue amqp.Queue
-	// chan for subscribers
-	msgChan <-chan amqp.Delivery
-	// Logger
-	lgr *zap.Logger
-	// Connection
-	conn *amqp.Connection
+	lgr  *zap.Logger
+	cfg  Config
+	url  string
+	dial Dialer
+	mu   sync.Mutex
+	ses  *session
+	done chan struct{}
+	once sync.Once
 }
 
-// queueName for order check
-const queueName = "orders"
-
 // New constructor
-func New(lgr *zap.Logger, ent *env.Env) (*Handler, error) {
-	p := &Handler{lgr: lgr}
+func New(lgr *zap.Logger, url string, cfg Config) (*Handler, error) {
+	return NewWithDialer(lgr, url, cfg, Dial)
+}
+
+// NewWithDialer constructor with custom connection
+func NewWithDialer(lgr *zap.Logger, url string, cfg Config, dial Dialer) (*Handler, error) {
+	h := &Handler{
+		lgr:  lgr,
+		cfg:  cfg,
+		url:  url,
+		dial: dial,
+		done: make(chan struct{}),
+	}
+	// Broker must be available on start
+	if _, err := h.current(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
 
-	conn, err := amqp.Dial(ent.BrokerHost)
+// Put message to broker and wait confirm
+func (h *Handler) Put(ctx context.Context, body []byte) error {
+	msg := amqp.Publishing{ContentType: "application/json", Body: body}
+
+	wait := h.cfg.ReconnectWait
+	for attempt := 0; ; attempt++ {
+		err := h.publish(ctx, queueName, msg)
+		if err == nil || attempt >= h.cfg.MaxRetries || errors.Is(err, ErrClosed) || ctx.Err() != nil {
+			return err
+		}
+		h.lgr.Info("Publish error, retry", zap.Int("attempt", attempt+1), zap.Error(err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wait = nextWait(wait, h.cfg.MaxReconnectWait)
+	}
+}
+
+// Consume handle messages until context is done
+// Message is acked only after successful handling, connection is restored on failure
+// Current message is handled after stop until shutdown timeout, then it's returned to queue
+func (h *Handler) Consume(ctx context.Context, handle MessageHandler) error {
+	taskCtx, cancel := graceful.Context(ctx, h.cfg.ShutdownTimeout)
+	defer cancel()
+
+	for {
+		ses, err := h.session(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = h.consume(ctx, taskCtx, ses, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h.lgr.Error("Rabbit consumer stopped, reconnect", zap.Error(err))
+		h.reset(ses)
+
+		select {
+		case <-time.After(h.cfg.ReconnectWait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Ready return error if handler hasn't active connection
+// It doesn't connect, so probe don't compete with reconnect of consumers
+func (h *Handler) Ready(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.done:
+		return ErrClosed
+	default:
+	}
+	if h.ses == nil {
+		return ErrNotConnected
+	}
+
+	return nil
+}
+
+// Close rabbit connections
+func (h *Handler) Close() {
+	h.lgr.Info("Close rabbit connection")
+	h.once.Do(func() {
+		close(h.done)
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ses != nil {
+		_ = h.ses.conn.Close()
+		h.ses = nil
+	}
+}
+
+// consume read deliveries of one channel until it is closed
+// Not started deliveries are returned to queue with channel close
+func (h *Handler) consume(ctx, taskCtx context.Context, ses *session, handle MessageHandler) error {
+	ch, err := ses.conn.Channel()
 	if err != nil {
-		return p, err
+		return err
 	}
-	p.conn = conn
+	defer ch.Close()
 
-	errChan := conn.NotifyClose(make(chan *amqp.Error, 1))
-	p.channel, err = conn.Channel()
+	if err := ch.Qos(h.cfg.Prefetch, 0, false); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return errConsumerStopped
+			}
+			h.handle(taskCtx, d, handle)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handle process delivery and ack, retry or reject it
+func (h *Handler) handle(ctx context.Context, d amqp.Delivery, handle MessageHandler) {
+	err := handle(ctx, d.Body)
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			h.lgr.Error("Ack message error", zap.Error(err))
+		}
+		return
+	}
+	// Message is returned to queue on shutdown
+	if ctx.Err() != nil {
+		_ = d.Nack(false, true)
+		return
+	}
+
+	retries := retryCount(d.Headers)
+	if retries >= h.cfg.MaxRetries || errors.Is(err, ErrReject) {
+		h.lgr.Error("Message failed, move to dead exchange", zap.Int("retries", retries), zap.Error(err))
+		if err := d.Nack(false, false); err != nil {
+			h.lgr.Error("Reject message error", zap.Error(err))
+		}
+		return
+	}
+
+	// Failed message wait in retry queue of its delay and return to main queue after ttl of queue
+	delay := h.retryDelay(retries)
+	h.lgr.Info("Message failed, retry later", zap.Int("retries", retries), zap.Duration("delay", delay), zap.Error(err))
+	headers := make(amqp.Table, len(d.Headers)+1)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryHeader] = int32(retries + 1)
+	retry := amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		CorrelationId:   d.CorrelationId,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+	if err := h.publish(ctx, retryQueueName(delay), retry); err != nil {
+		h.lgr.Error("Publish retry error, requeue message", zap.Error(err))
+		_ = d.Nack(false, true)
+		return
+	}
+	if err := d.Ack(false); err != nil {
+		h.lgr.Error("Ack message error", zap.Error(err))
+	}
+}
+
+// publish persistent message to queue and wait confirm
+func (h *Handler) publish(ctx context.Context, queue string, msg amqp.Publishing) error {
+	ses, err := h.session(ctx)
 	if err != nil {
-		return p, err
+		return err
+	}
+
+	ses.mu.Lock()
+	defer ses.mu.Unlock()
+
+	msg.DeliveryMode = amqp.Persistent
+	if err := ses.pub.Publish("", queue, false, false, msg); err != nil {
+		h.reset(ses)
+		return err
 	}
+	ses.seq++
+	tag := ses.seq
+
+	timer := time.NewTimer(h.cfg.ConfirmTimeout)
+	defer timer.Stop()
 
-	// Bag for errors from rabbit
-	_, cancel := context.WithCancel(context.Background())
+	for {
+		select {
+		case conf, ok := <-ses.confirms:
+			if !ok {
+				h.reset(ses)
+				return ErrNotConfirmed
+			}
+			// Skip confirms of publishes abandoned by timeout
+			if conf.DeliveryTag < tag {
+				continue
+			}
+			if !conf.Ack {
+				return ErrNotConfirmed
+			}
+			return nil
+		case <-timer.C:
+			return ErrNotConfirmed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// session return active session, reconnect with backoff if connection is lost
+func (h *Handler) session(ctx context.Context) (*session, error) {
+	wait := h.cfg.ReconnectWait
+	for {
+		ses, err := h.current()
+		if err == nil || errors.Is(err, ErrClosed) {
+			return ses, err
+		}
+		h.lgr.Error("Rabbit connection error, reconnect", zap.Duration("wait", wait), zap.Error(err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-h.done:
+			return nil, ErrClosed
+		}
+		wait = nextWait(wait, h.cfg.MaxReconnectWait)
+	}
+}
+
+// current return active session or connect new one
+func (h *Handler) current() (*session, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.done:
+		return nil, ErrClosed
+	default:
+	}
+	if h.ses != nil {
+		return h.ses, nil
+	}
+
+	ses, err := h.connect()
+	if err != nil {
+		return nil, err
+	}
+	h.ses = ses
+
+	return ses, nil
+}
+
+// connect open connection, declare topology and open channel for publish
+func (h *Handler) connect() (*session, error) {
+	conn, err := h.dial(h.url)
+	if err != nil {
+		return nil, err
+	}
+
+	ses, err := h.prepare(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	// Drop session when connection is lost
+	errChan := conn.NotifyClose(make(chan *amqp.Error, 1))
 	go func() {
-		err = <-errChan
-		if !errors.Is(err, context.Canceled) {
-			lgr.Error("Error from connection", zap.Error(err))
-			cancel()
+		if err, ok := <-errChan; ok {
+			h.lgr.Error("Error from connection", zap.Error(err))
 		}
+		h.reset(ses)
 	}()
 
-	// Make chains
-	if p.queue, err = p.channel.QueueDeclare(
-		queueName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	); err != nil {
-		return p, err
-	}
-
-	p.msgChan, err = p.channel.Consume(
-		queueName,
-		"consumer",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-
-	return p, err
-}
-
-// Put message to broker
-func (h *Handler) Put(body []byte) error {
-	// to rabbit
-	return h.channel.Publish(
-		"",
-		h.queue.Name,
-		false,
-		false,
-		amqp.Publishing{
-			Body: body,
-		})
-}
-
-// Get chan from rabbit
-func (h *Handler) Get() <-chan amqp.Delivery {
-	return h.msgChan
+	return ses, nil
 }
 
-// Close rabbit connections
-func (h *Handler) Close() {
-	h.lgr.Info("Close rabbit connection")
-	h.conn.Close()
-	h.channel.Close()
+// prepare declare queues and open channel for publish
+func (h *Handler) prepare(conn Connection) (*session, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages failed too many times
+	if err := ch.ExchangeDeclare(deadExchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+	if _, err := ch.QueueDeclare(deadQueue, true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+	if err := ch.QueueBind(deadQueue, queueName, deadExchange, false, nil); err != nil {
+		return nil, err
+	}
+	// Rejected messages go to dead exchange
+	if _, err := ch.QueueDeclare(queueName, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    deadExchange,
+		"x-dead-letter-routing-key": queueName,
+	}); err != nil {
+		return nil, err
+	}
+	// Expired messages go back to main queue
+	// Queue expire messages only from head, so each step of backoff has own queue with same ttl for all messages
+	for retries := 0; retries < h.cfg.MaxRetries; retries++ {
+		delay := h.retryDelay(retries)
+		if _, err := ch.QueueDeclare(retryQueueName(delay), true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queueName,
+			"x-message-ttl":             delay.Milliseconds(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	// Buffer for confirms of publishes abandoned by timeout
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 100))
+
+	return &session{conn: conn, pub: ch, confirms: confirms}, nil
+}
+
+// reset drop broken session, next call connect again
+func (h *Handler) reset(ses *session) {
+	h.mu.Lock()
+	if h.ses == ses {
+		h.ses = nil
+	}
+	h.mu.Unlock()
+
+	_ = ses.conn.Close()
+}
+
+// retryCount get count of failed attempts from message headers
+func retryCount(headers amqp.Table) int {
+	switch v := headers[retryHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+
+	return 0
+}
+
+// retryDelay return pause before repeat of message failed after retries
+func (h *Handler) retryDelay(retries int) time.Duration {
+	delay := h.cfg.RetryWait
+	for i := 0; i < retries; i++ {
+		delay = nextWait(delay, h.cfg.MaxRetryWait)
+	}
+
+	return delay
+}
+
+// retryQueueName return name of retry queue for delay
+func retryQueueName(delay time.Duration) string {
+	return retryQueue + "." + strconv.FormatInt(delay.Milliseconds(), 10)
+}
+
+// nextWait double pause up to max
+func nextWait(wait, max time.Duration) time.Duration {
+	wait *= 2
+	if wait > max {
+		return max
+	}
+
+	return wait
 }
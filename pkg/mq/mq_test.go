@@ -0,0 +1,547 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeBroker in-process amqp stand-in
+type fakeBroker struct {
+	mu          sync.Mutex
+	queues      map[string]chan amqp.Publishing
+	args        map[string]amqp.Table
+	bindings    map[string]string
+	conns       []*fakeConn
+	dials       int
+	failDials   int
+	nackPublish bool
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		queues:   make(map[string]chan amqp.Publishing),
+		args:     make(map[string]amqp.Table),
+		bindings: make(map[string]string),
+	}
+}
+
+func (b *fakeBroker) dial(url string) (Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dials++
+	if b.failDials > 0 {
+		b.failDials--
+		return nil, errors.New("connection refused")
+	}
+	conn := &fakeConn{b: b}
+	b.conns = append(b.conns, conn)
+
+	return conn, nil
+}
+
+func (b *fakeBroker) queue(name string) chan amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan amqp.Publishing, 100)
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+// route put message to queue by exchange and routing key
+func (b *fakeBroker) route(exchange, key string, msg amqp.Publishing) {
+	name := key
+	if exchange != "" {
+		b.mu.Lock()
+		name = b.bindings[exchange+"/"+key]
+		b.mu.Unlock()
+	}
+	// Message expired by ttl of queue is dead-lettered by queue args
+	b.mu.Lock()
+	ttl, ok := b.args[name]["x-message-ttl"].(int64)
+	b.mu.Unlock()
+	if ok {
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.deadLetter(name, msg)
+		})
+		return
+	}
+	b.queue(name) <- msg
+}
+
+// deadLetter route message by dead letter args of queue
+func (b *fakeBroker) deadLetter(queue string, msg amqp.Publishing) {
+	b.mu.Lock()
+	args := b.args[queue]
+	b.mu.Unlock()
+
+	b.route(args["x-dead-letter-exchange"].(string), args["x-dead-letter-routing-key"].(string), msg)
+}
+
+// kill drop all connections like broker restart
+func (b *fakeBroker) kill() {
+	b.mu.Lock()
+	conns := b.conns
+	b.conns = nil
+	b.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close(&amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restart"})
+	}
+}
+
+func (b *fakeBroker) dialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dials
+}
+
+type fakeConn struct {
+	b        *fakeBroker
+	mu       sync.Mutex
+	notify   []chan *amqp.Error
+	channels []*fakeChannel
+	closed   bool
+}
+
+func (c *fakeConn) Channel() (Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{conn: c, unacked: make(map[uint64]fakeDelivery), closed: make(chan struct{})}
+	c.channels = append(c.channels, ch)
+
+	return ch, nil
+}
+
+func (c *fakeConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		close(receiver)
+		return receiver
+	}
+	c.notify = append(c.notify, receiver)
+
+	return receiver
+}
+
+func (c *fakeConn) Close() error {
+	c.close(nil)
+	return nil
+}
+
+func (c *fakeConn) close(err *amqp.Error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	channels, notify := c.channels, c.notify
+	c.mu.Unlock()
+
+	for _, ch := range channels {
+		_ = ch.Close()
+	}
+	for _, receiver := range notify {
+		if err != nil {
+			receiver <- err
+		}
+		close(receiver)
+	}
+}
+
+type fakeDelivery struct {
+	queue string
+	msg   amqp.Publishing
+}
+
+type fakeChannel struct {
+	conn     *fakeConn
+	mu       sync.Mutex
+	confirm  bool
+	confirms []chan amqp.Confirmation
+	seq      uint64
+	tag      uint64
+	unacked  map[uint64]fakeDelivery
+	closed   chan struct{}
+	isClosed bool
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error {
+	c.confirm = true
+	return nil
+}
+
+func (c *fakeChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	c.confirms = append(c.confirms, confirm)
+	return confirm
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := c.conn.b
+	b.queue(name)
+	b.mu.Lock()
+	b.args[name] = args
+	b.mu.Unlock()
+
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	b := c.conn.b
+	b.mu.Lock()
+	b.bindings[exchange+"/"+key] = name
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	deliveries := make(chan amqp.Delivery)
+	q := c.conn.b.queue(queue)
+	go func() {
+		defer close(deliveries)
+		for {
+			select {
+			case msg := <-q:
+				c.mu.Lock()
+				if c.isClosed {
+					c.mu.Unlock()
+					q <- msg
+					return
+				}
+				c.tag++
+				tag := c.tag
+				c.unacked[tag] = fakeDelivery{queue, msg}
+				c.mu.Unlock()
+
+				select {
+				case deliveries <- amqp.Delivery{
+					Acknowledger: c,
+					DeliveryTag:  tag,
+					ContentType:  msg.ContentType,
+					MessageId:    msg.MessageId,
+					Headers:      msg.Headers,
+					Body:         msg.Body,
+				}:
+				case <-c.closed:
+					return
+				}
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed {
+		return amqp.ErrClosed
+	}
+	b := c.conn.b
+	b.mu.Lock()
+	nack := b.nackPublish
+	b.mu.Unlock()
+	if !nack {
+		b.route(exchange, key, msg)
+	}
+	if c.confirm {
+		c.seq++
+		for _, confirm := range c.confirms {
+			confirm <- amqp.Confirmation{DeliveryTag: c.seq, Ack: !nack}
+		}
+	}
+
+	return nil
+}
+
+// Close channel, unacked messages are returned to queues
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed {
+		return nil
+	}
+	c.isClosed = true
+	close(c.closed)
+	for _, d := range c.unacked {
+		c.conn.b.queue(d.queue) <- d.msg
+	}
+	c.unacked = nil
+	for _, confirm := range c.confirms {
+		close(confirm)
+	}
+
+	return nil
+}
+
+func (c *fakeChannel) Ack(tag uint64, multiple bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed {
+		return amqp.ErrClosed
+	}
+	delete(c.unacked, tag)
+
+	return nil
+}
+
+func (c *fakeChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	c.mu.Lock()
+	if c.isClosed {
+		c.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	d := c.unacked[tag]
+	delete(c.unacked, tag)
+	c.mu.Unlock()
+
+	if requeue {
+		c.conn.b.queue(d.queue) <- d.msg
+		return nil
+	}
+	c.conn.b.deadLetter(d.queue, d.msg)
+
+	return nil
+}
+
+func (c *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+// testConfig config with short pauses
+func testConfig() Config {
+	return Config{
+		MaxRetries:       2,
+		RetryWait:        time.Millisecond,
+		MaxRetryWait:     5 * time.Millisecond,
+		ReconnectWait:    time.Millisecond,
+		MaxReconnectWait: 5 * time.Millisecond,
+		ConfirmTimeout:   time.Second,
+		Prefetch:         1,
+	}
+}
+
+// consume run consumer until test end
+func consume(t *testing.T, h *Handler, handle MessageHandler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Consume(ctx, handle)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		h.Close()
+	})
+}
+
+func TestHandler_PutConsume(t *testing.T) {
+	brk := newFakeBroker()
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var bodies []string
+	consume(t, h, func(ctx context.Context, body []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.Put(context.Background(), []byte(strconv.Itoa(i))))
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bodies) == 3
+	}, time.Second, time.Millisecond)
+	assert.Len(t, brk.queue(deadQueue), 0)
+}
+
+func TestHandler_RetryAndDead(t *testing.T) {
+	brk := newFakeBroker()
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+
+	var calls int32
+	consume(t, h, func(ctx context.Context, body []byte) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("accrual error")
+	})
+	brk.queue(queueName) <- amqp.Publishing{
+		MessageId: "message-1",
+		Headers:   amqp.Table{"trace": "trace-1"},
+		Body:      []byte("12345674"),
+	}
+
+	// Message is moved to dead queue after retries
+	var dead amqp.Publishing
+	select {
+	case dead = <-brk.queue(deadQueue):
+	case <-time.After(time.Second):
+		t.Fatal("message isn't dead")
+	}
+	assert.Equal(t, "12345674", string(dead.Body))
+	assert.Equal(t, 2, retryCount(dead.Headers))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	// Retry keep properties of message
+	assert.Equal(t, "message-1", dead.MessageId)
+	assert.Equal(t, "trace-1", dead.Headers["trace"])
+}
+
+func TestHandler_RetryQueues(t *testing.T) {
+	brk := newFakeBroker()
+	cfg := testConfig()
+	cfg.MaxRetries = 4
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", cfg, brk.dial)
+	require.NoError(t, err)
+	defer h.Close()
+
+	// Each step of backoff has own queue, so long pause don't hold short ones
+	brk.mu.Lock()
+	defer brk.mu.Unlock()
+	for name, ttl := range map[string]int64{
+		"orders.check.retry.1": 1,
+		"orders.check.retry.2": 2,
+		"orders.check.retry.4": 4,
+		"orders.check.retry.5": 5,
+	} {
+		require.Contains(t, brk.args, name)
+		assert.Equal(t, ttl, brk.args[name]["x-message-ttl"])
+		assert.Equal(t, queueName, brk.args[name]["x-dead-letter-routing-key"])
+	}
+}
+
+func TestHandler_Reject(t *testing.T) {
+	brk := newFakeBroker()
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+
+	var calls int32
+	consume(t, h, func(ctx context.Context, body []byte) error {
+		atomic.AddInt32(&calls, 1)
+		return fmt.Errorf("%w: bad order", ErrReject)
+	})
+	require.NoError(t, h.Put(context.Background(), []byte("12345674")))
+
+	// Rejected message isn't retried
+	select {
+	case dead := <-brk.queue(deadQueue):
+		assert.Equal(t, 0, retryCount(dead.Headers))
+	case <-time.After(time.Second):
+		t.Fatal("message isn't dead")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHandler_NotConfirmed(t *testing.T) {
+	brk := newFakeBroker()
+	brk.nackPublish = true
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+	defer h.Close()
+
+	assert.ErrorIs(t, h.Put(context.Background(), []byte("12345674")), ErrNotConfirmed)
+}
+
+func TestHandler_Reconnect(t *testing.T) {
+	brk := newFakeBroker()
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	block := make(chan struct{})
+	consume(t, h, func(ctx context.Context, body []byte) error {
+		mu.Lock()
+		calls[string(body)]++
+		first := calls[string(body)] == 1
+		mu.Unlock()
+		// First delivery is in work while broker restarts
+		if string(body) == "1" && first {
+			<-block
+		}
+		return nil
+	})
+
+	require.NoError(t, h.Put(context.Background(), []byte("1")))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls["1"] == 1
+	}, time.Second, time.Millisecond)
+
+	brk.mu.Lock()
+	brk.failDials = 2
+	brk.mu.Unlock()
+	brk.kill()
+	close(block)
+
+	// Publish wait reconnect
+	require.NoError(t, h.Put(context.Background(), []byte("2")))
+
+	// Unacked message is delivered again after reconnect
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls["1"] == 2 && calls["2"] == 1
+	}, time.Second, time.Millisecond)
+	assert.True(t, brk.dialCount() >= 4)
+}
+
+func TestHandler_Closed(t *testing.T) {
+	brk := newFakeBroker()
+	h, err := NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	require.NoError(t, err)
+	assert.NoError(t, h.Ready(context.Background()))
+
+	h.Close()
+	assert.ErrorIs(t, h.Ready(context.Background()), ErrClosed)
+	assert.ErrorIs(t, h.Put(context.Background(), []byte("1")), ErrClosed)
+	assert.ErrorIs(t, h.Consume(context.Background(), nil), ErrClosed)
+
+	brk.failDials = 1
+	_, err = NewWithDialer(zap.NewNop(), "amqp://test", testConfig(), brk.dial)
+	assert.Error(t, err)
+}
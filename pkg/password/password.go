@@ -0,0 +1,71 @@
+// Package password implement salted slow hashing of user passwords
+// @author Vrulin Sergey (aka Alex Versus)
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Cost limits of hashing
+const (
+	MinCost     = bcrypt.MinCost
+	MaxCost     = bcrypt.MaxCost
+	DefaultCost = bcrypt.DefaultCost
+)
+
+// MaxLength of password in bytes, bcrypt ignore the rest
+const MaxLength = 72
+
+// ErrTooLong if password can't be hashed without loss
+var ErrTooLong = errors.New("password too long")
+
+// bcryptPrefix common prefix of bcrypt hashes
+const bcryptPrefix = "$2"
+
+// Hasher hash and compare passwords
+type Hasher struct {
+	cost int
+}
+
+// New constructor, cost out of limits replaced by default cost
+func New(cost int) *Hasher {
+	if cost < MinCost || cost > MaxCost {
+		cost = DefaultCost
+	}
+
+	return &Hasher{cost}
+}
+
+// Hash return salted hash of password
+func (h *Hasher) Hash(password string) (string, error) {
+	if len(password) > MaxLength {
+		return "", ErrTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Compare check password with stored hash.
+// Return needRehash if hash is legacy hex encoded password or has other cost
+func (h *Hasher) Compare(hash, password string) (ok bool, needRehash bool) {
+	if !strings.HasPrefix(hash, bcryptPrefix) {
+		legacy := hex.EncodeToString([]byte(password))
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(legacy)) == 1
+		return ok, ok
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return true, err != nil || cost != h.cost
+}
@@ -0,0 +1,62 @@
+package password
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHasher_Hash(t *testing.T) {
+	hsr := New(MinCost)
+
+	hash, err := hsr.Hash("password123")
+	require.NoError(t, err)
+	assert.NotContains(t, hash, "password123")
+
+	// Salt make hashes different
+	other, err := hsr.Hash("password123")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	_, err = hsr.Hash(strings.Repeat("a", MaxLength+1))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestHasher_Compare(t *testing.T) {
+	hsr := New(MinCost)
+	hash, err := hsr.Hash("password123")
+	require.NoError(t, err)
+	otherCost, err := New(MinCost + 1).Hash("password123")
+	require.NoError(t, err)
+	legacy := hex.EncodeToString([]byte("password123"))
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		ok       bool
+		rehash   bool
+	}{
+		{name: "bcrypt", hash: hash, password: "password123", ok: true},
+		{name: "bcrypt wrong", hash: hash, password: "password124"},
+		{name: "other cost", hash: otherCost, password: "password123", ok: true, rehash: true},
+		{name: "legacy", hash: legacy, password: "password123", ok: true, rehash: true},
+		{name: "legacy wrong", hash: legacy, password: "password124"},
+		{name: "empty hash", hash: "", password: "password123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := hsr.Compare(tt.hash, tt.password)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	assert.Equal(t, &Hasher{DefaultCost}, New(0))
+	assert.Equal(t, &Hasher{DefaultCost}, New(MaxCost+1))
+	assert.Equal(t, &Hasher{MinCost}, New(MinCost))
+}
@@ -0,0 +1,146 @@
+// Package pool implement group of workers resizable at runtime
+// @author Vrulin Sergey (aka Alex Versus)
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Worker handle tasks until context is done
+// Context of worker is done on stop of pool or when pool is shrunk, current task should be finished
+type Worker func(ctx context.Context, id int) error
+
+// Pool keep size workers in each run
+type Pool struct {
+	mu   sync.Mutex
+	size int
+	runs map[*run]struct{}
+}
+
+// run workers of one Run call
+type run struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	work    Worker
+	wg      sync.WaitGroup
+	workers []*worker
+	next    int
+	once    sync.Once
+	err     error
+}
+
+// worker running in run
+type worker struct {
+	id   int
+	stop context.CancelFunc
+}
+
+// New constructor
+func New(size int) *Pool {
+	return &Pool{
+		size: size,
+		runs: make(map[*run]struct{}),
+	}
+}
+
+// Size return count of workers in each run
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.size
+}
+
+// Resize change count of workers in current and next runs
+// Extra workers are stopped from last started
+func (p *Pool) Resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.size = size
+	for r := range p.runs {
+		p.scale(r)
+	}
+}
+
+// Run start workers and block until context is done or worker failed
+// Error of worker stop other workers and is returned, worker isn't failed if it returns error of its stopped context
+func (p *Pool) Run(ctx context.Context, w Worker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := &run{ctx: ctx, cancel: cancel, work: w}
+
+	p.mu.Lock()
+	p.runs[r] = struct{}{}
+	p.scale(r)
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	// Workers aren't started after run is removed
+	p.mu.Lock()
+	delete(p.runs, r)
+	p.mu.Unlock()
+	r.wg.Wait()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return ctx.Err()
+}
+
+// scale start or stop workers of run to size of pool, must be called under lock
+func (p *Pool) scale(r *run) {
+	for len(r.workers) < p.size {
+		p.start(r)
+	}
+	for len(r.workers) > p.size {
+		last := r.workers[len(r.workers)-1]
+		r.workers = r.workers[:len(r.workers)-1]
+		last.stop()
+	}
+}
+
+// start worker in goroutine, must be called under lock
+func (p *Pool) start(r *run) {
+	ctx, stop := context.WithCancel(r.ctx)
+	w := &worker{id: r.next, stop: stop}
+	r.next++
+	r.workers = append(r.workers, w)
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		err := r.work(ctx, w.id)
+		stop()
+
+		p.mu.Lock()
+		r.remove(w)
+		p.mu.Unlock()
+
+		if err != nil && !(errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+			r.fail(err)
+		}
+	}()
+}
+
+// remove finished worker from run
+func (r *run) remove(w *worker) {
+	for i, cur := range r.workers {
+		if cur == w {
+			r.workers = append(r.workers[:i], r.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// fail stop run with first error
+func (r *run) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		r.cancel()
+	})
+}
@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter worker count running workers
+func counter(running *int64) Worker {
+	return func(ctx context.Context, id int) error {
+		atomic.AddInt64(running, 1)
+		defer atomic.AddInt64(running, -1)
+
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+// count wait count of running workers
+func count(t *testing.T, running *int64, n int64) {
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(running) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestPool_Resize(t *testing.T) {
+	var running int64
+	p := New(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx, counter(&running))
+	}()
+	count(t, &running, 2)
+
+	p.Resize(5)
+	count(t, &running, 5)
+	assert.Equal(t, 5, p.Size())
+
+	// Workers stopped by resize don't stop pool
+	p.Resize(1)
+	count(t, &running, 1)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&running))
+
+	// Size is kept for next runs
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		done <- p.Run(ctx, counter(&running))
+	}()
+	count(t, &running, 1)
+}
+
+func TestPool_Fail(t *testing.T) {
+	var running int64
+	errFailed := errors.New("failed")
+	p := New(3)
+
+	err := p.Run(context.Background(), func(ctx context.Context, id int) error {
+		if id == 2 {
+			return errFailed
+		}
+		return counter(&running)(ctx, id)
+	})
+	// Error of worker stop other workers
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&running))
+}
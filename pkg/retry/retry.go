@@ -0,0 +1,54 @@
+// Package retry implement policies of repeat of failed tasks
+// @author Vrulin Sergey (aka Alex Versus)
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Policy strategy of repeats of failed task
+type Policy interface {
+	// Delay return pause before next attempt after failed attempt, attempts are counted from 1
+	Delay(attempt int) time.Duration
+	// Exhausted return true if task must not be repeated after attempt
+	Exhausted(attempt int) bool
+}
+
+// Exponential policy with pause doubled on each attempt
+// Jitter spread pauses of tasks failed at same time, so they aren't repeated together
+type Exponential struct {
+	// Base pause after first attempt
+	Base time.Duration
+	// Max pause between attempts, jitter don't exceed it
+	Max time.Duration
+	// MaxAttempts count of attempts of task
+	MaxAttempts int
+	// Jitter part of pause changed randomly, pause is in range [wait*(1-jitter), wait*(1+jitter))
+	Jitter float64
+}
+
+// Delay implement policy interface
+func (e Exponential) Delay(attempt int) time.Duration {
+	wait := e.Base
+	for i := 1; i < attempt && wait < e.Max; i++ {
+		wait *= 2
+	}
+	if wait > e.Max {
+		wait = e.Max
+	}
+	if e.Jitter > 0 {
+		// Global source of rand is safe for concurrent use
+		wait = time.Duration(float64(wait) * (1 - e.Jitter + 2*e.Jitter*rand.Float64()))
+		if wait > e.Max {
+			wait = e.Max
+		}
+	}
+
+	return wait
+}
+
+// Exhausted implement policy interface
+func (e Exponential) Exhausted(attempt int) bool {
+	return attempt >= e.MaxAttempts
+}
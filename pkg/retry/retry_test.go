@@ -0,0 +1,42 @@
+package retry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExponential_Delay(t *testing.T) {
+	p := Exponential{Base: time.Second, Max: 10 * time.Second, MaxAttempts: 5}
+
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 8*time.Second, p.Delay(4))
+	assert.Equal(t, 10*time.Second, p.Delay(5))
+	// Big attempt don't overflow pause
+	assert.Equal(t, 10*time.Second, p.Delay(100))
+}
+
+func TestExponential_Jitter(t *testing.T) {
+	p := Exponential{Base: time.Second, Max: 10 * time.Second, Jitter: 0.5}
+
+	spread := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := p.Delay(2)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.Less(t, d, 3*time.Second)
+		spread[d] = true
+
+		// Jitter don't exceed max pause
+		assert.LessOrEqual(t, p.Delay(10), 10*time.Second)
+	}
+	assert.Greater(t, len(spread), 1)
+}
+
+func TestExponential_Exhausted(t *testing.T) {
+	p := Exponential{Base: time.Second, Max: time.Second, MaxAttempts: 3}
+
+	assert.False(t, p.Exhausted(1))
+	assert.False(t, p.Exhausted(2))
+	assert.True(t, p.Exhausted(3))
+}